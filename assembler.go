@@ -3,6 +3,7 @@ package vida
 import (
 	"fmt"
 
+	"github.com/alkemist-17/vida/ast"
 	"github.com/alkemist-17/vida/token"
 )
 
@@ -35,6 +36,16 @@ const (
 	ece = 7
 )
 
+// Kinds of check, kept in the low bits of the P operand of a check instruction.
+// Every kind but checkFalsy jumps when the value has not the shape it names.
+// The length a list is checked against is kept in the bits above the kind.
+const (
+	checkFalsy = iota
+	checkLength
+	checkMinLength
+	checkObject
+)
+
 const (
 	shift2     = 2
 	shift4     = 4
@@ -220,6 +231,13 @@ func (c *compiler) emitCheck(against, reg, jump int) {
 	c.currentFn.Code = append(c.currentFn.Code, i)
 }
 
+// emitFail emits a check of the given kind, whose jump
+// is patched later from the addresses kept in fails.
+func (c *compiler) emitFail(fails *[]int, kind, reg int) {
+	*fails = append(*fails, len(c.currentFn.Code))
+	c.emitCheck(kind, reg, 0)
+}
+
 func (c *compiler) emitFun(from, to int) {
 	var i uint64 = uint64(to)
 	i |= uint64(from) << shift16
@@ -243,6 +261,22 @@ func (c *compiler) emitRet(source, index int) {
 	c.currentFn.Code = append(c.currentFn.Code, i)
 }
 
+// emitTrace marks the start of a statement for the hook of the VM.
+// It is only emitted when compiling for the debugger and the profiler.
+func (c *compiler) emitTrace() {
+	c.currentFn.Code = append(c.currentFn.Code, trace<<shift56)
+}
+
+// recordSpan attributes the last emitted instruction to span.
+func (c *compiler) recordSpan(span token.Span) {
+	fn := c.currentFn
+	ip := len(fn.Code)
+	if ip >= len(fn.spans) {
+		fn.spans = append(fn.spans, make([]token.Span, ip+1-len(fn.spans))...)
+	}
+	fn.spans[ip] = span
+}
+
 func (c *compiler) refScope(id string) (int, int) {
 	if to, isLocal, key := c.sb.isLocal(id); isLocal {
 		if key.level != c.level {
@@ -279,7 +313,54 @@ func (c *compiler) refScope(id string) (int, int) {
 	return 0, rNotDefined
 }
 
-func (c *compiler) generateReferenceError(ref string, line uint) {
-	c.lineErr = line
+func (c *compiler) generateReferenceError(ref string, span token.Span) {
+	c.spanErr = span
 	c.errMsg = fmt.Sprintf("reference '%v' not found", ref)
 }
+
+func (c *compiler) declareLocal(id string, span token.Span, kind int, reg int) {
+	c.sb.addLocal(id, c.level, c.scope, reg)
+	if c.symbols != nil {
+		c.sb.History[len(c.sb.History)-1].def = len(c.symbols.defs)
+		c.symbols.defs = append(c.symbols.defs, symbolDef{name: id, span: span, kind: kind})
+	}
+}
+
+func (c *compiler) recordGlobal(id string, span token.Span, expr ast.Node, isPresent bool) {
+	if c.symbols == nil {
+		return
+	}
+	if !isPresent {
+		c.symbols.globals[id] = len(c.symbols.defs)
+	}
+	c.symbols.defs = append(c.symbols.defs, symbolDef{name: id, span: span, kind: symbolGlobal})
+	c.recordModule(expr)
+}
+
+// recordModule remembers the library bound by the last declaration
+// when its expression is a call to load with a string literal.
+func (c *compiler) recordModule(expr ast.Node) {
+	if c.symbols == nil {
+		return
+	}
+	if call, ok := expr.(*ast.CallExpr); ok && len(call.Args) == 1 {
+		ref, isRef := call.Fun.(*ast.Reference)
+		name, isString := call.Args[0].(*ast.String)
+		if isRef && isString && ref.Value == "load" {
+			c.symbols.defs[len(c.symbols.defs)-1].module = name.Value
+		}
+	}
+}
+
+func (c *compiler) recordReference(id string, span token.Span) {
+	if c.symbols == nil {
+		return
+	}
+	if _, isLocal, key := c.sb.isLocal(id); isLocal {
+		c.symbols.refs = append(c.symbols.refs, symbolRef{name: id, span: span, def: key.def})
+	} else if def, isPresent := c.symbols.globals[id]; isPresent {
+		c.symbols.refs = append(c.symbols.refs, symbolRef{name: id, span: span, def: def})
+	} else if _, isGlobal := c.sb.isGlobal(id); isGlobal {
+		c.symbols.refs = append(c.symbols.refs, symbolRef{name: id, span: span, def: -1})
+	}
+}
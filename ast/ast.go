@@ -11,78 +11,100 @@ type Ast struct {
 }
 
 type Var struct {
-	Identifier  string
-	Expr        Node
-	IsRecursive bool
+	Identifier     string
+	Expr           Node
+	IsRecursive    bool
+	Line           uint
+	Span           token.Span
+	IdentifierSpan token.Span
 }
 
 type Mut struct {
-	Indentifier string
-	Expr        Node
-	Line        uint
+	Identifier     string
+	Expr           Node
+	Op             token.Token
+	Line           uint
+	Span           token.Span
+	IdentifierSpan token.Span
 }
 
 type Let struct {
-	Indentifier string
-	Expr        Node
+	Identifier     string
+	Expr           Node
+	Line           uint
+	Span           token.Span
+	IdentifierSpan token.Span
 }
 
 type Reference struct {
 	Value string
 	Line  uint
+	Span  token.Span
 }
 
 type ReferenceStmt struct {
 	Value string
 	Line  uint
+	Span  token.Span
 }
 
 type Identifier struct {
 	Value string
+	Span  token.Span
 }
 
 type Boolean struct {
 	Value bool
+	Span  token.Span
 }
 
 type Integer struct {
 	Value int64
+	Span  token.Span
 }
 
 type Float struct {
 	Value float64
+	Span  token.Span
 }
 
 type String struct {
 	Value string
+	Span  token.Span
 }
 
 type Nil struct {
 	Value struct{}
+	Span  token.Span
 }
 
 type List struct {
 	ExprList []Node
+	Span     token.Span
 }
 
 type Property struct {
 	Value string
+	Span  token.Span
 }
 
 type Pair struct {
 	Key   Node
 	Value Node
+	Span  token.Span
 }
 
 type Object struct {
 	Pairs []*Pair
 	Line  uint
+	Span  token.Span
 }
 
 type PrefixExpr struct {
 	Expr Node
 	Op   token.Token
 	Line uint
+	Span token.Span
 }
 
 type BinaryExpr struct {
@@ -90,21 +112,25 @@ type BinaryExpr struct {
 	Rhs  Node
 	Op   token.Token
 	Line uint
+	Span token.Span
 }
 
 type Block struct {
 	Statement []Node
+	Span      token.Span
 }
 
 type IGet struct {
 	Indexable Node
 	Index     Node
 	Line      uint
+	Span      token.Span
 }
 
 type IGetStmt struct {
 	Index Node
 	Line  uint
+	Span  token.Span
 }
 
 type Slice struct {
@@ -113,87 +139,118 @@ type Slice struct {
 	Last  Node
 	Mode  int
 	Line  uint
+	Span  token.Span
 }
 
 type Select struct {
 	Selectable Node
 	Selector   Node
 	Line       uint
+	Span       token.Span
 }
 
 type SelectStmt struct {
 	Selector Node
 	Line     uint
+	Span     token.Span
 }
 
 type ISet struct {
 	Index Node
 	Expr  Node
+	Op    token.Token
 	Line  uint
+	Span  token.Span
 }
 
 type For struct {
-	Init  Node
-	End   Node
-	Step  Node
-	Id    string
-	Block Node
-	Line  uint
+	Init   Node
+	End    Node
+	Step   Node
+	Id     string
+	Block  Node
+	Line   uint
+	Span   token.Span
+	IdSpan token.Span
 }
 
 type ForState struct {
 	Value string
+	Span  token.Span
 }
 
 type IFor struct {
-	Key   string
-	Value string
-	Expr  Node
-	Block Node
-	Line  uint
+	Key       string
+	Value     string
+	Expr      Node
+	Block     Node
+	Line      uint
+	Span      token.Span
+	KeySpan   token.Span
+	ValueSpan token.Span
 }
 
 type Branch struct {
 	Elifs []Node
 	If    Node
 	Else  Node
+	Span  token.Span
 }
 
 type If struct {
 	Condition Node
 	Block     Node
+	Line      uint
+	Span      token.Span
 }
 
 type Else struct {
 	Block Node
+	Span  token.Span
 }
 
 type While struct {
 	Condition Node
 	Block     Node
+	Line      uint
+	Span      token.Span
 }
 
-type Break struct{}
+type Break struct {
+	Line uint
+	Span token.Span
+}
 
-type Continue struct{}
+type Continue struct {
+	Line uint
+	Span token.Span
+}
 
 type Fun struct {
-	Args  []string
-	Body  Node
-	IsVar bool
+	Args     []string
+	Body     Node
+	IsVar    bool
+	Line     uint
+	Span     token.Span
+	ArgSpans []token.Span
 }
 
 type Ret struct {
 	Expr Node
+	Line uint
+	Span token.Span
 }
 
 type Export struct {
 	Expr Node
+	Line uint
+	Span token.Span
 }
 
 type Import struct {
 	Path string
 	Line uint
+	Span token.Span
 }
 
 type CallExpr struct {
@@ -201,12 +258,14 @@ type CallExpr struct {
 	Fun      Node
 	Ellipsis int
 	Line     uint
+	Span     token.Span
 }
 
 type CallStmt struct {
 	Args     []Node
 	Ellipsis int
 	Line     uint
+	Span     token.Span
 }
 
 type MethodCallStmt struct {
@@ -214,6 +273,7 @@ type MethodCallStmt struct {
 	Prop     Node
 	Ellipsis int
 	Line     uint
+	Span     token.Span
 }
 
 type MethodCallExpr struct {
@@ -222,6 +282,7 @@ type MethodCallExpr struct {
 	Obj      Node
 	Ellipsis int
 	Line     uint
+	Span     token.Span
 }
 
 type Enum struct {
@@ -231,6 +292,63 @@ type Enum struct {
 	Step       int64
 	HasForExpr bool
 	HasInitVal bool
+	Span       token.Span
+}
+
+type Destructure struct {
+	Pattern Node
+	Expr    Node
+	Decl    token.Token
+	Line    uint
+	Span    token.Span
+}
+
+type Match struct {
+	Subject Node
+	Arms    []*MatchArm
+	Line    uint
+	Span    token.Span
+}
+
+type MatchArm struct {
+	Pattern Node
+	Guard   Node
+	Block   Node
+	Line    uint
+	Span    token.Span
+}
+
+type Wildcard struct {
+	Span token.Span
+}
+
+type BindPattern struct {
+	Identifier string
+	Line       uint
+	Span       token.Span
+}
+
+type ValuePattern struct {
+	Value Node
+	Span  token.Span
+}
+
+type ListPattern struct {
+	Elements []Node
+	Rest     Node
+	Span     token.Span
+}
+
+type FieldPattern struct {
+	Key     string
+	Pattern Node
+	Default Node
+	Span    token.Span
+}
+
+type ObjectPattern struct {
+	Fields []*FieldPattern
+	Span   token.Span
 }
 
 func (ast *Ast) _node()           {}
@@ -276,3 +394,12 @@ func (n *CallStmt) _node()        {}
 func (n *MethodCallStmt) _node()  {}
 func (n *MethodCallExpr) _node()  {}
 func (n *Enum) _node()            {}
+func (n *Destructure) _node()     {}
+func (n *Match) _node()           {}
+func (n *MatchArm) _node()        {}
+func (n *Wildcard) _node()        {}
+func (n *BindPattern) _node()     {}
+func (n *ValuePattern) _node()    {}
+func (n *ListPattern) _node()     {}
+func (n *FieldPattern) _node()    {}
+func (n *ObjectPattern) _node()   {}
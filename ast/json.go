@@ -0,0 +1,56 @@
+package ast
+
+import (
+	"reflect"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Describe returns node as plain data ready for encoding/json. Every node
+// becomes a map with its kind, the name of its Go type, and one entry per
+// field, named as the field with a lower case first letter. Child nodes are
+// described the same way, tokens keep their representation and spans their
+// offsets, lines and columns.
+func Describe(node Node) map[string]any {
+	v := reflect.ValueOf(node)
+	if !v.IsValid() || v.IsNil() {
+		return nil
+	}
+	v = v.Elem()
+	t := v.Type()
+	data := map[string]any{"kind": t.Name()}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if f.Type.Kind() == reflect.Struct && f.Type.NumField() == 0 {
+			continue
+		}
+		data[fieldName(f.Name)] = describeValue(v.Field(i))
+	}
+	return data
+}
+
+var nodeType = reflect.TypeFor[Node]()
+
+func describeValue(v reflect.Value) any {
+	switch {
+	case v.Type() == nodeType || v.Type().Kind() == reflect.Pointer && v.Type().Implements(nodeType):
+		if v.IsNil() {
+			return nil
+		}
+		return Describe(v.Interface().(Node))
+	case v.Kind() == reflect.Slice:
+		if v.Type().Elem() == nodeType || v.Type().Elem().Implements(nodeType) {
+			list := make([]any, v.Len())
+			for i := range v.Len() {
+				list[i] = describeValue(v.Index(i))
+			}
+			return list
+		}
+	}
+	return v.Interface()
+}
+
+func fieldName(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(r)) + name[size:]
+}
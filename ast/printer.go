@@ -44,8 +44,13 @@ func printAST(node Node, sb *strings.Builder, level int) {
 		buildIndent(sb, level+twoLevels)
 		sb.WriteRune(nl)
 		buildIndent(sb, level+twoLevels)
-		sb.WriteString(n.Indentifier)
+		sb.WriteString(n.Identifier)
 		sb.WriteRune(nl)
+		if n.Op.IsAssignOperator() {
+			buildIndent(sb, level+twoLevels)
+			sb.WriteString(n.Op.String())
+			sb.WriteRune(nl)
+		}
 		printAST(n.Expr, sb, level+oneLevel)
 	case *Let:
 		sb.WriteRune(nl)
@@ -54,7 +59,7 @@ func printAST(node Node, sb *strings.Builder, level int) {
 		buildIndent(sb, level+twoLevels)
 		sb.WriteRune(nl)
 		buildIndent(sb, level+twoLevels)
-		sb.WriteString(n.Indentifier)
+		sb.WriteString(n.Identifier)
 		sb.WriteRune(nl)
 		printAST(n.Expr, sb, level+oneLevel)
 	case *Reference:
@@ -186,6 +191,11 @@ func printAST(node Node, sb *strings.Builder, level int) {
 		buildIndent(sb, level+oneLevel)
 		sb.WriteString("ISet")
 		sb.WriteRune(nl)
+		if n.Op.IsAssignOperator() {
+			buildIndent(sb, level+twoLevels)
+			sb.WriteString(n.Op.String())
+			sb.WriteRune(nl)
+		}
 		printAST(n.Index, sb, level+oneLevel)
 		sb.WriteRune(nl)
 		printAST(n.Expr, sb, level+oneLevel)
@@ -400,6 +410,90 @@ func printAST(node Node, sb *strings.Builder, level int) {
 			sb.WriteString(v)
 			sb.WriteRune(nl)
 		}
+	case *Destructure:
+		sb.WriteRune(nl)
+		buildIndent(sb, level+oneLevel)
+		sb.WriteString("Destructure")
+		sb.WriteRune(nl)
+		printAST(n.Pattern, sb, level+oneLevel)
+		sb.WriteRune(nl)
+		printAST(n.Expr, sb, level+oneLevel)
+	case *Match:
+		sb.WriteRune(nl)
+		buildIndent(sb, level+oneLevel)
+		sb.WriteString("Match")
+		sb.WriteRune(nl)
+		printAST(n.Subject, sb, level+twoLevels)
+		for _, v := range n.Arms {
+			printAST(v, sb, level+oneLevel)
+		}
+	case *MatchArm:
+		sb.WriteRune(nl)
+		buildIndent(sb, level+oneLevel)
+		sb.WriteString("Arm")
+		sb.WriteRune(nl)
+		printAST(n.Pattern, sb, level+twoLevels)
+		if n.Guard != nil {
+			sb.WriteRune(nl)
+			buildIndent(sb, level+twoLevels)
+			sb.WriteString("Guard")
+			sb.WriteRune(nl)
+			printAST(n.Guard, sb, level+twoLevels)
+		}
+		sb.WriteRune(nl)
+		printAST(n.Block, sb, level+twoLevels)
+	case *Wildcard:
+		buildIndent(sb, level+oneLevel)
+		sb.WriteString("Wildcard")
+	case *BindPattern:
+		buildIndent(sb, level+oneLevel)
+		sb.WriteString("Bind")
+		sb.WriteRune(nl)
+		buildIndent(sb, level+twoLevels)
+		sb.WriteString(n.Identifier)
+	case *ValuePattern:
+		buildIndent(sb, level+oneLevel)
+		sb.WriteString("Value")
+		sb.WriteRune(nl)
+		printAST(n.Value, sb, level+oneLevel)
+	case *ListPattern:
+		buildIndent(sb, level+oneLevel)
+		sb.WriteString("ListPattern")
+		sb.WriteRune(nl)
+		for _, v := range n.Elements {
+			printAST(v, sb, level+oneLevel)
+			sb.WriteRune(nl)
+		}
+		if n.Rest != nil {
+			buildIndent(sb, level+twoLevels)
+			sb.WriteString("Rest")
+			sb.WriteRune(nl)
+			printAST(n.Rest, sb, level+twoLevels)
+			sb.WriteRune(nl)
+		}
+	case *ObjectPattern:
+		buildIndent(sb, level+oneLevel)
+		sb.WriteString("ObjectPattern")
+		sb.WriteRune(nl)
+		for _, v := range n.Fields {
+			printAST(v, sb, level+oneLevel)
+			sb.WriteRune(nl)
+		}
+	case *FieldPattern:
+		buildIndent(sb, level+oneLevel)
+		sb.WriteString("Field")
+		sb.WriteRune(nl)
+		buildIndent(sb, level+twoLevels)
+		sb.WriteString(n.Key)
+		sb.WriteRune(nl)
+		printAST(n.Pattern, sb, level+oneLevel)
+		if n.Default != nil {
+			sb.WriteRune(nl)
+			buildIndent(sb, level+twoLevels)
+			sb.WriteString("Default")
+			sb.WriteRune(nl)
+			printAST(n.Default, sb, level+twoLevels)
+		}
 	default:
 		sb.WriteRune(nl)
 		buildIndent(sb, level+oneLevel)
@@ -0,0 +1,407 @@
+package vida
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"slices"
+
+	"github.com/alkemist-17/vida/token"
+	"github.com/alkemist-17/vida/verror"
+)
+
+// Bytecode files
+//
+// A compiled script can be written to disk and run later without going through
+// the lexer, the parser and the compiler. Imported scripts are compiled into the
+// same file, so a bytecode file is self-contained.
+//
+// Unless stated otherwise, every number is an unsigned varint as written by
+// binary.AppendUvarint, and every string is its length followed by its bytes.
+//
+//	file       = header store globals konstants main
+//	header     = the header word of the compiler, 8 bytes big endian,
+//	             so every file starts with the bytes 'v' 'i' 'd' 'a'
+//	             followed by the major, minor and patch version
+//	store      = size count offset*
+//	             size is the length of the store and every offset is the index
+//	             where a copy of the core lib starts; other slots start as nil
+//	globals    = count (name index)*
+//	             the globals of the main script and their store indices
+//	konstants  = count konstant*
+//	konstant   = kind payload
+//	             kind 0, nil:      no payload
+//	             kind 1, bool:     one byte, 0 or 1
+//	             kind 2, integer:  signed varint
+//	             kind 3, float:    IEEE 754 bits, 8 bytes little endian
+//	             kind 4, string:   string
+//	             kind 5, enum:     count (name value)*, sorted by name,
+//	                               with every value a signed varint
+//	             kind 6, function: function
+//	function   = scriptName arity isVar free count info* count instruction* spans
+//	info       = index isLocal id
+//	             isVar and isLocal are one byte, 0 or 1
+//	instruction= 8 bytes little endian
+//	main       = function
+//	spans      = count (ip span)*
+//	             ip is the index after the instruction the span belongs to,
+//	             in increasing order; instructions that cannot fail have none
+//	span       = pos pos
+//	pos        = offset line column
+//	             the start and the end of the source of the instruction
+//
+// A file only runs on an interpreter of the same major and minor version.
+// Any change to the format or to the meaning of an instruction bumps the
+// minor version, as 0.4.0 did when errorInfo went from lines to spans and
+// the check instruction got kinds of its own, and 0.5.0 did when spans moved
+// from a table per script to the function they belong to and the colon token
+// renumbered the operators that binop instructions hold.
+//
+// Nested functions are not stored inside their parents. As in memory, they are
+// function konstants and the fun instruction refers to them by konstant index.
+
+const (
+	kNil = iota
+	kBool
+	kInteger
+	kFloat
+	kString
+	kEnum
+	kFunction
+)
+
+var errMalformedBytecode = errors.New("malformed bytecode file")
+
+// Build compiles the script at path and returns it serialized as bytecode.
+func Build(path string) ([]byte, error) {
+	src, err := readScript(path)
+	if err != nil {
+		return nil, err
+	}
+	script, globals, err := compileSource(src, path, "", nil, false)
+	if err != nil {
+		return nil, err
+	}
+	return encodeScript(script, globals), nil
+}
+
+func isBytecode(data []byte) bool {
+	return len(data) >= 8 && string(data[:4]) == "vida" && uint64(data[7]) == inception
+}
+
+func encodeScript(script *Script, globals map[string]int) []byte {
+	b := binary.BigEndian.AppendUint64(nil, header)
+	store := *script.Store
+	var offsets []int
+	for i := 0; i+1 < len(store); i++ {
+		if _, ok := store[i+1].(GFn); ok {
+			offsets = append(offsets, i)
+			i += len(coreLibNames) - 1
+		}
+	}
+	b = binary.AppendUvarint(b, uint64(len(store)))
+	b = binary.AppendUvarint(b, uint64(len(offsets)))
+	for _, v := range offsets {
+		b = binary.AppendUvarint(b, uint64(v))
+	}
+	names := make([]string, 0, len(globals))
+	for k := range globals {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+	b = binary.AppendUvarint(b, uint64(len(names)))
+	for _, k := range names {
+		b = appendString(b, k)
+		b = binary.AppendUvarint(b, uint64(globals[k]))
+	}
+	b = binary.AppendUvarint(b, uint64(len(*script.Konstants)))
+	for _, v := range *script.Konstants {
+		b = appendKonstant(b, v)
+	}
+	return appendFunction(b, script.MainFunction.CoreFn)
+}
+
+func appendKonstant(b []byte, v Value) []byte {
+	switch k := v.(type) {
+	case Bool:
+		b = append(b, kBool)
+		return appendBool(b, bool(k))
+	case Integer:
+		b = append(b, kInteger)
+		return binary.AppendVarint(b, int64(k))
+	case Float:
+		b = append(b, kFloat)
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(float64(k)))
+	case *String:
+		b = append(b, kString)
+		return appendString(b, k.Value)
+	case Enum:
+		b = append(b, kEnum)
+		names := make([]string, 0, len(k))
+		for name := range k {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		b = binary.AppendUvarint(b, uint64(len(names)))
+		for _, name := range names {
+			b = appendString(b, name)
+			b = binary.AppendVarint(b, int64(k[name]))
+		}
+		return b
+	case *CoreFunction:
+		b = append(b, kFunction)
+		return appendFunction(b, k)
+	default:
+		return append(b, kNil)
+	}
+}
+
+func appendFunction(b []byte, fn *CoreFunction) []byte {
+	b = appendString(b, fn.ScriptName)
+	b = binary.AppendUvarint(b, uint64(fn.Arity))
+	b = appendBool(b, fn.IsVar)
+	b = binary.AppendUvarint(b, uint64(fn.Free))
+	b = binary.AppendUvarint(b, uint64(len(fn.Info)))
+	for _, v := range fn.Info {
+		b = binary.AppendUvarint(b, uint64(v.Index))
+		b = appendBool(b, bool(v.IsLocal))
+		b = appendString(b, v.Id)
+	}
+	b = binary.AppendUvarint(b, uint64(len(fn.Code)))
+	for _, v := range fn.Code {
+		b = binary.LittleEndian.AppendUint64(b, v)
+	}
+	var ips []int
+	for ip, span := range fn.spans {
+		if span != (token.Span{}) && ip <= len(fn.Code) {
+			ips = append(ips, ip)
+		}
+	}
+	b = binary.AppendUvarint(b, uint64(len(ips)))
+	for _, ip := range ips {
+		b = binary.AppendUvarint(b, uint64(ip))
+		b = appendPos(b, fn.spans[ip].Start)
+		b = appendPos(b, fn.spans[ip].End)
+	}
+	return b
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendPos(b []byte, pos token.Pos) []byte {
+	b = binary.AppendUvarint(b, uint64(pos.Offset))
+	b = binary.AppendUvarint(b, uint64(pos.Line))
+	return binary.AppendUvarint(b, uint64(pos.Column))
+}
+
+func appendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 1)
+	}
+	return append(b, 0)
+}
+
+type bytecodeReader struct {
+	data []byte
+	err  error
+}
+
+func decodeScript(data []byte, path string) (*Script, map[string]int, error) {
+	if !isBytecode(data) {
+		return nil, nil, verror.New(path, errMalformedBytecode.Error(), verror.FileErrType, 0)
+	}
+	if version := binary.BigEndian.Uint64(data) >> 16 & 0xFFFF; version != major<<8|minor {
+		return nil, nil, verror.New(path, "script compiled with an incompatible interpreter version", verror.FileErrType, 0)
+	}
+	r := &bytecodeReader{data: data[8:]}
+	size := r.uvarint()
+	if size > len(data)*len(coreLibNames) {
+		r.err = errMalformedBytecode
+	}
+	count := r.uvarint()
+	store := new([]Value)
+	for ; count > 0 && r.err == nil; count-- {
+		offset := r.uvarint()
+		if offset < len(*store) || offset+len(coreLibNames) > size {
+			r.err = errMalformedBytecode
+			break
+		}
+		for len(*store) < offset {
+			*store = append(*store, NilValue)
+		}
+		loadCoreLib(store)
+	}
+	for len(*store) < size && r.err == nil {
+		*store = append(*store, NilValue)
+	}
+	globals := make(map[string]int)
+	for count = r.uvarint(); count > 0 && r.err == nil; count-- {
+		name := r.string()
+		if idx := r.uvarint(); idx < size {
+			globals[name] = idx
+		} else {
+			r.err = errMalformedBytecode
+		}
+	}
+	konstants := new([]Value)
+	for count = r.uvarint(); count > 0 && r.err == nil; count-- {
+		*konstants = append(*konstants, r.konstant())
+	}
+	main := r.function()
+	if r.err == nil && (len(r.data) != 0 || len(main.Code) < 2 || main.Code[0] != binary.BigEndian.Uint64(data)) {
+		r.err = errMalformedBytecode
+	}
+	if r.err != nil {
+		return nil, nil, verror.New(path, r.err.Error(), verror.VerificationErrType, 0)
+	}
+	script := &Script{
+		Store:        store,
+		Konstants:    konstants,
+		MainFunction: &Function{CoreFn: main},
+	}
+	if err := verifyScript(script); err != nil {
+		return nil, nil, err
+	}
+	return script, globals, nil
+}
+
+func (r *bytecodeReader) konstant() Value {
+	switch r.byte() {
+	case kNil:
+		return NilValue
+	case kBool:
+		return Bool(r.bool())
+	case kInteger:
+		return Integer(r.varint())
+	case kFloat:
+		return Float(math.Float64frombits(r.uint64()))
+	case kString:
+		return &String{Value: r.string()}
+	case kEnum:
+		e := make(Enum)
+		for count := r.uvarint(); count > 0 && r.err == nil; count-- {
+			name := r.string()
+			e[name] = Integer(r.varint())
+		}
+		return e
+	case kFunction:
+		return r.function()
+	default:
+		r.err = errMalformedBytecode
+		return NilValue
+	}
+}
+
+func (r *bytecodeReader) function() *CoreFunction {
+	fn := &CoreFunction{}
+	fn.ScriptName = r.string()
+	fn.Arity = r.uvarint()
+	fn.IsVar = r.bool()
+	fn.Free = r.uvarint()
+	for count := r.uvarint(); count > 0 && r.err == nil; count-- {
+		var info freeInfo
+		info.Index = r.uvarint()
+		info.IsLocal = Bool(r.bool())
+		info.Id = r.string()
+		fn.Info = append(fn.Info, info)
+	}
+	count := r.uvarint()
+	if count > len(r.data)/8 {
+		r.err = errMalformedBytecode
+		return fn
+	}
+	fn.Code = make([]uint64, count)
+	for i := range fn.Code {
+		fn.Code[i] = r.uint64()
+	}
+	last := -1
+	for count = r.uvarint(); count > 0 && r.err == nil; count-- {
+		ip := r.uvarint()
+		if ip <= last || ip > len(fn.Code) {
+			r.err = errMalformedBytecode
+			break
+		}
+		if fn.spans == nil {
+			fn.spans = make([]token.Span, len(fn.Code)+1)
+		}
+		fn.spans[ip] = token.Span{Start: r.pos(), End: r.pos()}
+		last = ip
+	}
+	return fn
+}
+
+func (r *bytecodeReader) uvarint() int {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 || v > math.MaxInt32 {
+		r.err = errMalformedBytecode
+		return 0
+	}
+	r.data = r.data[n:]
+	return int(v)
+}
+
+func (r *bytecodeReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.err = errMalformedBytecode
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *bytecodeReader) uint64() uint64 {
+	if r.err != nil || len(r.data) < 8 {
+		r.err = errMalformedBytecode
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(r.data)
+	r.data = r.data[8:]
+	return v
+}
+
+func (r *bytecodeReader) byte() byte {
+	if r.err != nil || len(r.data) < 1 {
+		r.err = errMalformedBytecode
+		return 0
+	}
+	v := r.data[0]
+	r.data = r.data[1:]
+	return v
+}
+
+func (r *bytecodeReader) bool() bool {
+	switch r.byte() {
+	case 0:
+		return false
+	case 1:
+		return true
+	default:
+		r.err = errMalformedBytecode
+		return false
+	}
+}
+
+func (r *bytecodeReader) pos() token.Pos {
+	return token.Pos{Offset: r.uvarint(), Line: uint(r.uvarint()), Column: uint(r.uvarint())}
+}
+
+func (r *bytecodeReader) string() string {
+	n := r.uvarint()
+	if r.err != nil || n > len(r.data) {
+		r.err = errMalformedBytecode
+		return ""
+	}
+	s := string(r.data[:n])
+	r.data = r.data[n:]
+	return s
+}
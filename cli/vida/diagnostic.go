@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/alkemist-17/vida/verror"
+)
+
+const jsonFlag = "--json"
+
+// Exit codes of the CLI, one for every kind of error a script can stop with.
+const (
+	exitOK = iota
+	exitFailure
+	exitUsage
+	exitFile
+	exitLexical
+	exitSyntax
+	exitCompilation
+	exitRuntime
+	exitAssertion
+	exitException
+	exitLimit
+	exitVerification
+)
+
+var errorKinds = map[string]struct {
+	name string
+	code int
+}{
+	verror.FileErrType:         {"file", exitFile},
+	verror.LexicalErrType:      {"lexical", exitLexical},
+	verror.SyntaxErrType:       {"syntax", exitSyntax},
+	verror.CompilationErrType:  {"compilation", exitCompilation},
+	verror.RunTimeErrType:      {"runtime", exitRuntime},
+	verror.AssertionErrType:    {"assertion", exitAssertion},
+	verror.ExceptionErrType:    {"exception", exitException},
+	verror.VerificationErrType: {"verification", exitVerification},
+}
+
+// jsonDiagnostics is set by the --json flag.
+var jsonDiagnostics bool
+
+// parseFlags removes the flags every command accepts, which may come before or
+// after the command. Arguments after -- belong to the script and are left
+// untouched, and so are the ones after the script of a command that passes
+// them on to it.
+func parseFlags(args []string) []string {
+	parsed := make([]string, 0, len(args))
+	for k, arg := range args {
+		if arg == argsSeparator {
+			return append(parsed, args[k:]...)
+		}
+		if k > 0 && arg == jsonFlag {
+			jsonDiagnostics = true
+			continue
+		}
+		parsed = append(parsed, arg)
+		if len(parsed) > 2 && passesArgs(parsed[1]) {
+			return append(parsed, args[k+1:]...)
+		}
+	}
+	return parsed
+}
+
+// passesArgs reports whether cmd gives the arguments after its script to the script.
+func passesArgs(cmd string) bool {
+	switch parseCMD(cmd) {
+	case RUN, EVAL:
+		return true
+	}
+	return false
+}
+
+// usageError reports a command line that the CLI cannot make sense of.
+type usageError struct {
+	message string
+}
+
+func (e usageError) Error() string {
+	return e.message
+}
+
+func usageErrorf(format string, args ...any) error {
+	return usageError{message: fmt.Sprintf(format, args...)}
+}
+
+type diagnosticFrame struct {
+	Script string `json:"script"`
+	Line   uint   `json:"line"`
+}
+
+// diagnostic is an error as printed by the --json flag.
+// Columns count bytes from 1, as the lexer does.
+type diagnostic struct {
+	Kind      string            `json:"kind"`
+	Script    string            `json:"script,omitempty"`
+	Line      uint              `json:"line,omitempty"`
+	Column    uint              `json:"column,omitempty"`
+	EndLine   uint              `json:"endLine,omitempty"`
+	EndColumn uint              `json:"endColumn,omitempty"`
+	Message   string            `json:"message"`
+	CallStack []diagnosticFrame `json:"callStack,omitempty"`
+}
+
+func newDiagnostic(err error, stack []verror.StackFrameInfo) diagnostic {
+	d := diagnostic{Kind: "error", Message: err.Error()}
+	var vErr verror.VidaError
+	var lErr verror.LimitError
+	var uErr usageError
+	switch {
+	case errors.As(err, &vErr):
+		d.Script, d.Line, d.Message = vErr.ScriptName, vErr.Line, vErr.Message
+		if vErr.Span.IsValid() && vErr.Span.Start.Line == vErr.Line {
+			d.Column = vErr.Span.Start.Column
+			d.EndLine, d.EndColumn = vErr.Span.End.Line, vErr.Span.End.Column
+		}
+		if kind, ok := errorKinds[vErr.ErrType]; ok {
+			d.Kind = kind.name
+		}
+	case errors.As(err, &lErr):
+		d.Kind, d.Script, d.Line, d.Message = "limit", lErr.ScriptName, lErr.Line, lErr.Err.Error()
+	case errors.As(err, &uErr):
+		d.Kind = "usage"
+	}
+	for _, f := range stack {
+		d.CallStack = append(d.CallStack, diagnosticFrame{Script: f.ScriptName, Line: f.Line})
+	}
+	return d
+}
+
+func exitCode(err error) int {
+	var vErr verror.VidaError
+	var lErr verror.LimitError
+	var uErr usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &vErr):
+		if kind, ok := errorKinds[vErr.ErrType]; ok {
+			return kind.code
+		}
+	case errors.As(err, &lErr):
+		return exitLimit
+	case errors.As(err, &uErr):
+		return exitUsage
+	}
+	return exitFailure
+}
+
+// sources holds the scripts the CLI was given as text rather than as a file,
+// so that their errors can quote them too.
+var sources = map[string][]byte{}
+
+// withExcerpt adds to err the source line it points at, when the script
+// that raised it can still be read.
+func withExcerpt(err error) error {
+	if list, ok := err.(verror.ErrorList); ok {
+		quoted := make(verror.ErrorList, len(list))
+		for k, e := range list {
+			quoted[k] = withExcerpt(e).(verror.VidaError)
+		}
+		return quoted
+	}
+	vErr, ok := err.(verror.VidaError)
+	if !ok || !vErr.Span.IsValid() || vErr.Excerpt != "" {
+		return err
+	}
+	src, ok := sources[vErr.ScriptName]
+	if !ok {
+		var readErr error
+		if src, readErr = os.ReadFile(vErr.ScriptName); readErr != nil {
+			return err
+		}
+	}
+	return vErr.WithSource(src)
+}
+
+// reportError prints err and the call stack of the script that raised it,
+// as decorated text or, with the --json flag, as a JSON object on the standard error.
+// A list of errors is printed one error after the other, or one object per line.
+func reportError(err error, stack []verror.StackFrameInfo) {
+	err = withExcerpt(err)
+	if jsonDiagnostics {
+		enc := json.NewEncoder(os.Stderr)
+		enc.SetEscapeHTML(false)
+		if list, ok := err.(verror.ErrorList); ok {
+			for _, e := range list {
+				enc.Encode(newDiagnostic(e, nil))
+			}
+			return
+		}
+		enc.Encode(newDiagnostic(err, stack))
+		return
+	}
+	fmt.Printf("\n\n%v\n\n\n", err)
+	if len(stack) > 0 {
+		fmt.Printf("  [Call Stack]\n\n")
+		for _, f := range stack {
+			fmt.Printf("%v\n", f)
+		}
+	}
+}
+
+// fail reports err and leaves with the exit code of its kind.
+func fail(err error, stack []verror.StackFrameInfo) {
+	reportError(err, stack)
+	os.Exit(exitCode(err))
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseFlagsJSONAnywhere(t *testing.T) {
+	cases := []struct {
+		args   []string
+		parsed []string
+		json   bool
+	}{
+		{[]string{"vida", "--json", "ast", "a.vida"}, []string{"vida", "ast", "a.vida"}, true},
+		{[]string{"vida", "ast", "--json", "a.vida"}, []string{"vida", "ast", "a.vida"}, true},
+		{[]string{"vida", "ast", "a.vida", "--json"}, []string{"vida", "ast", "a.vida"}, true},
+		{[]string{"vida", "--json", "run", "a.vida", "x"}, []string{"vida", "run", "a.vida", "x"}, true},
+		{[]string{"vida", "run", "a.vida", "--json"}, []string{"vida", "run", "a.vida", "--json"}, false},
+		{[]string{"vida", "ast", "--", "--json"}, []string{"vida", "ast", "--", "--json"}, false},
+	}
+	for _, c := range cases {
+		jsonDiagnostics = false
+		parsed := parseFlags(c.args)
+		if !slices.Equal(parsed, c.parsed) || jsonDiagnostics != c.json {
+			t.Errorf("parseFlags(%q) = %q with json %v, want %q with json %v", c.args, parsed, jsonDiagnostics, c.parsed, c.json)
+		}
+	}
+	jsonDiagnostics = false
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alkemist-17/vida"
+)
+
+const writeFlag = "-w"
+
+// format prints every script given in args as canonical source, or rewrites
+// it in place with -w. Directories stand for the scripts found inside them.
+func format(args []string) {
+	write := false
+	var paths []string
+	for _, arg := range args[2:] {
+		if arg == writeFlag {
+			write = true
+		} else {
+			paths = append(paths, arg)
+		}
+	}
+	if len(paths) == 0 {
+		printVersion()
+		handleError(errorNoArgsGivenTo(FMT))
+	}
+	files, err := findScripts(paths)
+	handleError(err)
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		handleError(err)
+		out, err := vida.Format(src, file)
+		handleError(err)
+		if !write {
+			os.Stdout.Write(out)
+			continue
+		}
+		if !bytes.Equal(src, out) {
+			info, err := os.Stat(file)
+			handleError(err)
+			handleError(os.WriteFile(file, out, info.Mode().Perm()))
+			fmt.Println(file)
+		}
+	}
+}
+
+func findScripts(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(p, ".vida") {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
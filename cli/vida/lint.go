@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/alkemist-17/vida"
+)
+
+// lintWarning is a warning as printed by the --json flag.
+type lintWarning struct {
+	Rule    string `json:"rule"`
+	Script  string `json:"script"`
+	Line    uint   `json:"line"`
+	Message string `json:"message"`
+}
+
+// lint prints the warnings found in every script given in args, or under
+// the current directory, and exits with status 1 when there is any.
+func lint(args []string) {
+	paths := args[2:]
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := findScripts(paths)
+	handleError(err)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	count := 0
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		handleError(err)
+		warnings, err := vida.Lint(src, file)
+		handleError(err)
+		for _, w := range warnings {
+			if jsonDiagnostics {
+				enc.Encode(lintWarning{Rule: w.Rule, Script: w.Script, Line: w.Line, Message: w.Message})
+			} else {
+				fmt.Println(w)
+			}
+		}
+		count += len(warnings)
+	}
+	if count > 0 {
+		os.Exit(exitFailure)
+	}
+}
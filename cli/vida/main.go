@@ -1,12 +1,16 @@
 package main
 
 import (
-	"errors"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/alkemist-17/vida"
+	"github.com/alkemist-17/vida/ast"
 	"github.com/alkemist-17/vida/extension"
 )
 
@@ -21,15 +25,32 @@ const (
 	ABOUT   = "about"
 	CODE    = "code"
 	CORELIB = "corelib"
+	BUILD   = "build"
+	REPL    = "repl"
+	DAP     = "dap"
+	PROFILE = "profile"
+	COVER   = "cover"
+	TEST    = "test"
+	EVAL    = "-e"
+	FMT     = "fmt"
+	LINT    = "lint"
+	LSP     = "lsp"
 	UNKNOWN = "unknown"
 )
 
+const bytecodeExtension = ".vbc"
+
+const (
+	argsSeparator    = "--"
+	stdinScript      = "-"
+	stdinScriptName  = "<stdin>"
+	inlineScriptName = "<inline>"
+)
+
+const profileEntries = 20
+
 func main() {
-	// f, err := os.Create("vida.prof")
-	// handleError(err)
-	// pprof.StartCPUProfile(f)
-	// defer pprof.StopCPUProfile()
-	args := os.Args
+	args := parseFlags(os.Args)
 	if len(args) > 1 {
 		switch parseCMD(args[1]) {
 		case RUN:
@@ -52,10 +73,30 @@ func main() {
 			printMachineCode(args)
 		case CORELIB:
 			printCoreLib()
+		case BUILD:
+			build(args)
+		case REPL:
+			repl()
+		case DAP:
+			handleError(vida.ServeDAP(os.Stdin, os.Stdout, extension.LoadExtensions()))
+		case PROFILE:
+			profile(args)
+		case COVER:
+			cover(args)
+		case TEST:
+			runTests(args)
+		case EVAL:
+			eval(args)
+		case FMT:
+			format(args)
+		case LINT:
+			lint(args)
+		case LSP:
+			handleError(vida.ServeLSP(os.Stdin, os.Stdout, extension.LoadExtensions()))
 		default:
 			clear()
 			printVersion()
-			handleError(errors.New("unknown command\ntype in your cli 'vida help' for assistance"))
+			handleError(usageErrorf("unknown command\ntype in your cli 'vida help' for assistance"))
 		}
 	} else {
 		printHelp()
@@ -70,7 +111,9 @@ func debug(args []string) {
 		i, err := vida.NewDebugger(args[2], extensions)
 		handleError(err)
 		r, err := i.Debug()
-		handleError(err)
+		if err != nil {
+			fail(err, i.CallStack())
+		}
 		fmt.Println(r)
 	} else {
 		printVersion()
@@ -81,19 +124,47 @@ func debug(args []string) {
 func run(args []string) {
 	extensions := extension.LoadExtensions()
 	if len(args) > 2 {
-		i, err := vida.NewInterpreter(args[2], extensions)
-		handleError(err)
-		_, err = i.Run()
-		if err != nil {
-			printError(err)
-			i.PrintCallStack()
+		var i *vida.Interpreter
+		var err error
+		if args[2] == stdinScript {
+			src, readErr := io.ReadAll(os.Stdin)
+			handleError(readErr)
+			sources[stdinScriptName] = src
+			i, err = vida.NewInterpreterFromSource(stdinScriptName, src, extensions)
+		} else {
+			i, err = vida.NewInterpreter(args[2], extensions)
 		}
+		handleError(err)
+		runScript(i, args[3:])
 	} else {
 		printVersion()
 		handleError(errorNoArgsGivenTo(RUN))
 	}
 }
 
+func eval(args []string) {
+	if len(args) < 3 {
+		printVersion()
+		handleError(usageErrorf("no source given to the option %v", EVAL))
+	}
+	sources[inlineScriptName] = []byte(args[2])
+	i, err := vida.NewInterpreterFromSource(inlineScriptName, sources[inlineScriptName], extension.LoadExtensions())
+	handleError(err)
+	runScript(i, args[3:])
+}
+
+// runScript runs a script with the arguments that follow it on the command line,
+// which may be separated from the ones of the CLI by --.
+func runScript(i *vida.Interpreter, args []string) {
+	if len(args) > 0 && args[0] == argsSeparator {
+		args = args[1:]
+	}
+	i.SetArgs(args)
+	if _, err := i.Run(); err != nil {
+		fail(err, i.CallStack())
+	}
+}
+
 func time(args []string) {
 	clear()
 	printVersion()
@@ -103,8 +174,7 @@ func time(args []string) {
 		handleError(err)
 		r, err := i.MeasureRunTime()
 		if err != nil {
-			printError(err)
-			i.PrintCallStack()
+			fail(err, i.CallStack())
 		}
 		fmt.Println(r)
 	} else {
@@ -113,7 +183,126 @@ func time(args []string) {
 	}
 }
 
+func build(args []string) {
+	if len(args) > 2 {
+		output := strings.TrimSuffix(args[2], filepath.Ext(args[2])) + bytecodeExtension
+		if len(args) > 4 && args[3] == "-o" {
+			output = args[4]
+		} else if len(args) > 3 {
+			printVersion()
+			handleError(usageErrorf("unexpected argument %v\nusage: vida build script.vida [-o script%v]", args[3], bytecodeExtension))
+		}
+		data, err := vida.Build(args[2])
+		handleError(err)
+		handleError(os.WriteFile(output, data, 0644))
+	} else {
+		printVersion()
+		handleError(errorNoArgsGivenTo(BUILD))
+	}
+}
+
+func profile(args []string) {
+	if len(args) < 3 {
+		printVersion()
+		handleError(errorNoArgsGivenTo(PROFILE))
+	}
+	usage := "usage: vida profile script.vida [-n entries] [-o profile.pprof]"
+	entries, output := profileEntries, ""
+	for k := 3; k < len(args); k += 2 {
+		if k+1 >= len(args) {
+			printVersion()
+			handleError(usageErrorf("missing value for %v\n%v", args[k], usage))
+		}
+		switch args[k] {
+		case "-n":
+			n, err := strconv.Atoi(args[k+1])
+			if err != nil {
+				printVersion()
+				handleError(usageErrorf("invalid number of entries %v\n%v", args[k+1], usage))
+			}
+			entries = n
+		case "-o":
+			output = args[k+1]
+		default:
+			printVersion()
+			handleError(usageErrorf("unexpected argument %v\n%v", args[k], usage))
+		}
+	}
+	i, err := vida.NewProfiler(args[2], extension.LoadExtensions())
+	handleError(err)
+	p, runErr := i.Profile()
+	if runErr != nil {
+		reportError(runErr, i.CallStack())
+	}
+	fmt.Println()
+	p.WriteReport(os.Stdout, entries)
+	if output != "" {
+		handleError(writeFile(output, p.WritePprof))
+	}
+	os.Exit(exitCode(runErr))
+}
+
+func cover(args []string) {
+	if len(args) < 3 {
+		printVersion()
+		handleError(errorNoArgsGivenTo(COVER))
+	}
+	usage := "usage: vida cover script.vida [-html coverage.html] [-lcov coverage.info]"
+	htmlOutput, lcovOutput := "", ""
+	for k := 3; k < len(args); k += 2 {
+		if k+1 >= len(args) {
+			printVersion()
+			handleError(usageErrorf("missing value for %v\n%v", args[k], usage))
+		}
+		switch args[k] {
+		case "-html":
+			htmlOutput = args[k+1]
+		case "-lcov":
+			lcovOutput = args[k+1]
+		default:
+			printVersion()
+			handleError(usageErrorf("unexpected argument %v\n%v", args[k], usage))
+		}
+	}
+	i, err := vida.NewProfiler(args[2], extension.LoadExtensions())
+	handleError(err)
+	p, runErr := i.Profile()
+	if runErr != nil {
+		reportError(runErr, i.CallStack())
+	}
+	c := p.Coverage()
+	fmt.Println()
+	c.WriteSummary(os.Stdout)
+	if htmlOutput != "" {
+		handleError(writeFile(htmlOutput, c.WriteHTML))
+	}
+	if lcovOutput != "" {
+		handleError(writeFile(lcovOutput, c.WriteLCOV))
+	}
+	os.Exit(exitCode(runErr))
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 func printTokens(args []string) {
+	if jsonDiagnostics && len(args) > 2 {
+		for _, path := range args[2:] {
+			tokens, err := vida.Tokens(path)
+			handleError(err)
+			printJSON(tokens)
+		}
+		return
+	}
 	clear()
 	printVersion()
 	largs := len(args)
@@ -129,6 +318,14 @@ func printTokens(args []string) {
 }
 
 func printAST(args []string) {
+	if jsonDiagnostics && len(args) > 2 {
+		for _, path := range args[2:] {
+			tree, err := vida.SyntaxTree(path)
+			handleError(err)
+			printJSON(ast.Describe(tree))
+		}
+		return
+	}
 	clear()
 	printVersion()
 	largs := len(args)
@@ -144,6 +341,14 @@ func printAST(args []string) {
 }
 
 func printMachineCode(args []string) {
+	if jsonDiagnostics && len(args) > 2 {
+		for _, path := range args[2:] {
+			code, err := vida.MachineCode(path)
+			handleError(err)
+			printJSON(code)
+		}
+		return
+	}
 	clear()
 	printVersion()
 	largs := len(args)
@@ -158,10 +363,17 @@ func printMachineCode(args []string) {
 	}
 }
 
+// printJSON writes v on a line of the standard output, so that the output
+// for several scripts is one JSON value per line.
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	handleError(enc.Encode(v))
+}
+
 func handleError(err error) {
 	if err != nil {
-		fmt.Printf("\n\n%v\n\n\n", err)
-		os.Exit(0)
+		fail(err, nil)
 	}
 }
 
@@ -174,7 +386,7 @@ func printError(err error) {
 func parseCMD(cmd string) string {
 	cmd = strings.ToLower(cmd)
 	switch cmd {
-	case RUN, DEGUG, TOKENS, AST, HELP, VERSION, ABOUT, CODE, TIME, CORELIB:
+	case RUN, EVAL, DEGUG, TOKENS, AST, HELP, VERSION, ABOUT, CODE, TIME, CORELIB, BUILD, REPL, DAP, PROFILE, COVER, TEST, FMT, LINT, LSP:
 		return cmd
 	default:
 		return UNKNOWN
@@ -182,7 +394,7 @@ func parseCMD(cmd string) string {
 }
 
 func errorNoArgsGivenTo(cmd string) error {
-	return fmt.Errorf("no arguments given to the option %v", cmd)
+	return usageErrorf("no arguments given to the option %v", cmd)
 }
 
 func printVersion() {
@@ -198,9 +410,21 @@ func printHelp() {
 	fmt.Println()
 	fmt.Println("Command list")
 	fmt.Println()
-	fmt.Printf("%-11v compile and run Vida script\n", RUN)
-	fmt.Printf("%-11v compile and run Vida scripts step by step\n", DEGUG)
+	fmt.Printf("%-11v compile and run Vida script, or run a compiled one\n", RUN)
+	fmt.Printf("%-11v read the script from the standard input when its name is %v\n", "", stdinScript)
+	fmt.Printf("%-11v pass the arguments after the script, or after %v, to std/os.args\n", "", argsSeparator)
+	fmt.Printf("%-11v compile and run the Vida source given as the next argument\n", EVAL)
+	fmt.Printf("%-11v run the cases of every *_test.vida script in a directory\n", TEST)
+	fmt.Printf("%-11v print Vida scripts as canonical source, or rewrite them with %v\n", FMT, writeFlag)
+	fmt.Printf("%-11v warn about unused, shadowed and unreachable code, or ignore it with lint:ignore\n", LINT)
+	fmt.Printf("%-11v compile a Vida script to a bytecode file, optionally named with -o\n", BUILD)
+	fmt.Printf("%-11v run a Vida script line by line with breakpoints\n", DEGUG)
+	fmt.Printf("%-11v start an interactive session\n", REPL)
+	fmt.Printf("%-11v serve the Debug Adapter Protocol on the standard streams\n", DAP)
+	fmt.Printf("%-11v serve the Language Server Protocol on the standard streams\n", LSP)
 	fmt.Printf("%-11v compile and run Vida scripts measuring their runtime\n", TIME)
+	fmt.Printf("%-11v run a Vida script and report where it spends its statements\n", PROFILE)
+	fmt.Printf("%-11v run a Vida script and report the lines it executed, as text, HTML or LCOV\n", COVER)
 	fmt.Printf("%-11v show the token list\n", TOKENS)
 	fmt.Printf("%-11v show the syntax tree\n", AST)
 	fmt.Printf("%-11v show this message\n", HELP)
@@ -209,6 +433,13 @@ func printHelp() {
 	fmt.Printf("%-11v show information about the Vida corelib\n", CORELIB)
 	fmt.Printf("%-11v show some information about Vida\n", ABOUT)
 	fmt.Println()
+	fmt.Printf("%-11v print errors as JSON objects on the standard error, and the output\n", jsonFlag)
+	fmt.Printf("%-11v of %v, %v and %v as JSON on the standard output\n", "", TOKENS, AST, CODE)
+	fmt.Println()
+	fmt.Println("The exit status is 0 on success, 2 for usage errors, and 3 to 11 for file,")
+	fmt.Println("lexical, syntax, compilation, runtime, assertion, exception, limit and")
+	fmt.Println("verification errors, in that order. Any other failure exits with 1.")
+	fmt.Println()
 }
 
 func printAbout() {
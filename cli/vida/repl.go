@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alkemist-17/vida"
+	"github.com/alkemist-17/vida/extension"
+	"github.com/alkemist-17/vida/verror"
+)
+
+const (
+	replPrompt       = "vida> "
+	replContinue     = "...   "
+	replHistoryFile  = ".vida_history"
+	replHistorySize  = 1000
+	replQuitCommand  = ":quit"
+	replHistoryCmd   = ":history"
+	replHelpCommand  = ":help"
+	replClearCommand = ":clear"
+)
+
+func repl() {
+	r, err := vida.NewRepl(extension.LoadExtensions())
+	handleError(err)
+	printVersion()
+	fmt.Printf("Type %v for help, %v or Ctrl-D to leave.\n\n", replHelpCommand, replQuitCommand)
+	history := loadHistory()
+	scanner := bufio.NewScanner(os.Stdin)
+	var entry strings.Builder
+	prompt := replPrompt
+	for {
+		fmt.Print(prompt)
+		if !scanner.Scan() {
+			fmt.Println()
+			return
+		}
+		line := scanner.Text()
+		if entry.Len() == 0 {
+			switch strings.TrimSpace(line) {
+			case "":
+				continue
+			case replQuitCommand:
+				return
+			case replHistoryCmd:
+				for i, v := range history {
+					fmt.Printf("%5v  %v\n", i+1, v)
+				}
+				continue
+			case replHelpCommand:
+				printReplHelp()
+				continue
+			case replClearCommand:
+				clear()
+				continue
+			}
+			if n, ok := historyNumber(line); ok {
+				if n > len(history) {
+					fmt.Printf("There is no entry %v in the history.\n", n)
+					continue
+				}
+				src := history[n-1]
+				fmt.Println(src)
+				history = saveHistory(history, src)
+				evalEntry(r, src+"\n")
+				continue
+			}
+		}
+		entry.WriteString(line)
+		entry.WriteByte('\n')
+		src := entry.String()
+		if r.Incomplete(src) {
+			prompt = replContinue
+			continue
+		}
+		entry.Reset()
+		prompt = replPrompt
+		history = saveHistory(history, strings.TrimSuffix(src, "\n"))
+		evalEntry(r, src)
+	}
+}
+
+// evalEntry runs a complete entry and prints the value of an expression.
+func evalEntry(r *vida.Repl, src string) {
+	val, isExpr, err := r.Eval(src)
+	if err != nil {
+		printError(entryError(err, src))
+		return
+	}
+	if isExpr && val != vida.NilValue {
+		fmt.Println(val)
+	}
+}
+
+// historyNumber reports whether line is a command like :12 that runs
+// again the entry with that number in the history.
+func historyNumber(line string) (int, bool) {
+	digits, ok := strings.CutPrefix(strings.TrimSpace(line), ":")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(digits)
+	return n, err == nil && n > 0
+}
+
+func printReplHelp() {
+	fmt.Println()
+	fmt.Println("Enter statements or expressions. The value of an expression is printed.")
+	fmt.Println("Entries with unclosed braces, brackets or parentheses continue on the next line.")
+	fmt.Println()
+	fmt.Printf("%-11v show the entries of this and previous sessions\n", replHistoryCmd)
+	fmt.Printf("%-11v run again the entry numbered N in the history\n", ":N")
+	fmt.Printf("%-11v clear the screen\n", replClearCommand)
+	fmt.Printf("%-11v leave the session\n", replQuitCommand)
+	fmt.Println()
+}
+
+func historyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, replHistoryFile)
+}
+
+func loadHistory() []string {
+	path := historyPath()
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var history []string
+	for _, v := range strings.Split(string(data), "\x00") {
+		if strings.TrimSpace(v) != "" {
+			history = append(history, v)
+		}
+	}
+	if len(history) > replHistorySize {
+		history = history[len(history)-replHistorySize:]
+	}
+	return history
+}
+
+func saveHistory(history []string, entry string) []string {
+	history = append(history, entry)
+	if path := historyPath(); path != "" {
+		if f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err == nil {
+			f.WriteString(entry + "\x00")
+			f.Close()
+		}
+	}
+	return history
+}
+
+// entryError quotes the entry in the errors found before it ran. Errors
+// raised while running may come from the code of earlier entries.
+func entryError(err error, src string) error {
+	if list, ok := err.(verror.ErrorList); ok {
+		quoted := make(verror.ErrorList, len(list))
+		for k, e := range list {
+			quoted[k] = entryError(e, src).(verror.VidaError)
+		}
+		return quoted
+	}
+	if vErr, ok := err.(verror.VidaError); ok {
+		switch vErr.ErrType {
+		case verror.LexicalErrType, verror.SyntaxErrType, verror.CompilationErrType:
+			return vErr.WithSource([]byte(src))
+		}
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	gotime "time"
+
+	"github.com/alkemist-17/vida"
+	"github.com/alkemist-17/vida/extension"
+)
+
+// runTests runs every test script under the directory given in args,
+// or under the current one, and exits with status 1 when anything fails.
+func runTests(args []string) {
+	root := "."
+	if len(args) > 2 {
+		root = args[2]
+	}
+	files, err := findTests(root)
+	handleError(err)
+	if len(files) == 0 {
+		fmt.Printf("no %v files found in %v\n", vida.TestSuffix, root)
+		return
+	}
+	wd, err := os.Getwd()
+	handleError(err)
+	extensions := extension.LoadExtensions()
+	passed, failed := 0, 0
+	init := gotime.Now()
+	for _, file := range files {
+		p, f := runTestFile(wd, file, extensions)
+		passed += p
+		failed += f
+	}
+	fmt.Printf("\n%v passed, %v failed, %v scripts (%v)\n", passed, failed, len(files), gotime.Since(init))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// runTestFile runs a test script, whose imports vida.RunTests resolves
+// from the directory of the script. It is named relative to wd.
+func runTestFile(wd, file string, extensions map[string]func() vida.Value) (passed, failed int) {
+	name, err := filepath.Rel(wd, file)
+	if err != nil {
+		name = file
+	}
+	fmt.Printf("=== %v\n", name)
+	init := gotime.Now()
+	results, err := vida.RunTests(name, extensions)
+	if err != nil {
+		fmt.Printf("    FAIL  %v (%v)\n", name, gotime.Since(init))
+		printIndented(withExcerpt(err))
+		return 0, 1
+	}
+	for _, r := range results {
+		if r.Err == nil {
+			passed++
+			fmt.Printf("    ok    %v (%v)\n", r.Name, r.Duration)
+		} else {
+			failed++
+			fmt.Printf("    FAIL  %v (%v)\n", r.Name, r.Duration)
+			printIndented(withExcerpt(r.Err))
+		}
+	}
+	return passed, failed
+}
+
+func findTests(root string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(d.Name(), vida.TestSuffix) {
+			abs, err := filepath.Abs(path)
+			if err != nil {
+				return err
+			}
+			files = append(files, abs)
+		}
+		return nil
+	})
+	return files, err
+}
+
+func printIndented(err error) {
+	for _, line := range strings.Split(strings.Trim(err.Error(), "\n"), "\n") {
+		if line = strings.TrimRight(line, " \t\r"); line != "" {
+			fmt.Printf("        %v\n", line)
+		}
+	}
+}
@@ -1,10 +1,22 @@
 package vida
 
-func loadFoundationCoroutine() Value {
+import (
+	"errors"
+	"fmt"
+
+	"github.com/alkemist-17/vida/verror"
+)
+
+var errThreadYield = errors.New("cannot yield outside of a thread")
+
+func loadFoundationCoroutine(store *[]Value) Value {
 	m := &Object{Value: make(map[string]Value)}
-	m.Value["new"] = GFn(gfnNewThread)
+	m.Value["new"] = gfnNewThread(store)
 	m.Value["stack"] = getStackSizes()
 	m.Value["state"] = GFn(gfnGetThreadState)
+	m.Value["resume"] = GFn(gfnResumeThread)
+	m.Value["yield"] = GFn(gfnYieldThread)
+	m.Value["isDone"] = GFn(gfnIsThreadDone)
 	m.Value["ready"] = Integer(Ready)
 	m.Value["running"] = Integer(Running)
 	m.Value["suspended"] = Integer(Suspended)
@@ -14,20 +26,33 @@ func loadFoundationCoroutine() Value {
 	return m
 }
 
-func gfnNewThread(args ...Value) (Value, error) {
-	l := len(args)
-	if l == 1 {
-		if fn, ok := args[0].(*Function); ok {
-			return newThread(fn, ((*clbu)[mainThIndex].(*Thread)).Script, primeStack), nil
-		}
-	} else if l > 1 {
-		if fn, ok := args[0].(*Function); ok {
-			if s, ok := args[1].(Integer); ok && femtoStack <= s && s <= fullStack {
-				return newThread(fn, ((*clbu)[mainThIndex].(*Thread)).Script, int(s)), nil
+func gfnNewThread(store *[]Value) GFn {
+	return func(args ...Value) (Value, error) {
+		main := (*store)[mainThIndex].(*Thread)
+		l := len(args)
+		if l == 1 {
+			if fn, ok := args[0].(*Function); ok {
+				return newCheckedThread(fn, main, primeStack)
+			}
+		} else if l > 1 {
+			if fn, ok := args[0].(*Function); ok {
+				if s, ok := args[1].(Integer); ok && femtoStack <= s && s <= fullStack {
+					return newCheckedThread(fn, main, int(s))
+				}
 			}
 		}
+		return NilValue, nil
 	}
-	return NilValue, nil
+}
+
+// newCheckedThread returns a thread running fn on a stack of size registers,
+// rejecting fn before it ever runs when its registers do not fit that stack.
+func newCheckedThread(fn *Function, main *Thread, size int) (Value, error) {
+	if fn.CoreFn.registers > size {
+		message := fmt.Sprintf("the function needs %v registers, the thread stack holds %v", fn.CoreFn.registers, size)
+		return NilValue, verror.New("", message, verror.VerificationErrType, 0)
+	}
+	return newThread(fn, main, size), nil
 }
 
 func gfnGetThreadState(args ...Value) (Value, error) {
@@ -39,6 +64,28 @@ func gfnGetThreadState(args ...Value) (Value, error) {
 	return NilValue, nil
 }
 
+func gfnResumeThread(args ...Value) (Value, error) {
+	if len(args) > 0 {
+		if th, ok := args[0].(*Thread); ok {
+			return th.resume(args[1:])
+		}
+	}
+	return NilValue, nil
+}
+
+func gfnYieldThread(args ...Value) (Value, error) {
+	return packValues(args), errThreadYield
+}
+
+func gfnIsThreadDone(args ...Value) (Value, error) {
+	if len(args) > 0 {
+		if th, ok := args[0].(*Thread); ok {
+			return Bool(th.State == Closed), nil
+		}
+	}
+	return NilValue, nil
+}
+
 func getStackSizes() *Object {
 	m := &Object{Value: make(map[string]Value)}
 	m.Value["of1024"] = Integer(fullStack)
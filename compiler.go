@@ -1,6 +1,11 @@
 package vida
 
 import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
 	"github.com/alkemist-17/vida/ast"
 	"github.com/alkemist-17/vida/token"
 	"github.com/alkemist-17/vida/verror"
@@ -21,8 +26,7 @@ type compiler struct {
 	sb            *symbolBuilder
 	scriptMap     map[string]int
 	depMap        map[string]struct{}
-	errorInfo     ErrorInfo
-	lineErr       uint
+	spanErr       token.Span
 	scope         int
 	level         int
 	rAlloc        int
@@ -31,6 +35,10 @@ type compiler struct {
 	mutLoc        bool
 	hadError      bool
 	isSubcompiler bool
+	debug         bool
+	sandbox       *Sandbox
+	symbols       *symbolTable
+	dir           string
 }
 
 var dummy = struct{}{}
@@ -38,8 +46,6 @@ var dummy = struct{}{}
 func newMainCompiler(ast *ast.Ast, scriptName string) *compiler {
 	dm := make(map[string]struct{})
 	dm[scriptName] = dummy
-	ei := make(ErrorInfo)
-	ei[scriptName] = make(map[int]uint)
 	c := &compiler{
 		ast:       ast,
 		script:    newMainScript(scriptName),
@@ -47,15 +53,13 @@ func newMainCompiler(ast *ast.Ast, scriptName string) *compiler {
 		sb:        newSymbolBuilder(0),
 		scriptMap: make(map[string]int),
 		depMap:    dm,
-		errorInfo: ei,
 	}
 	c.fn = append(c.fn, c.script.MainFunction.CoreFn)
 	c.currentFn = c.script.MainFunction.CoreFn
 	return c
 }
 
-func newSubCompiler(ast *ast.Ast, scriptName string, kb *konstBuilder, store *[]Value, scriptMap map[string]int, depMap map[string]struct{}, ei ErrorInfo, initialIndex int) *compiler {
-	ei[scriptName] = make(map[int]uint)
+func newSubCompiler(ast *ast.Ast, scriptName string, kb *konstBuilder, store *[]Value, scriptMap map[string]int, depMap map[string]struct{}, initialIndex int) *compiler {
 	c := &compiler{
 		ast:           ast,
 		script:        newScript(scriptName, store),
@@ -64,7 +68,6 @@ func newSubCompiler(ast *ast.Ast, scriptName string, kb *konstBuilder, store *[]
 		isSubcompiler: true,
 		scriptMap:     scriptMap,
 		depMap:        depMap,
-		errorInfo:     ei,
 	}
 	c.fn = append(c.fn, c.script.MainFunction.CoreFn)
 	c.currentFn = c.script.MainFunction.CoreFn
@@ -77,11 +80,10 @@ func (c *compiler) compileScript() (*Script, error) {
 	for i = range len(c.ast.Statement) {
 		c.compileStmt(c.ast.Statement[i])
 		if c.hadError {
-			return nil, verror.New(c.script.MainFunction.CoreFn.ScriptName, c.errMsg, verror.CompilationErrType, c.lineErr)
+			return nil, verror.NewAt(c.script.MainFunction.CoreFn.ScriptName, c.errMsg, verror.CompilationErrType, c.spanErr)
 		}
 	}
 	c.script.Konstants = c.kb.Konstants
-	c.script.ErrorInfo = c.errorInfo
 	c.appendEnd()
 	return c.script, nil
 }
@@ -90,16 +92,24 @@ func (c *compiler) compileSubScript() (*Script, error) {
 	for i := range len(c.ast.Statement) {
 		c.compileStmt(c.ast.Statement[i])
 		if c.hadError {
-			return nil, verror.New(c.script.MainFunction.CoreFn.ScriptName, c.errMsg, verror.CompilationErrType, c.lineErr)
+			return nil, verror.NewAt(c.script.MainFunction.CoreFn.ScriptName, c.errMsg, verror.CompilationErrType, c.spanErr)
 		}
 	}
 	return c.script, nil
 }
 
 func (c *compiler) compileStmt(node ast.Node) {
+	if c.debug {
+		c.markStatement(node)
+	}
 	switch n := node.(type) {
 	case *ast.Mut:
-		to, sIdent := c.refScope(n.Indentifier)
+		c.recordReference(n.Identifier, n.IdentifierSpan)
+		to, sIdent := c.refScope(n.Identifier)
+		if n.Op.IsAssignOperator() {
+			c.compoundMut(n, to, sIdent)
+			break
+		}
 		switch sIdent {
 		case rFree:
 			from, sexpr := c.compileExpr(n.Expr, true)
@@ -147,13 +157,14 @@ func (c *compiler) compileStmt(node ast.Node) {
 				c.emitStore(from, to, storeFromLocal, storeFromGlobal)
 			}
 		case rNotDefined:
-			c.generateReferenceError(n.Indentifier, n.Line)
+			c.generateReferenceError(n.Identifier, n.Span)
 		}
 	case *ast.Let:
-		to, isPresent := c.sb.addGlobal(n.Indentifier)
+		to, isPresent := c.sb.addGlobal(n.Identifier)
 		if !isPresent {
 			*c.script.Store = append(*c.script.Store, NilValue)
 		}
+		c.recordGlobal(n.Identifier, n.IdentifierSpan, n.Expr, isPresent)
 		from, scope := c.compileExpr(n.Expr, true)
 		switch scope {
 		case rKonst:
@@ -171,12 +182,14 @@ func (c *compiler) compileStmt(node ast.Node) {
 		to := c.rAlloc
 		var from, scope int
 		if n.IsRecursive {
-			c.sb.addLocal(n.Identifier, c.level, c.scope, to)
+			c.declareLocal(n.Identifier, n.IdentifierSpan, symbolLocal, to)
+			c.recordModule(n.Expr)
 			c.emitLoad(c.kb.NilIndex(), to, loadFromKonst)
 			from, scope = c.compileExpr(n.Expr, true)
 		} else {
 			from, scope = c.compileExpr(n.Expr, true)
-			c.sb.addLocal(n.Identifier, c.level, c.scope, to)
+			c.declareLocal(n.Identifier, n.IdentifierSpan, symbolLocal, to)
+			c.recordModule(n.Expr)
 		}
 		switch scope {
 		case rKonst:
@@ -191,6 +204,26 @@ func (c *compiler) compileStmt(node ast.Node) {
 			}
 		}
 		c.rAlloc++
+	case *ast.Destructure:
+		kind := symbolLocal
+		switch n.Decl {
+		case token.LET:
+			kind = symbolGlobal
+		case token.FOR:
+			kind = symbolLoop
+		case token.FUN:
+			kind = symbolParam
+		}
+		next := c.rAlloc
+		if kind != symbolGlobal {
+			c.rAlloc += countBindings(n.Pattern)
+		}
+		src := c.rAlloc
+		i, s := c.compileExpr(n.Expr, true)
+		c.exprToReg(i, s)
+		c.rAlloc++
+		c.destructure(n.Pattern, src, kind, &next)
+		c.rAlloc = src
 	case *ast.Branch:
 		elifCount := len(n.Elifs)
 		hasElif := elifCount != 0
@@ -230,12 +263,12 @@ func (c *compiler) compileStmt(node ast.Node) {
 		c.exprToReg(stepIdx, stepScope)
 
 		c.rAlloc++
-		c.sb.addLocal(n.Id, c.level, c.scope, c.rAlloc)
+		c.declareLocal(n.Id, n.IdSpan, symbolLoop, c.rAlloc)
 		c.emitLoad(c.kb.IntegerIndex(0), c.rAlloc, loadFromKonst)
 
 		c.rAlloc++
 		c.emitForSet(ireg, 0)
-		c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+		c.recordSpan(n.Span)
 		loop := len(c.currentFn.Code)
 
 		c.compileStmt(n.Block)
@@ -255,11 +288,11 @@ func (c *compiler) compileStmt(node ast.Node) {
 		c.emitLoad(c.kb.IntegerIndex(0), ireg, loadFromKonst)
 
 		c.rAlloc++
-		c.sb.addLocal(n.Key, c.level, c.scope, c.rAlloc)
+		c.declareLocal(n.Key, n.KeySpan, symbolLoop, c.rAlloc)
 		c.emitLoad(c.kb.IntegerIndex(0), c.rAlloc, loadFromKonst)
 
 		c.rAlloc++
-		c.sb.addLocal(n.Value, c.level, c.scope, c.rAlloc)
+		c.declareLocal(n.Value, n.ValueSpan, symbolLoop, c.rAlloc)
 		c.emitLoad(c.kb.IntegerIndex(0), c.rAlloc, loadFromKonst)
 
 		c.rAlloc++
@@ -267,7 +300,7 @@ func (c *compiler) compileStmt(node ast.Node) {
 		c.exprToReg(i, s)
 
 		c.emitIForSet(0, c.rAlloc, ireg)
-		c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+		c.recordSpan(n.Span)
 		loop := len(c.currentFn.Code)
 
 		c.compileStmt(n.Block)
@@ -309,6 +342,39 @@ func (c *compiler) compileStmt(node ast.Node) {
 			c.currentFn.Code[addr] |= uint64(len(c.currentFn.Code))
 			c.cleanUpLoopScope(init, true)
 		}
+	case *ast.Match:
+		subject := c.rAlloc
+		i, s := c.compileExpr(n.Subject, true)
+		c.exprToReg(i, s)
+		c.rAlloc++
+		var exits []int
+		for k, arm := range n.Arms {
+			if c.debug {
+				c.markLine(arm.Line)
+			}
+			c.scope++
+			var fails []int
+			temps := c.compilePattern(arm.Pattern, subject, &fails)
+			if arm.Guard != nil {
+				i, s := c.compileExpr(arm.Guard, false)
+				c.exprToReg(i, s)
+				c.emitFail(&fails, checkFalsy, c.rAlloc)
+			}
+			c.compileStmt(arm.Block)
+			c.rAlloc -= c.sb.clearLocals(c.level, c.scope) + temps
+			c.scope--
+			if k < len(n.Arms)-1 {
+				exits = append(exits, len(c.currentFn.Code))
+				c.emitJump(0)
+			}
+			for _, addr := range fails {
+				c.currentFn.Code[addr] |= uint64(len(c.currentFn.Code))
+			}
+		}
+		for _, addr := range exits {
+			c.currentFn.Code[addr] |= uint64(len(c.currentFn.Code))
+		}
+		c.rAlloc--
 	case *ast.Break:
 		c.breakJumps = append(c.breakJumps, len(c.currentFn.Code))
 		c.breakCount[len(c.breakCount)-1]++
@@ -319,6 +385,7 @@ func (c *compiler) compileStmt(node ast.Node) {
 		c.emitJump(0)
 	case *ast.ReferenceStmt:
 		c.fromRefStmt = true
+		c.recordReference(n.Value, n.Span)
 		i, s := c.refScope(n.Value)
 		switch s {
 		case rLoc:
@@ -328,7 +395,7 @@ func (c *compiler) compileStmt(node ast.Node) {
 		case rFree:
 			c.emitLoad(i, c.rAlloc, loadFromFree)
 		case rNotDefined:
-			c.generateReferenceError(n.Value, n.Line)
+			c.generateReferenceError(n.Value, n.Span)
 		}
 		c.rAlloc++
 	case *ast.IGetStmt:
@@ -349,7 +416,7 @@ func (c *compiler) compileStmt(node ast.Node) {
 		case rFree:
 			c.emitIGet(i, j, i, storeFromFree, storeFromLocal)
 		}
-		c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+		c.recordSpan(n.Span)
 		if !c.fromRefStmt {
 			c.rAlloc--
 		}
@@ -371,7 +438,7 @@ func (c *compiler) compileStmt(node ast.Node) {
 		case rFree:
 			c.emitIGet(i, j, i, storeFromFree, storeFromLocal)
 		}
-		c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+		c.recordSpan(n.Span)
 		if !c.fromRefStmt {
 			c.rAlloc--
 		}
@@ -382,6 +449,12 @@ func (c *compiler) compileStmt(node ast.Node) {
 		} else {
 			c.rAlloc++
 		}
+		if n.Op.IsAssignOperator() {
+			c.compoundISet(n, i)
+			c.rAlloc--
+			c.fromRefStmt = false
+			break
+		}
 		j, t := c.compileExpr(n.Index, true)
 		switch t {
 		case rLoc:
@@ -397,7 +470,7 @@ func (c *compiler) compileStmt(node ast.Node) {
 			case rFree:
 				c.emitISet(i, j, k, storeFromLocal, storeFromFree)
 			}
-			c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+			c.recordSpan(n.Span)
 			c.rAlloc--
 		case rGlob:
 			c.rAlloc++
@@ -412,7 +485,7 @@ func (c *compiler) compileStmt(node ast.Node) {
 			case rFree:
 				c.emitISet(i, j, k, storeFromGlobal, storeFromFree)
 			}
-			c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+			c.recordSpan(n.Span)
 			c.rAlloc--
 		case rKonst:
 			c.rAlloc++
@@ -427,7 +500,7 @@ func (c *compiler) compileStmt(node ast.Node) {
 			case rFree:
 				c.emitISet(i, j, k, storeFromKonst, storeFromFree)
 			}
-			c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+			c.recordSpan(n.Span)
 			c.rAlloc--
 		case rFree:
 			c.rAlloc++
@@ -442,7 +515,7 @@ func (c *compiler) compileStmt(node ast.Node) {
 			case rFree:
 				c.emitISet(i, j, k, storeFromFree, storeFromGlobal)
 			}
-			c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+			c.recordSpan(n.Span)
 			c.rAlloc--
 		}
 		c.rAlloc--
@@ -484,7 +557,7 @@ func (c *compiler) compileStmt(node ast.Node) {
 		c.rAlloc = callable
 		c.fromRefStmt = false
 		c.emitCall(callable, len(n.Args), n.Ellipsis, 1)
-		c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+		c.recordSpan(n.Span)
 	case *ast.MethodCallStmt:
 		o := c.rAlloc
 		if c.fromRefStmt {
@@ -496,7 +569,7 @@ func (c *compiler) compileStmt(node ast.Node) {
 		c.rAlloc++
 		j, _ := c.compileExpr(n.Prop, true)
 		c.emitIGet(o, j, o, storeFromKonst, storeFromLocal)
-		c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+		c.recordSpan(n.Span)
 		for _, v := range n.Args {
 			i, s := c.compileExpr(v, true)
 			c.exprToReg(i, s)
@@ -505,20 +578,18 @@ func (c *compiler) compileStmt(node ast.Node) {
 		c.rAlloc = o
 		c.fromRefStmt = false
 		c.emitCall(o, len(n.Args)+1, n.Ellipsis, 2)
-		c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+		c.recordSpan(n.Span)
 	case *ast.Export:
-		if c.isSubcompiler {
-			i, s := c.compileExpr(n.Expr, true)
-			switch s {
-			case rLoc:
-				c.emitRet(storeFromLocal, i)
-			case rGlob:
-				c.emitRet(storeFromGlobal, i)
-			case rKonst:
-				c.emitRet(storeFromKonst, i)
-			case rFree:
-				c.emitRet(storeFromFree, i)
-			}
+		i, s := c.compileExpr(n.Expr, true)
+		switch s {
+		case rLoc:
+			c.emitRet(storeFromLocal, i)
+		case rGlob:
+			c.emitRet(storeFromGlobal, i)
+		case rKonst:
+			c.emitRet(storeFromKonst, i)
+		case rFree:
+			c.emitRet(storeFromFree, i)
 		}
 	}
 }
@@ -546,31 +617,31 @@ func (c *compiler) compileExpr(node ast.Node, isRoot bool) (int, int) {
 			} else {
 				c.hadError = true
 				c.errMsg = "cannot perform prefix operation"
-				c.lineErr = n.Line
+				c.spanErr = n.Span
 			}
 		}
 		switch scope {
 		case rGlob:
 			c.emitLoad(from, c.rAlloc, loadFromGlobal)
 			c.emitPrefix(c.rAlloc, c.rAlloc, n.Op)
-			c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+			c.recordSpan(n.Span)
 		case rLoc:
 			if c.mutLoc && isRoot {
 				c.emitPrefix(from, c.rDest, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				return c.rDest, rLoc
 			} else {
 				c.emitPrefix(from, c.rAlloc, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 			}
 		case rKonst:
 			c.emitLoad(from, c.rAlloc, loadFromKonst)
 			c.emitPrefix(c.rAlloc, c.rAlloc, n.Op)
-			c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+			c.recordSpan(n.Span)
 		case rFree:
 			c.emitLoad(from, c.rAlloc, loadFromFree)
 			c.emitPrefix(c.rAlloc, c.rAlloc, n.Op)
-			c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+			c.recordSpan(n.Span)
 		}
 		return c.rAlloc, rLoc
 	case *ast.Boolean:
@@ -578,9 +649,10 @@ func (c *compiler) compileExpr(node ast.Node, isRoot bool) (int, int) {
 	case *ast.Nil:
 		return c.kb.NilIndex(), rKonst
 	case *ast.Reference:
+		c.recordReference(n.Value, n.Span)
 		i, s := c.refScope(n.Value)
 		if s == rNotDefined {
-			c.generateReferenceError(n.Value, n.Line)
+			c.generateReferenceError(n.Value, n.Span)
 		}
 		return i, s
 	case *ast.List:
@@ -629,7 +701,7 @@ func (c *compiler) compileExpr(node ast.Node, isRoot bool) (int, int) {
 			case rFree:
 				c.emitISet(o, k, v, storeFromKonst, storeFromFree)
 			}
-			c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+			c.recordSpan(n.Span)
 			c.rAlloc--
 		}
 		return o, rLoc
@@ -648,45 +720,45 @@ func (c *compiler) compileExpr(node ast.Node, isRoot bool) (int, int) {
 			case rLoc:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromLocal, storeFromLocal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 					return c.rDest, rLoc
 				} else {
 					c.emitIGet(i, j, dest, storeFromLocal, storeFromLocal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			case rGlob:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromGlobal, storeFromLocal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 					return c.rDest, rLoc
 				} else {
 					c.emitIGet(i, j, dest, storeFromGlobal, storeFromLocal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			case rKonst:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromKonst, storeFromLocal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 					return c.rDest, rLoc
 				} else {
 					c.emitIGet(i, j, dest, storeFromKonst, storeFromLocal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			case rFree:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromFree, storeFromLocal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 					return c.rDest, rLoc
 				} else {
 					c.emitIGet(i, j, dest, storeFromFree, storeFromLocal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			}
@@ -697,45 +769,45 @@ func (c *compiler) compileExpr(node ast.Node, isRoot bool) (int, int) {
 			case rLoc:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromLocal, storeFromGlobal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 					return c.rDest, rLoc
 				} else {
 					c.emitIGet(i, j, dest, storeFromLocal, storeFromGlobal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			case rGlob:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromGlobal, storeFromGlobal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 					return c.rDest, rLoc
 				} else {
 					c.emitIGet(i, j, dest, storeFromGlobal, storeFromGlobal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			case rKonst:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromKonst, storeFromGlobal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 					return c.rDest, rLoc
 				} else {
 					c.emitIGet(i, j, dest, storeFromKonst, storeFromGlobal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			case rFree:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromFree, storeFromGlobal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 					return c.rDest, rLoc
 				} else {
 					c.emitIGet(i, j, dest, storeFromFree, storeFromGlobal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			}
@@ -746,44 +818,44 @@ func (c *compiler) compileExpr(node ast.Node, isRoot bool) (int, int) {
 			case rLoc:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromLocal, storeFromFree)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 					return c.rDest, rLoc
 				} else {
 					c.emitIGet(i, j, dest, storeFromLocal, storeFromFree)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			case rGlob:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromGlobal, storeFromFree)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				} else {
 					c.emitIGet(i, j, dest, storeFromGlobal, storeFromFree)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			case rKonst:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromKonst, storeFromFree)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 					return c.rDest, rLoc
 				} else {
 					c.emitIGet(i, j, dest, storeFromKonst, storeFromFree)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			case rFree:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromFree, storeFromFree)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 					return c.rDest, rLoc
 				} else {
 					c.emitIGet(i, j, dest, storeFromFree, storeFromFree)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			}
@@ -800,45 +872,45 @@ func (c *compiler) compileExpr(node ast.Node, isRoot bool) (int, int) {
 			case rLoc:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromLocal, storeFromLocal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 					return c.rDest, rLoc
 				} else {
 					c.emitIGet(i, j, dest, storeFromLocal, storeFromLocal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			case rGlob:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromGlobal, storeFromLocal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 					return c.rDest, rLoc
 				} else {
 					c.emitIGet(i, j, dest, storeFromGlobal, storeFromLocal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			case rKonst:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromKonst, storeFromLocal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 					return c.rDest, rLoc
 				} else {
 					c.emitIGet(i, j, dest, storeFromKonst, storeFromLocal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			case rFree:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromFree, storeFromLocal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 					return c.rDest, rLoc
 				} else {
 					c.emitIGet(i, j, dest, storeFromFree, storeFromLocal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			}
@@ -849,45 +921,45 @@ func (c *compiler) compileExpr(node ast.Node, isRoot bool) (int, int) {
 			case rLoc:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromLocal, storeFromGlobal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 					return c.rDest, rLoc
 				} else {
 					c.emitIGet(i, j, dest, storeFromLocal, storeFromGlobal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			case rGlob:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromGlobal, storeFromGlobal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 					return c.rDest, rLoc
 				} else {
 					c.emitIGet(i, j, dest, storeFromGlobal, storeFromGlobal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			case rKonst:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromKonst, storeFromGlobal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 					return c.rDest, rLoc
 				} else {
 					c.emitIGet(i, j, dest, storeFromKonst, storeFromGlobal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			case rFree:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromFree, storeFromGlobal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 					return c.rDest, rLoc
 				} else {
 					c.emitIGet(i, j, dest, storeFromFree, storeFromGlobal)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			}
@@ -898,44 +970,44 @@ func (c *compiler) compileExpr(node ast.Node, isRoot bool) (int, int) {
 			case rLoc:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromLocal, storeFromFree)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 					return c.rDest, rLoc
 				} else {
 					c.emitIGet(i, j, dest, storeFromLocal, storeFromFree)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			case rGlob:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromGlobal, storeFromFree)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				} else {
 					c.emitIGet(i, j, dest, storeFromGlobal, storeFromFree)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			case rKonst:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromKonst, storeFromFree)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 					return c.rDest, rLoc
 				} else {
 					c.emitIGet(i, j, dest, storeFromKonst, storeFromFree)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			case rFree:
 				if c.mutLoc && isRoot {
 					c.emitIGet(i, j, c.rDest, storeFromFree, storeFromFree)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 					return c.rDest, rLoc
 				} else {
 					c.emitIGet(i, j, dest, storeFromFree, storeFromFree)
-					c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+					c.recordSpan(n.Span)
 					c.rAlloc--
 				}
 			}
@@ -948,11 +1020,11 @@ func (c *compiler) compileExpr(node ast.Node, isRoot bool) (int, int) {
 		case vcv:
 			if c.mutLoc && isRoot {
 				c.emitSlice(n.Mode, c.rAlloc, c.rDest)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				return c.rDest, rLoc
 			} else {
 				c.emitSlice(n.Mode, c.rAlloc, c.rAlloc)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 			}
 		case vce:
 			c.rAlloc++
@@ -961,11 +1033,11 @@ func (c *compiler) compileExpr(node ast.Node, isRoot bool) (int, int) {
 			c.rAlloc--
 			if c.mutLoc && isRoot {
 				c.emitSlice(n.Mode, c.rAlloc, c.rDest)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				return c.rDest, rLoc
 			} else {
 				c.emitSlice(n.Mode, c.rAlloc, c.rAlloc)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 			}
 		case ecv:
 			c.rAlloc++
@@ -974,11 +1046,11 @@ func (c *compiler) compileExpr(node ast.Node, isRoot bool) (int, int) {
 			c.rAlloc--
 			if c.mutLoc && isRoot {
 				c.emitSlice(n.Mode, c.rAlloc, c.rDest)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				return c.rDest, rLoc
 			} else {
 				c.emitSlice(n.Mode, c.rAlloc, c.rAlloc)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 			}
 		case ece:
 			c.rAlloc++
@@ -990,11 +1062,11 @@ func (c *compiler) compileExpr(node ast.Node, isRoot bool) (int, int) {
 			c.rAlloc -= 2
 			if c.mutLoc && isRoot {
 				c.emitSlice(n.Mode, c.rAlloc, c.rDest)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				return c.rDest, rLoc
 			} else {
 				c.emitSlice(n.Mode, c.rAlloc, c.rAlloc)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 			}
 		}
 		return c.rAlloc, rLoc
@@ -1004,9 +1076,9 @@ func (c *compiler) compileExpr(node ast.Node, isRoot bool) (int, int) {
 		c.emitFun(c.kb.FunctionIndex(fn), c.rAlloc)
 		c.currentFn = fn
 		reg := c.startFuncScope()
-		for _, v := range n.Args {
+		for k, v := range n.Args {
 			fn.Arity++
-			c.sb.addLocal(v, c.level, c.scope, c.rAlloc)
+			c.declareLocal(v, n.ArgSpans[k], symbolParam, c.rAlloc)
 			c.rAlloc++
 		}
 		if n.IsVar {
@@ -1015,6 +1087,7 @@ func (c *compiler) compileExpr(node ast.Node, isRoot bool) (int, int) {
 		}
 		c.compileStmt(n.Body)
 		c.leaveFuncScope()
+		fn.registers = countRegisters(fn.Code, *c.kb.Konstants)
 		c.rAlloc = reg
 		return c.rAlloc, rLoc
 	case *ast.CallExpr:
@@ -1028,7 +1101,7 @@ func (c *compiler) compileExpr(node ast.Node, isRoot bool) (int, int) {
 		}
 		c.rAlloc = reg
 		c.emitCall(reg, len(n.Args), n.Ellipsis, 1)
-		c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+		c.recordSpan(n.Span)
 		return reg, rLoc
 	case *ast.MethodCallExpr:
 		o := c.rAlloc
@@ -1039,7 +1112,7 @@ func (c *compiler) compileExpr(node ast.Node, isRoot bool) (int, int) {
 		c.rAlloc++
 		j, _ := c.compileExpr(n.Prop, false)
 		c.emitIGet(i, j, o, storeFromKonst, storeFromLocal)
-		c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+		c.recordSpan(n.Span)
 		for _, v := range n.Args {
 			i, s := c.compileExpr(v, false)
 			c.exprToReg(i, s)
@@ -1047,13 +1120,13 @@ func (c *compiler) compileExpr(node ast.Node, isRoot bool) (int, int) {
 		}
 		c.rAlloc = o
 		c.emitCall(o, len(n.Args)+1, n.Ellipsis, 2)
-		c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+		c.recordSpan(n.Span)
 		return o, rLoc
 	case *ast.Import:
 		if _, isCycle := c.depMap[n.Path]; isCycle {
 			c.hadError = true
 			c.errMsg = "import cycle detected"
-			c.lineErr = n.Line
+			c.spanErr = n.Span
 			return 0, rGlob
 		} else {
 			c.depMap[n.Path] = dummy
@@ -1062,39 +1135,42 @@ func (c *compiler) compileExpr(node ast.Node, isRoot bool) (int, int) {
 			delete(c.depMap, n.Path)
 			c.emitFun(v, c.rAlloc)
 			c.emitCall(c.rAlloc, 0, 0, 1)
-			c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+			c.recordSpan(n.Span)
 			return c.rAlloc, rLoc
 		}
-		src, err := readScript(n.Path)
+		path := c.importPath(n.Path)
+		if err := c.sandbox.checkImport(path); err != nil {
+			c.importFailed(n.Path, err, n.Span)
+			return 0, rGlob
+		}
+		src, err := readScript(path)
 		if err != nil {
-			c.hadError = true
-			c.errMsg = err.Error()
-			c.lineErr = n.Line
+			c.importFailed(n.Path, err, n.Span)
 			return 0, rGlob
 		}
-		p := newParser(src, n.Path)
+		p := newParser(src, path)
 		scriptAST, err := p.parse()
 		if err != nil {
-			c.hadError = true
-			c.errMsg = err.Error()
-			c.lineErr = n.Line
+			c.importFailed(n.Path, err, n.Span)
 			return 0, rGlob
 		}
-		subCompiler := newSubCompiler(scriptAST, n.Path, c.kb, c.script.Store, c.scriptMap, c.depMap, c.errorInfo, len(*c.script.Store))
+		subCompiler := newSubCompiler(scriptAST, path, c.kb, c.script.Store, c.scriptMap, c.depMap, len(*c.script.Store))
+		subCompiler.sandbox = c.sandbox
+		subCompiler.debug = c.debug
+		subCompiler.dir = c.dir
 		m, err := subCompiler.compileSubScript()
 		c.sb.index = len(*c.script.Store)
 		if err != nil {
-			c.hadError = true
-			c.errMsg = err.Error()
-			c.lineErr = n.Line
+			c.importFailed(n.Path, err, n.Span)
 			return 0, rGlob
 		}
+		m.MainFunction.CoreFn.registers = countRegisters(m.MainFunction.CoreFn.Code, *c.kb.Konstants)
 		fnIndex := c.kb.FunctionIndex(m.MainFunction.CoreFn)
 		c.scriptMap[n.Path] = fnIndex
 		delete(c.depMap, n.Path)
 		c.emitFun(fnIndex, c.rAlloc)
 		c.emitCall(c.rAlloc, 0, 0, 1)
-		c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+		c.recordSpan(n.Span)
 		return c.rAlloc, rLoc
 	case *ast.Enum:
 		e := make(Enum)
@@ -1122,6 +1198,9 @@ func (c *compiler) compileExpr(node ast.Node, isRoot bool) (int, int) {
 }
 
 func (c *compiler) compileConditional(n *ast.If, shouldJumpOutside bool) {
+	if c.debug {
+		c.markLine(n.Line)
+	}
 	idx, scope := c.compileExpr(n.Condition, false)
 	if scope == rKonst {
 		switch v := (*c.kb.Konstants)[idx].(type) {
@@ -1144,6 +1223,299 @@ func (c *compiler) compileConditional(n *ast.If, shouldJumpOutside bool) {
 	}
 }
 
+// compilePattern emits the tests of a pattern against the value in reg, adding
+// the address of every check that jumps when a test fails to fails, and declares
+// the names the pattern binds. It returns how many registers it takes to hold
+// the parts of the value that are matched but not bound.
+func (c *compiler) compilePattern(pattern ast.Node, reg int, fails *[]int) int {
+	switch p := pattern.(type) {
+	case *ast.BindPattern:
+		c.emitLoad(reg, c.bindPattern(p), loadFromLocal)
+	case *ast.ValuePattern:
+		i, s := c.compileExpr(p.Value, false)
+		switch s {
+		case rKonst:
+			c.emitSuperEq(reg, i, c.rAlloc, loadFromLocal, loadFromKonst, token.EQ)
+		case rLoc:
+			c.emitSuperEq(reg, i, c.rAlloc, loadFromLocal, loadFromLocal, token.EQ)
+		case rGlob:
+			c.emitSuperEq(reg, i, c.rAlloc, loadFromLocal, loadFromGlobal, token.EQ)
+		case rFree:
+			c.emitSuperEq(reg, i, c.rAlloc, loadFromLocal, loadFromFree, token.EQ)
+		}
+		c.emitFail(fails, checkFalsy, c.rAlloc)
+	case *ast.ListPattern:
+		kind := checkLength
+		if p.Rest != nil {
+			kind = checkMinLength
+		}
+		c.emitFail(fails, kind|len(p.Elements)<<shift4, reg)
+		temps := 0
+		for k, e := range p.Elements {
+			temps += c.compileItem(e, reg, c.kb.IntegerIndex(int64(k)), fails)
+		}
+		if b, ok := p.Rest.(*ast.BindPattern); ok {
+			to := c.bindPattern(b)
+			c.emitLoad(reg, to, loadFromLocal)
+			c.emitLoad(c.kb.IntegerIndex(int64(len(p.Elements))), to+1, loadFromKonst)
+			c.emitSlice(ecv, to, to)
+		}
+		return temps
+	case *ast.ObjectPattern:
+		c.emitFail(fails, checkObject, reg)
+		temps := 0
+		for _, f := range p.Fields {
+			key := c.kb.StringIndex(f.Key)
+			if f.Default == nil {
+				c.emitBinopQ(key, reg, c.rAlloc, token.IN)
+				c.emitFail(fails, checkFalsy, c.rAlloc)
+				temps += c.compileItem(f.Pattern, reg, key, fails)
+				continue
+			}
+			item := c.rAlloc
+			c.emitIGet(reg, key, item, storeFromKonst, storeFromLocal)
+			c.rAlloc++
+			c.emitDefault(item, f.Default)
+			temps += 1 + c.compilePattern(f.Pattern, item, fails)
+		}
+		return temps
+	}
+	return 0
+}
+
+// compileItem matches a pattern against the item at the konstant index
+// of the list or object in reg, as compilePattern does.
+func (c *compiler) compileItem(pattern ast.Node, reg, index int, fails *[]int) int {
+	switch p := pattern.(type) {
+	case *ast.Wildcard:
+		return 0
+	case *ast.BindPattern:
+		c.emitIGet(reg, index, c.bindPattern(p), storeFromKonst, storeFromLocal)
+		return 0
+	}
+	item := c.rAlloc
+	c.emitIGet(reg, index, item, storeFromKonst, storeFromLocal)
+	c.rAlloc++
+	return 1 + c.compilePattern(pattern, item, fails)
+}
+
+func (c *compiler) bindPattern(p *ast.BindPattern) int {
+	reg := c.rAlloc
+	c.declareLocal(p.Identifier, p.Span, symbolPattern, reg)
+	c.rAlloc++
+	return reg
+}
+
+// destructure binds the items of the list or the fields of the object in reg
+// to the names of a pattern. Locals take the registers from *next on, while
+// globals, and the lists and objects destructured again, pass through the
+// registers from c.rAlloc on.
+func (c *compiler) destructure(pattern ast.Node, reg int, kind int, next *int) {
+	switch p := pattern.(type) {
+	case *ast.ListPattern:
+		for k, e := range p.Elements {
+			index := c.kb.IntegerIndex(int64(k))
+			switch e := e.(type) {
+			case *ast.BindPattern:
+				to := c.bindingReg(kind, next)
+				c.emitIGet(reg, index, to, storeFromKonst, storeFromLocal)
+				c.recordSpan(e.Span)
+				c.bind(e, to, kind)
+			case *ast.ListPattern, *ast.ObjectPattern:
+				item := c.rAlloc
+				c.emitIGet(reg, index, item, storeFromKonst, storeFromLocal)
+				c.recordSpan(p.Span)
+				c.rAlloc++
+				c.destructure(e, item, kind, next)
+				c.rAlloc--
+			}
+		}
+		if rest, ok := p.Rest.(*ast.BindPattern); ok {
+			to := c.bindingReg(kind, next)
+			c.emitLoad(reg, c.rAlloc, loadFromLocal)
+			c.emitLoad(c.kb.IntegerIndex(int64(len(p.Elements))), c.rAlloc+1, loadFromKonst)
+			c.emitSlice(ecv, c.rAlloc, to)
+			c.recordSpan(rest.Span)
+			c.bind(rest, to, kind)
+		}
+	case *ast.ObjectPattern:
+		for _, f := range p.Fields {
+			key := c.kb.StringIndex(f.Key)
+			switch e := f.Pattern.(type) {
+			case *ast.BindPattern:
+				to := c.bindingReg(kind, next)
+				c.emitIGet(reg, key, to, storeFromKonst, storeFromLocal)
+				c.recordSpan(f.Span)
+				if f.Default != nil {
+					c.emitDefault(to, f.Default)
+				}
+				c.bind(e, to, kind)
+			case *ast.ListPattern, *ast.ObjectPattern:
+				item := c.rAlloc
+				c.emitIGet(reg, key, item, storeFromKonst, storeFromLocal)
+				c.recordSpan(f.Span)
+				c.rAlloc++
+				if f.Default != nil {
+					c.emitDefault(item, f.Default)
+				}
+				c.destructure(e, item, kind, next)
+				c.rAlloc--
+			}
+		}
+	}
+}
+
+// emitDefault replaces the value in reg with the value of expr when it is nil.
+func (c *compiler) emitDefault(reg int, expr ast.Node) {
+	c.emitSuperEq(reg, c.kb.NilIndex(), c.rAlloc, loadFromLocal, loadFromKonst, token.EQ)
+	addr := len(c.currentFn.Code)
+	c.emitCheck(checkFalsy, c.rAlloc, 0)
+	i, s := c.compileExpr(expr, true)
+	switch s {
+	case rKonst:
+		c.emitLoad(i, reg, loadFromKonst)
+	case rGlob:
+		c.emitLoad(i, reg, loadFromGlobal)
+	case rFree:
+		c.emitLoad(i, reg, loadFromFree)
+	case rLoc:
+		if i != reg {
+			c.emitLoad(i, reg, loadFromLocal)
+		}
+	}
+	c.currentFn.Code[addr] |= uint64(len(c.currentFn.Code))
+}
+
+// bindingReg returns the register that takes the value of the next name
+// of a destructuring, which for a global is one of the scratch registers.
+func (c *compiler) bindingReg(kind int, next *int) int {
+	if kind == symbolGlobal {
+		c.rAlloc++
+		return c.rAlloc - 1
+	}
+	*next++
+	return *next - 1
+}
+
+// bind declares a name of a destructuring once its value is in reg.
+func (c *compiler) bind(n *ast.BindPattern, reg int, kind int) {
+	if kind != symbolGlobal {
+		c.declareLocal(n.Identifier, n.Span, kind, reg)
+		return
+	}
+	to, isPresent := c.sb.addGlobal(n.Identifier)
+	if !isPresent {
+		*c.script.Store = append(*c.script.Store, NilValue)
+	}
+	c.recordGlobal(n.Identifier, n.Span, nil, isPresent)
+	c.emitStore(reg, to, storeFromLocal, storeFromGlobal)
+	c.rAlloc--
+}
+
+// countBindings returns how many names a destructuring binds.
+func countBindings(pattern ast.Node) int {
+	switch p := pattern.(type) {
+	case *ast.BindPattern:
+		return 1
+	case *ast.ListPattern:
+		count := countBindings(p.Rest)
+		for _, e := range p.Elements {
+			count += countBindings(e)
+		}
+		return count
+	case *ast.ObjectPattern:
+		count := 0
+		for _, f := range p.Fields {
+			count += countBindings(f.Pattern)
+		}
+		return count
+	}
+	return 0
+}
+
+func (c *compiler) markStatement(node ast.Node) {
+	switch n := node.(type) {
+	case *ast.Let:
+		c.markLine(n.Line)
+	case *ast.Var:
+		c.markLine(n.Line)
+	case *ast.Mut:
+		c.markLine(n.Line)
+	case *ast.ReferenceStmt:
+		c.markLine(n.Line)
+	case *ast.For:
+		c.markLine(n.Line)
+	case *ast.IFor:
+		c.markLine(n.Line)
+	case *ast.While:
+		c.markLine(n.Line)
+	case *ast.Destructure:
+		c.markLine(n.Line)
+	case *ast.Match:
+		c.markLine(n.Line)
+	case *ast.Ret:
+		c.markLine(n.Line)
+	case *ast.Export:
+		c.markLine(n.Line)
+	}
+}
+
+// importPath returns where the script imported as path is read from, which is
+// also its name in errors. Relative paths are resolved against dir, or against
+// the working directory when dir is empty.
+func (c *compiler) importPath(path string) string {
+	if c.dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(c.dir, path)
+}
+
+// importFailed fails the import of path at span. The error of the imported
+// script is folded into the message on one line, so the import is reported
+// as a single error.
+func (c *compiler) importFailed(path string, err error, span token.Span) {
+	var list verror.ErrorList
+	var vErr verror.VidaError
+	switch {
+	case errors.As(err, &list) && len(list) > 0:
+		vErr = list[0]
+	case !errors.As(err, &vErr):
+		vErr.Message = err.Error()
+	}
+	msg := vErr.Message
+	if vErr.Line > 0 {
+		msg = fmt.Sprintf("%v error in %v at line %v: %v", strings.ToLower(vErr.ErrType), vErr.ScriptName, vErr.Line, msg)
+	}
+	if len(list) > 1 {
+		msg = fmt.Sprintf("%v (and %v more)", msg, len(list)-1)
+	}
+	c.hadError = true
+	c.errMsg = fmt.Sprintf("cannot import %v: %v", path, msg)
+	c.spanErr = span
+}
+
+// markLine emits a trace that starts a statement at line, and records
+// its line and the locals of the current function visible at that point.
+func (c *compiler) markLine(line uint) {
+	if line == 0 {
+		return
+	}
+	fn := c.currentFn
+	if fn.debug == nil {
+		fn.debug = newDebugInfo()
+	}
+	var locals []lKey
+	for _, v := range c.sb.History {
+		if v.level == c.level {
+			locals = append(locals, v)
+		}
+	}
+	ip := len(fn.Code)
+	fn.debug.lines[ip] = line
+	fn.debug.locals[ip] = locals
+	c.emitTrace()
+}
+
 func (c *compiler) skipBlock(block ast.Node) {
 	addr := len(c.currentFn.Code)
 	c.emitJump(0)
@@ -1220,6 +1592,79 @@ func (c *compiler) integrateKonst(val Value) (int, int) {
 	}
 }
 
+// compoundMut compiles a compound assignment to a variable, applying the
+// operator to the variable in place when it lives in a register, and to a copy
+// of it that is stored back otherwise.
+func (c *compiler) compoundMut(n *ast.Mut, to, scope int) {
+	switch scope {
+	case rLoc:
+		c.compound(to, n.Expr, n.Op, n.Span)
+	case rGlob:
+		reg := c.rAlloc
+		c.emitLoad(to, reg, loadFromGlobal)
+		c.rAlloc++
+		c.compound(reg, n.Expr, n.Op, n.Span)
+		c.rAlloc--
+		c.emitStore(reg, to, storeFromLocal, storeFromGlobal)
+	case rFree:
+		reg := c.rAlloc
+		c.emitLoad(to, reg, loadFromFree)
+		c.rAlloc++
+		c.compound(reg, n.Expr, n.Op, n.Span)
+		c.rAlloc--
+		c.emitStore(reg, to, storeFromLocal, storeFromFree)
+	case rNotDefined:
+		c.generateReferenceError(n.Identifier, n.Span)
+	}
+}
+
+// compoundISet compiles a compound assignment to an item or a property of the
+// value in the register indexable. The index is computed once, for both
+// getting the item and setting it back.
+func (c *compiler) compoundISet(n *ast.ISet, indexable int) {
+	j, t := c.compileExpr(n.Index, true)
+	var scope int
+	switch t {
+	case rLoc:
+		scope = storeFromLocal
+	case rKonst:
+		scope = storeFromKonst
+	case rGlob:
+		scope = storeFromGlobal
+	case rFree:
+		scope = storeFromFree
+	}
+	c.rAlloc++
+	reg := c.rAlloc
+	c.emitIGet(indexable, j, reg, scope, storeFromLocal)
+	c.recordSpan(n.Span)
+	c.rAlloc++
+	c.compound(reg, n.Expr, n.Op, n.Span)
+	c.emitISet(indexable, j, reg, scope, storeFromLocal)
+	c.recordSpan(n.Span)
+	c.rAlloc -= 2
+}
+
+// compound applies the binary operator of the compound assignment op to the
+// value in the register reg and the value of expr, leaving the result in reg.
+func (c *compiler) compound(reg int, expr ast.Node, op token.Token, span token.Span) {
+	op = op.BinaryOperator()
+	k, s := c.compileExpr(expr, true)
+	switch s {
+	case rKonst:
+		c.emitBinopK(k, reg, reg, op)
+	case rLoc:
+		c.emitBinop(reg, k, reg, op)
+	case rGlob:
+		c.emitLoad(k, c.rAlloc, loadFromGlobal)
+		c.emitBinop(reg, c.rAlloc, reg, op)
+	case rFree:
+		c.emitLoad(k, c.rAlloc, loadFromFree)
+		c.emitBinop(reg, c.rAlloc, reg, op)
+	}
+	c.recordSpan(span)
+}
+
 func (c *compiler) exprToReg(i, s int) {
 	switch s {
 	case rLoc:
@@ -1248,36 +1693,36 @@ func (c *compiler) compileBinaryExpr(n *ast.BinaryExpr, isRoot bool) (int, int)
 			} else {
 				c.hadError = true
 				c.errMsg = "cannot perform binary operation"
-				c.lineErr = n.Line
+				c.spanErr = n.Span
 			}
 		case rGlob:
 			c.emitLoad(ridx, lreg, loadFromGlobal)
 			if c.mutLoc && isRoot {
 				c.emitBinopQ(lidx, lreg, c.rDest, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				return c.rDest, rLoc
 			} else {
 				c.emitBinopQ(lidx, lreg, lreg, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 			}
 		case rLoc:
 			if c.mutLoc && isRoot {
 				c.emitBinopQ(lidx, ridx, c.rDest, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				return c.rDest, rLoc
 			} else {
 				c.emitBinopQ(lidx, ridx, lreg, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 			}
 		case rFree:
 			c.emitLoad(ridx, lreg, loadFromFree)
 			if c.mutLoc && isRoot {
 				c.emitBinopQ(lidx, lreg, c.rDest, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				return c.rDest, rLoc
 			} else {
 				c.emitBinopQ(lidx, lreg, lreg, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 			}
 		}
 	case rGlob:
@@ -1286,21 +1731,21 @@ func (c *compiler) compileBinaryExpr(n *ast.BinaryExpr, isRoot bool) (int, int)
 		case rGlob:
 			if c.mutLoc && isRoot {
 				c.emitBinopG(lidx, ridx, c.rDest, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				return c.rDest, rLoc
 			} else {
 				c.emitBinopG(lidx, ridx, lreg, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 			}
 		case rKonst:
 			c.emitLoad(lidx, lreg, loadFromGlobal)
 			if c.mutLoc && isRoot {
 				c.emitBinopK(ridx, lreg, c.rDest, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				return c.rDest, rLoc
 			} else {
 				c.emitBinopK(ridx, lreg, lreg, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 			}
 		case rLoc:
 			c.emitLoad(ridx, lreg, loadFromLocal)
@@ -1308,12 +1753,12 @@ func (c *compiler) compileBinaryExpr(n *ast.BinaryExpr, isRoot bool) (int, int)
 			c.emitLoad(lidx, c.rAlloc, loadFromGlobal)
 			if c.mutLoc && isRoot {
 				c.emitBinop(c.rAlloc, lreg, c.rDest, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				c.rAlloc--
 				return c.rDest, rLoc
 			} else {
 				c.emitBinop(c.rAlloc, lreg, lreg, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				c.rAlloc--
 			}
 		case rFree:
@@ -1322,12 +1767,12 @@ func (c *compiler) compileBinaryExpr(n *ast.BinaryExpr, isRoot bool) (int, int)
 			c.emitLoad(ridx, c.rAlloc, loadFromFree)
 			if c.mutLoc && isRoot {
 				c.emitBinop(lreg, c.rAlloc, c.rDest, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				c.rAlloc--
 				return c.rDest, rLoc
 			} else {
 				c.emitBinop(lreg, c.rAlloc, lreg, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				c.rAlloc--
 			}
 		}
@@ -1338,47 +1783,47 @@ func (c *compiler) compileBinaryExpr(n *ast.BinaryExpr, isRoot bool) (int, int)
 		case rLoc:
 			if c.mutLoc && isRoot {
 				c.emitBinop(lidx, ridx, c.rDest, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				c.rAlloc--
 				return c.rDest, rLoc
 			} else {
 				c.emitBinop(lidx, ridx, lreg, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				c.rAlloc--
 			}
 		case rGlob:
 			c.emitLoad(ridx, c.rAlloc, loadFromGlobal)
 			if c.mutLoc && isRoot {
 				c.emitBinop(lidx, c.rAlloc, c.rDest, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				c.rAlloc--
 				return c.rDest, rLoc
 			} else {
 				c.emitBinop(lidx, c.rAlloc, lreg, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				c.rAlloc--
 			}
 		case rKonst:
 			if c.mutLoc && isRoot {
 				c.emitBinopK(ridx, lidx, c.rDest, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				c.rAlloc--
 				return c.rDest, rLoc
 			} else {
 				c.emitBinopK(ridx, lidx, lreg, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				c.rAlloc--
 			}
 		case rFree:
 			c.emitLoad(ridx, c.rAlloc, loadFromFree)
 			if c.mutLoc && isRoot {
 				c.emitBinop(lidx, c.rAlloc, c.rDest, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				c.rAlloc--
 				return c.rDest, rLoc
 			} else {
 				c.emitBinop(lidx, c.rAlloc, lreg, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				c.rAlloc--
 			}
 		}
@@ -1390,12 +1835,12 @@ func (c *compiler) compileBinaryExpr(n *ast.BinaryExpr, isRoot bool) (int, int)
 			c.emitLoad(lidx, lreg, loadFromFree)
 			if c.mutLoc && isRoot {
 				c.emitBinop(lreg, ridx, c.rDest, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				c.rAlloc--
 				return c.rDest, rLoc
 			} else {
 				c.emitBinop(lreg, ridx, lreg, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				c.rAlloc--
 			}
 		case rGlob:
@@ -1403,24 +1848,24 @@ func (c *compiler) compileBinaryExpr(n *ast.BinaryExpr, isRoot bool) (int, int)
 			c.emitLoad(ridx, c.rAlloc, loadFromGlobal)
 			if c.mutLoc && isRoot {
 				c.emitBinop(lreg, c.rAlloc, c.rDest, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				c.rAlloc--
 				return c.rDest, rLoc
 			} else {
 				c.emitBinop(lreg, c.rAlloc, lreg, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				c.rAlloc--
 			}
 		case rKonst:
 			c.emitLoad(lidx, lreg, loadFromFree)
 			if c.mutLoc && isRoot {
 				c.emitBinopK(ridx, lreg, c.rDest, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				c.rAlloc--
 				return c.rDest, rLoc
 			} else {
 				c.emitBinopK(ridx, lreg, lreg, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				c.rAlloc--
 			}
 		case rFree:
@@ -1428,12 +1873,12 @@ func (c *compiler) compileBinaryExpr(n *ast.BinaryExpr, isRoot bool) (int, int)
 			c.emitLoad(ridx, c.rAlloc, loadFromFree)
 			if c.mutLoc && isRoot {
 				c.emitBinop(lreg, c.rAlloc, c.rDest, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				c.rAlloc--
 				return c.rDest, rLoc
 			} else {
 				c.emitBinop(lreg, c.rAlloc, lreg, n.Op)
-				c.errorInfo[c.currentFn.ScriptName][len(c.currentFn.Code)] = n.Line
+				c.recordSpan(n.Span)
 				c.rAlloc--
 			}
 		}
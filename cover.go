@@ -0,0 +1,169 @@
+package vida
+
+import (
+	"cmp"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Coverage holds, for every script of a run, the lines where a statement
+// starts and how many times the statement at each of them was executed.
+type Coverage struct {
+	Files []CoverageFile
+}
+
+// A CoverageFile holds the coverable lines of a single script, in order.
+type CoverageFile struct {
+	Script string
+	Lines  []CoverageLine
+}
+
+type CoverageLine struct {
+	Line uint
+	Hits uint64
+}
+
+// Covered returns the number of lines of the file that were executed.
+func (f *CoverageFile) Covered() int {
+	n := 0
+	for _, l := range f.Lines {
+		if l.Hits != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Coverage returns the lines executed by the profiled run, across the main
+// script and every script it imported. A line with several statements counts
+// the hits of the statement that ran the most.
+func (prof *Profile) Coverage() *Coverage {
+	hits := make(map[sourceLine]uint64)
+	for _, fn := range prof.fns {
+		if fn.debug == nil {
+			continue
+		}
+		counts := prof.counts[fn]
+		for ip, line := range fn.debug.lines {
+			k := sourceLine{fn.ScriptName, line}
+			var n uint64
+			if ip < len(counts) {
+				n = counts[ip]
+			}
+			hits[k] = max(hits[k], n)
+		}
+	}
+	files := make(map[string]*CoverageFile)
+	for k, n := range hits {
+		f, ok := files[k.script]
+		if !ok {
+			f = &CoverageFile{Script: k.script}
+			files[k.script] = f
+		}
+		f.Lines = append(f.Lines, CoverageLine{Line: k.line, Hits: n})
+	}
+	c := &Coverage{}
+	for _, f := range files {
+		slices.SortFunc(f.Lines, func(a, b CoverageLine) int { return cmp.Compare(a.Line, b.Line) })
+		c.Files = append(c.Files, *f)
+	}
+	slices.SortFunc(c.Files, func(a, b CoverageFile) int { return cmp.Compare(a.Script, b.Script) })
+	return c
+}
+
+// WriteSummary writes the share of lines executed in every script and in all of them.
+func (c *Coverage) WriteSummary(w io.Writer) {
+	covered, total := 0, 0
+	for _, f := range c.Files {
+		n := f.Covered()
+		covered += n
+		total += len(f.Lines)
+		fmt.Fprintf(w, "%7v %11v  %v\n", coveragePercent(n, len(f.Lines)), fmt.Sprintf("%v/%v", n, len(f.Lines)), f.Script)
+	}
+	fmt.Fprintf(w, "%7v %11v  %v\n", coveragePercent(covered, total), fmt.Sprintf("%v/%v", covered, total), "total")
+}
+
+func coveragePercent(covered, total int) string {
+	if total == 0 {
+		return "100.0%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(covered)*100/float64(total))
+}
+
+// WriteLCOV writes the coverage in the LCOV tracefile format read by genhtml and most editors.
+func (c *Coverage) WriteLCOV(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("TN:\n")
+	for _, f := range c.Files {
+		path, err := filepath.Abs(f.Script)
+		if err != nil {
+			path = f.Script
+		}
+		fmt.Fprintf(&b, "SF:%v\n", path)
+		for _, l := range f.Lines {
+			fmt.Fprintf(&b, "DA:%v,%v\n", l.Line, l.Hits)
+		}
+		fmt.Fprintf(&b, "LF:%v\nLH:%v\nend_of_record\n", len(f.Lines), f.Covered())
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteHTML writes every script as a single page with the executed lines
+// in green, the lines never executed in red and the hits of every line.
+func (c *Coverage) WriteHTML(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Vida coverage</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table.src { border-collapse: collapse; font-family: monospace; white-space: pre; }
+table.src td { padding: 0 0.6em; }
+td.num, td.hits { text-align: right; color: #888; }
+tr.hit { background: #dfd; }
+tr.miss { background: #fdd; }
+</style>
+</head>
+<body>
+<h1>Vida coverage</h1>
+<ul>
+`)
+	for k, f := range c.Files {
+		fmt.Fprintf(&b, "<li><a href=\"#file%v\">%v</a> %v</li>\n", k, html.EscapeString(f.Script), coveragePercent(f.Covered(), len(f.Lines)))
+	}
+	b.WriteString("</ul>\n")
+	for k, f := range c.Files {
+		fmt.Fprintf(&b, "<h2 id=\"file%v\">%v</h2>\n<table class=\"src\">\n", k, html.EscapeString(f.Script))
+		data, err := os.ReadFile(f.Script)
+		if err != nil {
+			return err
+		}
+		hits := make(map[uint]uint64, len(f.Lines))
+		for _, l := range f.Lines {
+			hits[l.Line] = l.Hits
+		}
+		for i, src := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			line := uint(i + 1)
+			class, count := "", ""
+			if n, ok := hits[line]; ok {
+				class, count = "miss", "0"
+				if n != 0 {
+					class, count = "hit", fmt.Sprint(n)
+				}
+			}
+			fmt.Fprintf(&b, "<tr class=\"%v\"><td class=\"num\">%v</td><td class=\"hits\">%v</td><td>%v</td></tr>\n", class, line, count, html.EscapeString(src))
+		}
+		b.WriteString("</table>\n")
+	}
+	b.WriteString("</body>\n</html>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,550 @@
+package vida
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The Debug Adapter Protocol server
+//
+// ServeDAP speaks the Debug Adapter Protocol over a pair of streams, so editors
+// can debug Vida scripts. It supports a single launched script with one thread.
+// The script runs on the line debugger of NewDebugger, on its own goroutine.
+// Whenever the debugger stops, that goroutine waits for the editor to resume it,
+// and requests about frames, scopes and variables are answered from the VM state.
+
+const dapThreadID = 1
+
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type dapSource struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type dapLaunchArguments struct {
+	Program     string `json:"program"`
+	Cwd         string `json:"cwd"`
+	StopOnEntry bool   `json:"stopOnEntry"`
+}
+
+type dapBreakpointArguments struct {
+	Source      dapSource `json:"source"`
+	Breakpoints []struct {
+		Line uint `json:"line"`
+	} `json:"breakpoints"`
+}
+
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	Type               string `json:"type,omitempty"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+type dapServer struct {
+	in          *bufio.Reader
+	out         io.Writer
+	mu          sync.Mutex
+	seq         int
+	libs        LibsLoader
+	interpreter *Interpreter
+	debugger    *debugger
+	breakpoints map[string][]uint
+	launched    bool
+	configured  bool
+	running     bool
+	resume      chan bool
+	quit        chan struct{}
+	done        chan struct{}
+	state       sync.Mutex
+	vm          *VM
+	ip          int
+	handles     []func() []dapVariable
+}
+
+// ServeDAP serves the Debug Adapter Protocol on in and out until the editor
+// disconnects. While the script runs, what it prints is sent as output
+// events instead, since out usually is the standard output itself.
+func ServeDAP(in io.Reader, out io.Writer, extensionlibloader map[string]func() Value) error {
+	s := &dapServer{
+		in:          bufio.NewReader(in),
+		out:         out,
+		libs:        extensionlibloader,
+		breakpoints: make(map[string][]uint),
+		resume:      make(chan bool),
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	for {
+		req, err := s.read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				s.stop()
+				return nil
+			}
+			return err
+		}
+		if !s.handle(req) {
+			return nil
+		}
+	}
+}
+
+// readFrame reads the content of a message framed by a Content-Length header,
+// the framing shared by the Debug Adapter and the Language Server protocols.
+func readFrame(in *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("missing Content-Length header")
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(in, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func writeFrame(out io.Writer, data []byte) {
+	fmt.Fprintf(out, "Content-Length: %v\r\n\r\n%s", len(data), data)
+}
+
+func (s *dapServer) read() (*dapRequest, error) {
+	data, err := readFrame(s.in)
+	if err != nil {
+		return nil, err
+	}
+	req := &dapRequest{}
+	if err := json.Unmarshal(data, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (s *dapServer) send(message map[string]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	message["seq"] = s.seq
+	data, _ := json.Marshal(message)
+	writeFrame(s.out, data)
+}
+
+func (s *dapServer) respond(req *dapRequest, body any) {
+	message := map[string]any{
+		"type":        "response",
+		"request_seq": req.Seq,
+		"command":     req.Command,
+		"success":     true,
+	}
+	if body != nil {
+		message["body"] = body
+	}
+	s.send(message)
+}
+
+func (s *dapServer) fail(req *dapRequest, err string) {
+	s.send(map[string]any{
+		"type":        "response",
+		"request_seq": req.Seq,
+		"command":     req.Command,
+		"success":     false,
+		"message":     err,
+	})
+}
+
+func (s *dapServer) event(event string, body any) {
+	message := map[string]any{"type": "event", "event": event}
+	if body != nil {
+		message["body"] = body
+	}
+	s.send(message)
+}
+
+// handle answers a request. It returns false once the session is over.
+func (s *dapServer) handle(req *dapRequest) bool {
+	switch req.Command {
+	case "initialize":
+		s.respond(req, map[string]any{"supportsConfigurationDoneRequest": true})
+		s.event("initialized", nil)
+	case "launch":
+		s.launch(req)
+	case "setBreakpoints":
+		s.setBreakpoints(req)
+	case "setExceptionBreakpoints":
+		s.respond(req, map[string]any{"breakpoints": []any{}})
+	case "configurationDone":
+		s.configured = true
+		s.respond(req, nil)
+		s.start()
+	case "threads":
+		s.respond(req, map[string]any{"threads": []any{map[string]any{"id": dapThreadID, "name": "main"}}})
+	case "stackTrace":
+		s.stackTrace(req)
+	case "scopes":
+		s.scopes(req)
+	case "variables":
+		s.variables(req)
+	case "evaluate":
+		s.evaluate(req)
+	case "pause":
+		if s.debugger != nil {
+			s.debugger.interrupt.Store(true)
+		}
+		s.respond(req, nil)
+	case "continue":
+		s.step(req, stepRun, map[string]any{"allThreadsContinued": true})
+	case "next":
+		s.step(req, stepOver, nil)
+	case "stepIn":
+		s.step(req, stepIn, nil)
+	case "stepOut":
+		s.step(req, stepOut, nil)
+	case "disconnect", "terminate":
+		s.stop()
+		s.respond(req, nil)
+		return req.Command != "disconnect"
+	default:
+		s.fail(req, fmt.Sprintf("unsupported request '%v'", req.Command))
+	}
+	return true
+}
+
+func (s *dapServer) launch(req *dapRequest) {
+	var args dapLaunchArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil || args.Program == "" {
+		s.fail(req, "launch needs the path of a program")
+		return
+	}
+	program := args.Program
+	if args.Cwd != "" && !filepath.IsAbs(program) {
+		program = filepath.Join(args.Cwd, program)
+	}
+	i, err := newLineInterpreter(program, args.Cwd, s.libs)
+	if err != nil {
+		s.fail(req, err.Error())
+		return
+	}
+	i.debugger = newDebugger(i.globals)
+	s.interpreter = i
+	s.debugger = i.debugger
+	s.debugger.stop = s.stopped
+	if !args.StopOnEntry {
+		s.debugger.mode = stepRun
+	}
+	for file, lines := range s.breakpoints {
+		s.resolveBreakpoints(file, lines)
+	}
+	s.launched = true
+	s.respond(req, nil)
+	s.start()
+}
+
+func (s *dapServer) setBreakpoints(req *dapRequest) {
+	var args dapBreakpointArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		s.fail(req, err.Error())
+		return
+	}
+	var lines []uint
+	for _, b := range args.Breakpoints {
+		lines = append(lines, b.Line)
+	}
+	s.breakpoints[args.Source.Path] = lines
+	var result []map[string]any
+	if s.debugger == nil {
+		for _, l := range lines {
+			result = append(result, map[string]any{"verified": false, "line": l})
+		}
+	} else {
+		result = s.resolveBreakpoints(args.Source.Path, lines)
+	}
+	s.respond(req, map[string]any{"breakpoints": result})
+}
+
+// resolveBreakpoints replaces the breakpoints of the debugger in file.
+func (s *dapServer) resolveBreakpoints(file string, lines []uint) []map[string]any {
+	d := s.debugger
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakpoints = slices.DeleteFunc(d.breakpoints, func(b breakpoint) bool { return sameScript(b.script, file) })
+	result := make([]map[string]any, 0, len(lines))
+	for _, l := range lines {
+		b, ok := resolveBreakpoint(s.interpreter.vm.Script, file, l)
+		if ok {
+			d.breakpoints = append(d.breakpoints, b)
+			result = append(result, map[string]any{"verified": true, "line": b.line})
+		} else {
+			result = append(result, map[string]any{"verified": false, "line": l, "message": "no statement at or after this line"})
+		}
+	}
+	return result
+}
+
+// start runs the script once it has been launched and configured.
+func (s *dapServer) start() {
+	if !s.launched || !s.configured || s.running {
+		return
+	}
+	s.running = true
+	forwarded := make(chan struct{})
+	r, w := io.Pipe()
+	s.interpreter.SetOutput(w)
+	go s.forward(r, "stdout", forwarded)
+	go func() {
+		defer close(s.done)
+		result, err := s.interpreter.Debug()
+		if err != nil {
+			s.event("output", map[string]any{"category": "stderr", "output": fmt.Sprintf("%v\n", err)})
+			vm := s.interpreter.vm
+			s.pause(vm, max(vm.Frame.ip-1, 0))
+			s.event("stopped", map[string]any{"reason": "exception", "description": "Runtime error", "text": strings.TrimSpace(err.Error()), "threadId": dapThreadID, "allThreadsStopped": true})
+			s.wait()
+		}
+		w.Close()
+		<-forwarded
+		code := 0
+		if err != nil || result != Success {
+			code = 1
+		}
+		s.event("exited", map[string]any{"exitCode": code})
+		s.event("terminated", nil)
+	}()
+}
+
+func (s *dapServer) forward(r io.Reader, category string, done chan struct{}) {
+	defer close(done)
+	buffer := make([]byte, 4096)
+	for {
+		n, err := r.Read(buffer)
+		if n > 0 {
+			s.event("output", map[string]any{"category": category, "output": string(buffer[:n])})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// stopped runs on the goroutine of the script each time the debugger stops it,
+// and blocks until the editor resumes the script or ends the session.
+func (s *dapServer) stopped(vm *VM, ip int) bool {
+	s.pause(vm, ip)
+	s.event("stopped", map[string]any{"reason": s.debugger.reason, "threadId": dapThreadID, "allThreadsStopped": true})
+	return s.wait()
+}
+
+func (s *dapServer) pause(vm *VM, ip int) {
+	s.state.Lock()
+	s.vm, s.ip, s.handles = vm, ip, nil
+	s.state.Unlock()
+}
+
+func (s *dapServer) wait() bool {
+	select {
+	case r := <-s.resume:
+		return r
+	case <-s.quit:
+		return false
+	}
+}
+
+// stoppedVM returns the VM while the script is stopped, and nil otherwise.
+func (s *dapServer) stoppedVM() *VM {
+	vm, _ := s.stoppedAt()
+	return vm
+}
+
+// stoppedAt returns the VM and the ip where the script is stopped.
+func (s *dapServer) stoppedAt() (*VM, int) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	return s.vm, s.ip
+}
+
+func (s *dapServer) step(req *dapRequest, mode int, body any) {
+	vm := s.stoppedVM()
+	if vm == nil {
+		s.fail(req, "the script is not stopped")
+		return
+	}
+	s.debugger.resume(vm, mode)
+	s.pause(nil, 0)
+	s.respond(req, body)
+	s.resume <- true
+}
+
+// stop ends the script if it is still running.
+func (s *dapServer) stop() {
+	if !s.running {
+		return
+	}
+	s.debugger.interrupt.Store(true)
+	close(s.quit)
+	<-s.done
+	s.running = false
+}
+
+func (s *dapServer) stackTrace(req *dapRequest) {
+	vm, ip := s.stoppedAt()
+	d := s.debugger
+	if vm == nil {
+		s.fail(req, "the script is not stopped")
+		return
+	}
+	var frames []map[string]any
+	for k := vm.fp; k >= 0; k-- {
+		fn := vm.Frames[k].lambda
+		frames = append(frames, map[string]any{
+			"id":     k + 1,
+			"name":   d.functionName(vm, fn),
+			"source": dapSourceOf(fn.CoreFn.ScriptName),
+			"line":   d.frameLine(vm, k, ip),
+			"column": 1,
+		})
+	}
+	s.respond(req, map[string]any{"stackFrames": frames, "totalFrames": len(frames)})
+}
+
+func (s *dapServer) scopes(req *dapRequest) {
+	var args struct {
+		FrameID int `json:"frameId"`
+	}
+	vm, ip := s.stoppedAt()
+	if err := json.Unmarshal(req.Arguments, &args); err != nil || vm == nil || args.FrameID < 1 || args.FrameID > vm.fp+1 {
+		s.fail(req, "unknown frame")
+		return
+	}
+	d, k := s.debugger, args.FrameID-1
+	locals := s.reference(func() []dapVariable { return s.dapVariables(d.frameLocals(vm, k, ip)) })
+	globals := s.reference(func() []dapVariable { return s.dapVariables(d.frameGlobals(vm)) })
+	s.respond(req, map[string]any{"scopes": []any{
+		map[string]any{"name": "Locals", "presentationHint": "locals", "variablesReference": locals, "expensive": false},
+		map[string]any{"name": "Globals", "variablesReference": globals, "expensive": false},
+	}})
+}
+
+func (s *dapServer) variables(req *dapRequest) {
+	var args struct {
+		VariablesReference int `json:"variablesReference"`
+	}
+	var vars func() []dapVariable
+	if err := json.Unmarshal(req.Arguments, &args); err == nil {
+		vars = s.variablesOf(args.VariablesReference)
+	}
+	if vars == nil {
+		s.fail(req, "unknown variables reference")
+		return
+	}
+	s.respond(req, map[string]any{"variables": vars()})
+}
+
+func (s *dapServer) evaluate(req *dapRequest) {
+	var args struct {
+		Expression string `json:"expression"`
+		FrameID    int    `json:"frameId"`
+	}
+	vm, ip := s.stoppedAt()
+	if err := json.Unmarshal(req.Arguments, &args); err != nil || vm == nil || args.FrameID < 0 || args.FrameID > vm.fp+1 {
+		s.fail(req, "the script is not stopped")
+		return
+	}
+	k := vm.fp
+	if args.FrameID != 0 {
+		k = args.FrameID - 1
+	}
+	val, ok := s.debugger.lookup(vm, k, ip, strings.TrimSpace(args.Expression))
+	if !ok {
+		s.fail(req, fmt.Sprintf("no variable named '%v' here", args.Expression))
+		return
+	}
+	v := s.dapVariable("", val)
+	s.respond(req, map[string]any{"result": v.Value, "type": v.Type, "variablesReference": v.VariablesReference})
+}
+
+// reference registers a function producing variables and returns its reference.
+// References are valid until the script is resumed.
+func (s *dapServer) reference(vars func() []dapVariable) int {
+	s.state.Lock()
+	defer s.state.Unlock()
+	s.handles = append(s.handles, vars)
+	return len(s.handles)
+}
+
+// variablesOf returns the function registered for ref while the script is
+// stopped, and nil when ref is unknown or the script is running.
+func (s *dapServer) variablesOf(ref int) func() []dapVariable {
+	s.state.Lock()
+	defer s.state.Unlock()
+	if s.vm == nil || ref < 1 || ref > len(s.handles) {
+		return nil
+	}
+	return s.handles[ref-1]
+}
+
+func (s *dapServer) dapVariables(vars []variable) []dapVariable {
+	result := make([]dapVariable, 0, len(vars))
+	for _, v := range vars {
+		result = append(result, s.dapVariable(v.name, v.value))
+	}
+	return result
+}
+
+func (s *dapServer) dapVariable(name string, val Value) dapVariable {
+	v := dapVariable{Name: name, Value: val.String(), Type: val.Type()}
+	switch x := val.(type) {
+	case *List:
+		v.VariablesReference = s.reference(func() []dapVariable {
+			var vars []variable
+			for i, e := range x.Value {
+				vars = append(vars, variable{strconv.Itoa(i), e})
+			}
+			return s.dapVariables(vars)
+		})
+	case *Object:
+		v.VariablesReference = s.reference(func() []dapVariable {
+			var vars []variable
+			for k, e := range x.Value {
+				vars = append(vars, variable{k, e})
+			}
+			slices.SortFunc(vars, func(a, b variable) int { return strings.Compare(a.name, b.name) })
+			return s.dapVariables(vars)
+		})
+	}
+	return v
+}
+
+func dapSourceOf(script string) dapSource {
+	path := script
+	if p, err := resolvePath(script); err == nil {
+		path = p
+	}
+	return dapSource{Name: filepath.Base(script), Path: path}
+}
@@ -0,0 +1,461 @@
+package vida
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// debugInfo maps the first instruction of every statement of a function
+// to its line, and to the locals of the function visible at that point.
+// The compiler only builds it when compiling for the debugger.
+type debugInfo struct {
+	lines  map[int]uint
+	locals map[int][]lKey
+}
+
+func newDebugInfo() *debugInfo {
+	return &debugInfo{
+		lines:  make(map[int]uint),
+		locals: make(map[int][]lKey),
+	}
+}
+
+// statement returns the start of the statement that contains ip.
+func (d *debugInfo) statement(ip int) (int, bool) {
+	start, found := 0, false
+	for k := range d.lines {
+		if k <= ip && (!found || k > start) {
+			start, found = k, true
+		}
+	}
+	return start, found
+}
+
+const (
+	stepRun = iota
+	stepIn
+	stepOver
+	stepOut
+)
+
+type breakpoint struct {
+	script string
+	line   uint
+}
+
+// debugger drives a VM running in debug mode one source line at a time.
+// Whenever it stops the VM, it hands control to stop, which returns false
+// to end the session. By default stop is an interactive terminal prompt.
+type debugger struct {
+	in          *bufio.Scanner
+	out         io.Writer
+	globals     map[string]int
+	mu          sync.Mutex
+	breakpoints []breakpoint
+	interrupt   atomic.Bool
+	sources     map[string][]string
+	stop        func(vm *VM, ip int) bool
+	reason      string
+	mode        int
+	depth       int
+	last        string
+}
+
+func newDebugger(globals map[string]int) *debugger {
+	d := &debugger{
+		in:      bufio.NewScanner(os.Stdin),
+		out:     os.Stdout,
+		globals: globals,
+		sources: make(map[string][]string),
+		reason:  "entry",
+		mode:    stepIn,
+	}
+	d.stop = d.prompt
+	return d
+}
+
+// errDebugQuit ends the execution of a script when the debugging session ends.
+var errDebugQuit = errors.New("debugging session ended")
+
+// errNotDebuggable is returned by Debug for a script compiled without trace instructions.
+var errNotDebuggable = errors.New("the script was not compiled for debugging, create the interpreter with NewDebugger")
+
+// hook runs at the start of every statement and stops there when the debugger has to.
+func (d *debugger) hook(vm *VM, ip int) error {
+	if d.shouldStop(vm, ip) && !d.stop(vm, ip) {
+		return errDebugQuit
+	}
+	return nil
+}
+
+func (d *debugger) shouldStop(vm *VM, ip int) bool {
+	info := vm.Frame.lambda.CoreFn.debug
+	if info == nil {
+		return false
+	}
+	line, isStatement := info.lines[ip]
+	if !isStatement {
+		return false
+	}
+	if d.interrupt.Swap(false) {
+		d.reason = "pause"
+		return true
+	}
+	d.mu.Lock()
+	hit := slices.Contains(d.breakpoints, breakpoint{vm.Frame.lambda.CoreFn.ScriptName, line})
+	d.mu.Unlock()
+	if hit {
+		d.reason = "breakpoint"
+		return true
+	}
+	var stop bool
+	switch d.mode {
+	case stepIn:
+		stop = true
+	case stepOver:
+		stop = vm.fp <= d.depth
+	case stepOut:
+		stop = vm.fp < d.depth
+	}
+	if stop && d.reason != "entry" {
+		d.reason = "step"
+	}
+	return stop
+}
+
+// resume sets how the VM runs until the next stop.
+func (d *debugger) resume(vm *VM, mode int) {
+	d.mode, d.depth, d.reason = mode, vm.fp, ""
+}
+
+// prompt shows where the VM stopped and reads commands until one of them resumes
+// the execution. It returns false when the user wants to leave the session.
+func (d *debugger) prompt(vm *VM, ip int) bool {
+	d.where(vm, vm.fp, ip)
+	for {
+		fmt.Fprint(d.out, "(vdb) ")
+		if !d.in.Scan() {
+			fmt.Fprintln(d.out)
+			return false
+		}
+		input := strings.TrimSpace(d.in.Text())
+		if input == "" {
+			input = d.last
+		}
+		d.last = input
+		fields := strings.Fields(input)
+		if len(fields) == 0 {
+			continue
+		}
+		arg := strings.Join(fields[1:], " ")
+		switch fields[0] {
+		case "s", "step":
+			d.resume(vm, stepIn)
+			return true
+		case "n", "next":
+			d.resume(vm, stepOver)
+			return true
+		case "f", "finish":
+			d.resume(vm, stepOut)
+			return true
+		case "c", "continue":
+			d.resume(vm, stepRun)
+			return true
+		case "b", "break":
+			d.setBreakpoint(vm, arg)
+		case "d", "delete":
+			d.deleteBreakpoint(vm, arg)
+		case "i", "breakpoints":
+			for _, b := range d.breakpoints {
+				fmt.Fprintf(d.out, "  %v:%v\n", b.script, b.line)
+			}
+		case "p", "print":
+			d.print(vm, ip, arg)
+		case "locals":
+			d.locals(vm, ip)
+		case "bt", "backtrace":
+			d.backtrace(vm, ip)
+		case "l", "list":
+			d.list(vm, ip)
+		case "inspect":
+			vm.Inspect(ip)
+			d.where(vm, vm.fp, ip)
+		case "h", "help":
+			d.help()
+		case "q", "quit":
+			return false
+		default:
+			fmt.Fprintf(d.out, "unknown command '%v', type 'help' for the command list\n", fields[0])
+		}
+	}
+}
+
+func (d *debugger) help() {
+	fmt.Fprintln(d.out, "  s, step               run to the next line, entering calls")
+	fmt.Fprintln(d.out, "  n, next               run to the next line of this function")
+	fmt.Fprintln(d.out, "  f, finish             run until this function returns")
+	fmt.Fprintln(d.out, "  c, continue           run until the next breakpoint")
+	fmt.Fprintln(d.out, "  b, break [file:]line  set a breakpoint")
+	fmt.Fprintln(d.out, "  d, delete [file:]line remove a breakpoint")
+	fmt.Fprintln(d.out, "  i, breakpoints        show the breakpoints")
+	fmt.Fprintln(d.out, "  p, print name         show the value of a local, free or global variable")
+	fmt.Fprintln(d.out, "  locals                show the locals of this function")
+	fmt.Fprintln(d.out, "  bt, backtrace         show the call stack")
+	fmt.Fprintln(d.out, "  l, list               show the source around this line")
+	fmt.Fprintln(d.out, "  inspect               show the state of the machine")
+	fmt.Fprintln(d.out, "  q, quit               stop the script and leave")
+	fmt.Fprintln(d.out, "An empty line repeats the last command.")
+}
+
+// frameIP returns the ip of the instruction that frame k is running.
+func (d *debugger) frameIP(vm *VM, k, ip int) int {
+	if k == vm.fp {
+		return ip
+	}
+	return vm.Frames[k].ip - 1
+}
+
+func (d *debugger) frameLine(vm *VM, k, ip int) uint {
+	info := vm.Frames[k].lambda.CoreFn.debug
+	if info == nil {
+		return 0
+	}
+	if start, ok := info.statement(d.frameIP(vm, k, ip)); ok {
+		return info.lines[start]
+	}
+	return 0
+}
+
+func (d *debugger) where(vm *VM, k, ip int) {
+	script := vm.Frames[k].lambda.CoreFn.ScriptName
+	line := d.frameLine(vm, k, ip)
+	fmt.Fprintf(d.out, "%v:%v  %v\n", script, line, strings.TrimSpace(d.source(script, line)))
+}
+
+func (d *debugger) source(script string, line uint) string {
+	lines, ok := d.sources[script]
+	if !ok {
+		if data, err := os.ReadFile(script); err == nil {
+			lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		}
+		d.sources[script] = lines
+	}
+	if line == 0 || int(line) > len(lines) {
+		return ""
+	}
+	return lines[line-1]
+}
+
+func (d *debugger) list(vm *VM, ip int) {
+	script := vm.Frame.lambda.CoreFn.ScriptName
+	line := d.frameLine(vm, vm.fp, ip)
+	d.source(script, line)
+	from, to := max(int(line)-5, 1), min(int(line)+5, len(d.sources[script]))
+	for i := from; i <= to; i++ {
+		mark := " "
+		if uint(i) == line {
+			mark = ">"
+		}
+		fmt.Fprintf(d.out, "%v %4v  %v\n", mark, i, d.source(script, uint(i)))
+	}
+}
+
+func (d *debugger) backtrace(vm *VM, ip int) {
+	for k := vm.fp; k >= 0; k-- {
+		fn := vm.Frames[k].lambda
+		script := fn.CoreFn.ScriptName
+		line := d.frameLine(vm, k, ip)
+		fmt.Fprintf(d.out, "#%-3v %v at %v:%v\n", vm.fp-k, d.functionName(vm, fn), script, line)
+	}
+}
+
+func (d *debugger) functionName(vm *VM, fn *Function) string {
+	if fn.CoreFn == vm.Script.MainFunction.CoreFn {
+		return "main"
+	}
+	var names []string
+	for name, idx := range d.globals {
+		if f, ok := (*vm.Script.Store)[idx].(*Function); ok && f.CoreFn == fn.CoreFn {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "fun"
+	}
+	return slices.Min(names)
+}
+
+type variable struct {
+	name  string
+	value Value
+}
+
+// frameLocals returns the locals and then the free variables visible
+// in frame k, each group innermost last.
+func (d *debugger) frameLocals(vm *VM, k, ip int) []variable {
+	var vars []variable
+	f := &vm.Frames[k]
+	if info := f.lambda.CoreFn.debug; info != nil {
+		if start, ok := info.statement(d.frameIP(vm, k, ip)); ok {
+			for _, v := range info.locals[start] {
+				vars = append(vars, variable{v.id, vm.Stack[f.bp+v.reg]})
+			}
+		}
+	}
+	for i := 0; i < f.lambda.CoreFn.Free && i < len(f.lambda.Free); i++ {
+		vars = append(vars, variable{f.lambda.CoreFn.Info[i].Id, f.lambda.Free[i]})
+	}
+	return vars
+}
+
+// frameGlobals returns the globals of the main script that are not part of the corelib.
+func (d *debugger) frameGlobals(vm *VM) []variable {
+	var vars []variable
+	for name, idx := range d.globals {
+		if !slices.Contains(coreLibNames, name) {
+			vars = append(vars, variable{name, (*vm.Script.Store)[idx]})
+		}
+	}
+	slices.SortFunc(vars, func(a, b variable) int { return strings.Compare(a.name, b.name) })
+	return vars
+}
+
+// lookup finds a variable by name as seen from frame k.
+func (d *debugger) lookup(vm *VM, k, ip int, name string) (Value, bool) {
+	vars := d.frameLocals(vm, k, ip)
+	for i := len(vars) - 1; i >= 0; i-- {
+		if vars[i].name == name {
+			return vars[i].value, true
+		}
+	}
+	if idx, ok := d.globals[name]; ok {
+		return (*vm.Script.Store)[idx], true
+	}
+	return NilValue, false
+}
+
+func (d *debugger) locals(vm *VM, ip int) {
+	for _, v := range d.frameLocals(vm, vm.fp, ip) {
+		fmt.Fprintf(d.out, "  %v = %v\n", v.name, v.value)
+	}
+}
+
+func (d *debugger) print(vm *VM, ip int, name string) {
+	if name == "" {
+		fmt.Fprintln(d.out, "usage: print name")
+		return
+	}
+	if val, ok := d.lookup(vm, vm.fp, ip, name); ok {
+		fmt.Fprintf(d.out, "  %v = %v\n", name, val)
+		return
+	}
+	fmt.Fprintf(d.out, "no variable named '%v' here\n", name)
+}
+
+// parseLocation reads a location like "script.vida:12" or "12",
+// where a bare line refers to the script that is running.
+func (d *debugger) parseLocation(vm *VM, arg string) (string, uint, bool) {
+	file := vm.Frame.lambda.CoreFn.ScriptName
+	lineText := arg
+	if i := strings.LastIndex(arg, ":"); i >= 0 {
+		file, lineText = arg[:i], arg[i+1:]
+	}
+	line, err := strconv.ParseUint(lineText, 10, 32)
+	if err != nil || line == 0 {
+		fmt.Fprintln(d.out, "usage: break [file:]line")
+		return "", 0, false
+	}
+	return file, uint(line), true
+}
+
+func (d *debugger) setBreakpoint(vm *VM, arg string) {
+	file, line, ok := d.parseLocation(vm, arg)
+	if !ok {
+		return
+	}
+	b, ok := resolveBreakpoint(vm.Script, file, line)
+	if !ok {
+		fmt.Fprintf(d.out, "no statement at or after %v:%v\n", file, line)
+		return
+	}
+	if !slices.Contains(d.breakpoints, b) {
+		d.breakpoints = append(d.breakpoints, b)
+	}
+	fmt.Fprintf(d.out, "breakpoint at %v:%v\n", b.script, b.line)
+}
+
+// resolveBreakpoint moves a breakpoint at file:line to the first line
+// at or after it where a statement of that script starts.
+func resolveBreakpoint(script *Script, file string, line uint) (breakpoint, bool) {
+	for name, lines := range statementLines(script) {
+		if !sameScript(name, file) {
+			continue
+		}
+		var next uint
+		for l := range lines {
+			if l >= line && (next == 0 || l < next) {
+				next = l
+			}
+		}
+		if next != 0 {
+			return breakpoint{name, next}, true
+		}
+	}
+	return breakpoint{}, false
+}
+
+func (d *debugger) deleteBreakpoint(vm *VM, arg string) {
+	file, line, ok := d.parseLocation(vm, arg)
+	if !ok {
+		return
+	}
+	n := len(d.breakpoints)
+	d.breakpoints = slices.DeleteFunc(d.breakpoints, func(b breakpoint) bool {
+		return b.line == line && sameScript(b.script, file)
+	})
+	if n == len(d.breakpoints) {
+		fmt.Fprintf(d.out, "no breakpoint at %v:%v\n", file, line)
+	}
+}
+
+// statementLines collects the lines where a statement starts, by script.
+func statementLines(script *Script) map[string]map[uint]struct{} {
+	lines := make(map[string]map[uint]struct{})
+	add := func(fn *CoreFunction) {
+		if fn.debug == nil {
+			return
+		}
+		if lines[fn.ScriptName] == nil {
+			lines[fn.ScriptName] = make(map[uint]struct{})
+		}
+		for _, l := range fn.debug.lines {
+			lines[fn.ScriptName][l] = dummy
+		}
+	}
+	add(script.MainFunction.CoreFn)
+	for _, v := range *script.Konstants {
+		if fn, ok := v.(*CoreFunction); ok {
+			add(fn)
+		}
+	}
+	return lines
+}
+
+func sameScript(script, file string) bool {
+	script, file = filepath.Clean(script), filepath.Clean(file)
+	if script == file || strings.HasSuffix(script, string(filepath.Separator)+file) {
+		return true
+	}
+	a, errA := resolvePath(script)
+	b, errB := resolvePath(file)
+	return errA == nil && errB == nil && a == b
+}
@@ -33,11 +33,7 @@ func PrintBytecode(script *Script, name string) string {
 
 func printHeader(script *Script) string {
 	var sb strings.Builder
-	var major, minor, patch uint64
-	major = script.MainFunction.CoreFn.Code[0] >> 24 & 255
-	minor = script.MainFunction.CoreFn.Code[0] >> 16 & 255
-	patch = script.MainFunction.CoreFn.Code[0] >> 8 & 255
-	sb.WriteString(fmt.Sprintf("Vida Version %v.%v.%v", major, minor, patch))
+	sb.WriteString(fmt.Sprintf("Vida Version %v", scriptVersion(script)))
 	sb.WriteRune(10)
 	sb.WriteRune(10)
 	sb.WriteString("Main\n")
@@ -55,11 +51,7 @@ func printKonstants(konst []Value) string {
 
 func printInstr(instr, ip uint64, isRunningDebug bool) string {
 	var sb strings.Builder
-	var op, A, B, P uint64
-	op = instr >> shift56
-	A = instr >> shift16 & clean16
-	B = instr & clean16
-	P = instr >> shift32 & clean24
+	op, args := decodeInstr(instr)
 	if !isRunningDebug {
 		sb.WriteRune(10)
 		sb.WriteString(fmt.Sprintf("  [%3v]  ", ip))
@@ -67,23 +59,35 @@ func printInstr(instr, ip uint64, isRunningDebug bool) string {
 	} else {
 		sb.WriteString(opcodes[op])
 	}
+	for _, arg := range args {
+		sb.WriteString(fmt.Sprintf(" %3v", arg))
+	}
+	return sb.String()
+}
+
+// decodeInstr returns the opcode of instr and its operands in the order they
+// are shown, with operators by their representation.
+func decodeInstr(instr uint64) (uint64, []any) {
+	var op, A, B, P uint64
+	op = instr >> shift56
+	A = instr >> shift16 & clean16
+	B = instr & clean16
+	P = instr >> shift32 & clean24
 	switch op {
-	case end:
-		return sb.String()
 	case list, slice, iForSet, check, load:
-		sb.WriteString(fmt.Sprintf(" %3v %3v %3v", P, A, B))
+		return op, []any{P, A, B}
 	case forSet, forLoop, iForLoop, fun, ret:
-		sb.WriteString(fmt.Sprintf(" %3v %3v", A, B))
+		return op, []any{A, B}
 	case prefix:
-		sb.WriteString(fmt.Sprintf(" %3v %3v %3v", token.Token(P).String(), A, B))
+		return op, []any{token.Token(P).String(), A, B}
 	case binopG, binop, binopK, binopQ:
-		sb.WriteString(fmt.Sprintf(" %3v %3v %3v %3v", token.Token(P>>shift16).String(), P&clean16, A, B))
+		return op, []any{token.Token(P >> shift16).String(), P & clean16, A, B}
 	case call, store:
-		sb.WriteString(fmt.Sprintf(" %3v %3v %3v %3v", P>>shift16, P&clean16, A, B))
+		return op, []any{P >> shift16, P & clean16, A, B}
 	case object, jump:
-		sb.WriteString(fmt.Sprintf(" %3v", B))
+		return op, []any{B}
 	case iSet, iGet:
-		sb.WriteString(fmt.Sprintf(" %3v %3v %3v %3v %3v", (P>>shift16)>>shift4, P>>shift16&clean8, P&clean16, A, B))
+		return op, []any{(P >> shift16) >> shift4, P >> shift16 & clean8, P & clean16, A, B}
 	case eq:
 		var op token.Token
 		var s byte = byte(P >> shift16)
@@ -94,7 +98,83 @@ func printInstr(instr, ip uint64, isRunningDebug bool) string {
 		}
 		l := s >> shift2 & clean2bits
 		r := s & clean2bits
-		sb.WriteString(fmt.Sprintf(" %3v %3v %3v %3v %3v %3v", op.String(), l, r, P&clean16, A, B))
+		return eq, []any{op.String(), l, r, P & clean16, A, B}
 	}
-	return sb.String()
+	return op, []any{}
+}
+
+func scriptVersion(script *Script) string {
+	var major, minor, patch uint64
+	major = script.MainFunction.CoreFn.Code[0] >> 24 & 255
+	minor = script.MainFunction.CoreFn.Code[0] >> 16 & 255
+	patch = script.MainFunction.CoreFn.Code[0] >> 8 & 255
+	return fmt.Sprintf("%v.%v.%v", major, minor, patch)
+}
+
+// Disassembly is a compiled script decoded for tools, as returned by Disassemble.
+type Disassembly struct {
+	Version   string                 `json:"version"`
+	Main      DisassembledFunction   `json:"main"`
+	Functions []DisassembledFunction `json:"functions"`
+	Konstants []DisassembledKonstant `json:"konstants"`
+}
+
+// DisassembledFunction is a CoreFunction and its code. Konstant is the index
+// of the function among the konstants, or -1 for the main function.
+type DisassembledFunction struct {
+	Konstant   int           `json:"konstant"`
+	ScriptName string        `json:"script"`
+	Arity      int           `json:"arity"`
+	Free       int           `json:"free"`
+	IsVar      bool          `json:"isVar"`
+	Code       []Instruction `json:"code"`
+}
+
+// Instruction is an instruction word decoded as by vida code.
+// Word is the instruction as it is encoded.
+type Instruction struct {
+	IP       int    `json:"ip"`
+	Op       string `json:"op"`
+	Operands []any  `json:"operands"`
+	Word     uint64 `json:"word"`
+}
+
+type DisassembledKonstant struct {
+	Index int    `json:"index"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Disassemble decodes the functions and konstants of script.
+// Its version is the one in the header word of the main function.
+func Disassemble(script *Script) Disassembly {
+	d := Disassembly{
+		Version:   scriptVersion(script),
+		Main:      disassembleFunction(script.MainFunction.CoreFn, -1, 1),
+		Functions: []DisassembledFunction{},
+		Konstants: []DisassembledKonstant{},
+	}
+	for idx, v := range *script.Konstants {
+		if f, ok := v.(*CoreFunction); ok {
+			d.Functions = append(d.Functions, disassembleFunction(f, idx, 0))
+		}
+		d.Konstants = append(d.Konstants, DisassembledKonstant{Index: idx, Type: v.Type(), Value: v.String()})
+	}
+	return d
+}
+
+func disassembleFunction(fn *CoreFunction, konstant, from int) DisassembledFunction {
+	f := DisassembledFunction{
+		Konstant:   konstant,
+		ScriptName: fn.ScriptName,
+		Arity:      fn.Arity,
+		Free:       fn.Free,
+		IsVar:      fn.IsVar,
+		Code:       make([]Instruction, 0, len(fn.Code)),
+	}
+	for ip := from; ip < len(fn.Code); ip++ {
+		op, args := decodeInstr(fn.Code[ip])
+		f.Code = append(f.Code, Instruction{IP: ip, Op: opcodes[op], Operands: args, Word: fn.Code[ip]})
+	}
+	return f
 }
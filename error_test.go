@@ -0,0 +1,103 @@
+package vida
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alkemist-17/vida/verror"
+)
+
+// twoFunctions has two functions that fail at the same instruction of their
+// own code. An error in f must be reported at f's line, not g's.
+const twoFunctions = `var f = fun x {
+    ret x + nil
+}
+
+var g = fun x {
+    ret x + nil
+}
+`
+
+func errorLine(t *testing.T, err error) uint {
+	t.Helper()
+	var vErr verror.VidaError
+	if !errors.As(err, &vErr) {
+		t.Fatalf("expected a VidaError, got %v", err)
+	}
+	return vErr.Line
+}
+
+func writeScript(t *testing.T, name, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestErrorLinePerFunction(t *testing.T) {
+	for _, tc := range []struct {
+		call string
+		line uint
+	}{
+		{"f(1)", 2},
+		{"g(1)", 6},
+	} {
+		i, err := NewInterpreterFromSource("lines.vida", []byte(twoFunctions+tc.call), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = i.Run()
+		if line := errorLine(t, err); line != tc.line {
+			t.Errorf("%v: error reported at line %v, want %v", tc.call, line, tc.line)
+		}
+		if stack := i.CallStack(); len(stack) == 0 || stack[0].Line != tc.line {
+			t.Errorf("%v: call stack %v does not start at line %v", tc.call, stack, tc.line)
+		}
+	}
+}
+
+func TestErrorLinePerFunctionFromBytecode(t *testing.T) {
+	path := writeScript(t, "lines.vida", twoFunctions+"f(1)")
+	b, err := Build(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := NewInterpreterFromSource("lines.vbc", b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = i.Run()
+	if line := errorLine(t, err); line != 2 {
+		t.Errorf("error reported at line %v, want 2", line)
+	}
+}
+
+func TestErrorLinePerTestCase(t *testing.T) {
+	path := writeScript(t, "lines_test.vida", `let test = load("std/test")
+
+test.case("first", fun {
+    ret [1][5]
+})
+
+test.case("second", fun {
+    ret [1][5]
+})
+`)
+	results, err := RunTests(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uint{4, 8}
+	if len(results) != len(want) {
+		t.Fatalf("got %v results, want %v", len(results), len(want))
+	}
+	for k, r := range results {
+		if line := errorLine(t, r.Err); line != want[k] {
+			t.Errorf("%v: error reported at line %v, want %v", r.Name, line, want[k])
+		}
+	}
+}
@@ -0,0 +1,786 @@
+package vida
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/alkemist-17/vida/ast"
+	"github.com/alkemist-17/vida/lexer"
+	"github.com/alkemist-17/vida/token"
+	"github.com/alkemist-17/vida/verror"
+)
+
+const formatIndent = "    "
+
+// formatWidth is the width past which lists, objects and call arguments
+// are written one item per line, and chains of and or or break after
+// every operator.
+const formatWidth = 100
+
+// fComment is a comment of the script being formatted, with its text taken
+// verbatim from the source and where it starts and ends.
+type fComment struct {
+	text    string
+	start   int
+	end     int
+	line    uint
+	endLine uint
+	printed bool
+}
+
+// fItem is a statement, a match arm, an item of a list or a field of an object,
+// which an fPrinter writes on lines of its own along with the comments around it.
+type fItem struct {
+	start   int
+	end     int
+	line    uint
+	endLine uint
+	suffix  string
+	print   func(level int) string
+}
+
+// fPrinter prints a syntax tree back as source. The comments, which the
+// parser drops, are put back before the item they precede, or after the
+// item that ends on their line.
+type fPrinter struct {
+	src      []byte
+	comments []*fComment
+	breaks   int // chains of operators broken over lines, outside of blocks
+}
+
+// Format parses src and prints it back as canonical source. The layout comes
+// from the syntax tree alone: one statement per line, blocks indented by four
+// spaces, single spaces around operators and after commas, and lists, objects
+// and call arguments on one line unless they hold comments or multi-line items,
+// or get too long. Comments are kept, as is a single blank line where src
+// has one or more between two statements.
+// Formatting a formatted script does not change it.
+func Format(src []byte, scriptName string) ([]byte, error) {
+	tree, err := newParser(bytes.Clone(src), scriptName).parse()
+	if err != nil {
+		return nil, err
+	}
+	comments, err := formatComments(src, scriptName)
+	if err != nil {
+		return nil, err
+	}
+	f := &fPrinter{src: src, comments: comments}
+	out := []byte(f.script(tree))
+	formatted, err := newParser(bytes.Clone(out), scriptName).parse()
+	if err != nil || !reflect.DeepEqual(shape(tree), shape(formatted)) {
+		return nil, verror.New(scriptName, "the formatted script does not keep the syntax tree of the original", verror.SyntaxErrType, 0)
+	}
+	kept, err := formatComments(out, scriptName)
+	if err != nil || !slices.Equal(commentPlaces(tree, src, comments), commentPlaces(formatted, out, kept)) {
+		return nil, verror.New(scriptName, "the formatted script does not keep the comments of the original", verror.SyntaxErrType, 0)
+	}
+	return out, nil
+}
+
+func formatComments(src []byte, scriptName string) ([]*fComment, error) {
+	l := lexer.New(bytes.Clone(src), scriptName)
+	var comments []*fComment
+	for {
+		_, tok, _ := l.Next()
+		switch tok {
+		case token.EOF:
+			return comments, nil
+		case token.UNEXPECTED:
+			return nil, l.LexicalError
+		case token.COMMENT:
+			span := l.Span()
+			text := strings.TrimRight(string(src[span.Start.Offset:min(span.End.Offset, len(src))]), " \t\r\n")
+			comments = append(comments, &fComment{
+				text:    text,
+				start:   span.Start.Offset,
+				end:     span.Start.Offset + len(text),
+				line:    span.Start.Line,
+				endLine: span.Start.Line + uint(strings.Count(text, "\n")),
+			})
+		}
+	}
+}
+
+// fPlace is where a comment sits: the block that holds it, counted in the
+// order blocks start, and how many statements of that block end before it.
+type fPlace struct {
+	block int
+	ended int
+	text  string
+}
+
+// commentPlaces returns the places of comments in the script src parsed
+// as tree, sorted so that two scripts keeping every comment in its place
+// have equal places. The body of a function written with => is not a block.
+func commentPlaces(tree *ast.Ast, src []byte, comments []*fComment) []fPlace {
+	type block struct {
+		start, end int
+		items      []fItem
+	}
+	f := &fPrinter{}
+	blocks := []block{{start: -1, end: math.MaxInt, items: f.statements(tree.Statement)}}
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.Interface, reflect.Pointer:
+			if v.IsNil() {
+				return
+			}
+			if b, ok := v.Interface().(*ast.Block); ok && v.Kind() == reflect.Pointer && b.Span.End.Offset > b.Span.Start.Offset && src[b.Span.Start.Offset] == '{' {
+				blocks = append(blocks, block{start: b.Span.Start.Offset, end: b.Span.End.Offset, items: f.statements(b.Statement)})
+			}
+			walk(v.Elem())
+		case reflect.Struct:
+			for i := range v.NumField() {
+				walk(v.Field(i))
+			}
+		case reflect.Slice:
+			for i := range v.Len() {
+				walk(v.Index(i))
+			}
+		}
+	}
+	walk(reflect.ValueOf(tree))
+	places := make([]fPlace, 0, len(comments))
+	for _, c := range comments {
+		p := fPlace{text: c.text}
+		for k, b := range blocks {
+			if b.start < c.start && c.end <= b.end {
+				p.block = k
+			}
+		}
+		for _, item := range blocks[p.block].items {
+			if item.end <= c.start {
+				p.ended++
+			}
+		}
+		places = append(places, p)
+	}
+	slices.SortFunc(places, func(a, b fPlace) int {
+		if a.block != b.block {
+			return a.block - b.block
+		}
+		if a.ended != b.ended {
+			return a.ended - b.ended
+		}
+		return strings.Compare(a.text, b.text)
+	})
+	return places
+}
+
+// shape describes node like ast.Describe does, without the lines and spans,
+// so that two trees compare equal when they only differ in layout.
+func shape(node ast.Node) any {
+	return dropSpans(ast.Describe(node))
+}
+
+func dropSpans(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, x := range v {
+			if k == "line" || strings.HasSuffix(strings.ToLower(k), "span") || strings.HasSuffix(strings.ToLower(k), "spans") {
+				delete(v, k)
+			} else {
+				v[k] = dropSpans(x)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = dropSpans(v[i])
+		}
+	}
+	return v
+}
+
+func (f *fPrinter) script(tree *ast.Ast) string {
+	return f.items(f.statements(tree.Statement), 0, -1, math.MaxInt, 0)
+}
+
+// items writes every item on a line of its own at level, each one after
+// the comments that come before it in the source and followed by the
+// comments on its last line. Only comments between start and end are
+// written, and the ones left before end go last. A comment outside
+// belongs to an outer item.
+// A single blank line stays where the source has one between two items.
+func (f *fPrinter) items(items []fItem, level int, start, end int, line uint) string {
+	var sb strings.Builder
+	prefix := indent(level)
+	first := true
+	newLine := func(at uint) {
+		if !first && at > line+1 {
+			sb.WriteByte('\n')
+		}
+		first = false
+	}
+	writeComment := func(c *fComment) {
+		newLine(c.line)
+		sb.WriteString(prefix)
+		sb.WriteString(c.text)
+		sb.WriteByte('\n')
+		c.printed = true
+		line = c.endLine
+	}
+	for _, item := range items {
+		for _, c := range f.comments {
+			if !c.printed && c.start > start && c.end <= item.start {
+				writeComment(c)
+			}
+		}
+		text := item.print(level)
+		for _, c := range f.comments {
+			if !c.printed && c.start > start && c.start < item.end {
+				writeComment(c)
+			}
+		}
+		newLine(item.line)
+		sb.WriteString(prefix)
+		sb.WriteString(text)
+		sb.WriteString(item.suffix)
+		line = item.endLine
+		for _, c := range f.comments {
+			if !c.printed && c.line == item.endLine && c.start >= item.end && c.end <= end {
+				sb.WriteByte(' ')
+				sb.WriteString(c.text)
+				c.printed = true
+				line = c.endLine
+			}
+		}
+		sb.WriteByte('\n')
+	}
+	for _, c := range f.comments {
+		if !c.printed && c.start > start && c.end <= end {
+			writeComment(c)
+		}
+	}
+	return sb.String()
+}
+
+// hasComments reports whether a comment not yet printed lies between start and end.
+func (f *fPrinter) hasComments(start, end int) bool {
+	for _, c := range f.comments {
+		if !c.printed && start <= c.start && c.end <= end {
+			return true
+		}
+	}
+	return false
+}
+
+func spanItem(span token.Span, print func(level int) string) fItem {
+	return fItem{start: span.Start.Offset, end: span.End.Offset, line: span.Start.Line, endLine: span.End.Line, print: print}
+}
+
+// statements turns a list of statements into items. The parser splits
+// a statement starting with a name and going on with selectors, calls or
+// an assignment into one statement per step, all sharing its start, so
+// they are joined back into one. The statements that the parser adds,
+// which have no span, are left out.
+func (f *fPrinter) statements(stmts []ast.Node) []fItem {
+	var items []fItem
+	for i := 0; i < len(stmts); i++ {
+		ref, ok := stmts[i].(*ast.ReferenceStmt)
+		if !ok {
+			span := nodeSpan(stmts[i])
+			if span == (token.Span{}) {
+				continue
+			}
+			n := stmts[i]
+			items = append(items, spanItem(span, func(level int) string { return f.statement(n, level) }))
+			continue
+		}
+		k := i + 1
+		for k < len(stmts) && isStep(stmts[k]) && nodeSpan(stmts[k]).Start.Offset == ref.Span.Start.Offset {
+			k++
+		}
+		steps := stmts[i+1 : k]
+		span := ref.Span
+		if len(steps) > 0 {
+			span.End = nodeSpan(steps[len(steps)-1]).End
+		}
+		items = append(items, spanItem(span, func(level int) string { return f.steps(ref, steps, level) }))
+		i = k - 1
+	}
+	return items
+}
+
+func isStep(n ast.Node) bool {
+	switch n.(type) {
+	case *ast.IGetStmt, *ast.SelectStmt, *ast.CallStmt, *ast.MethodCallStmt, *ast.ISet:
+		return true
+	}
+	return false
+}
+
+func (f *fPrinter) steps(ref *ast.ReferenceStmt, steps []ast.Node, level int) string {
+	var sb strings.Builder
+	sb.WriteString(ref.Value)
+	for _, step := range steps {
+		switch n := step.(type) {
+		case *ast.IGetStmt:
+			sb.WriteString("[" + f.expr(n.Index, level) + "]")
+		case *ast.SelectStmt:
+			sb.WriteString("." + n.Selector.(*ast.Property).Value)
+		case *ast.CallStmt:
+			sb.WriteString(f.args(n.Args, n.Ellipsis, level))
+		case *ast.MethodCallStmt:
+			sb.WriteString(token.METHOD_CALL.String() + n.Prop.(*ast.Property).Value + f.args(n.Args, n.Ellipsis, level))
+		case *ast.ISet:
+			if p, ok := n.Index.(*ast.Property); ok {
+				sb.WriteString("." + p.Value)
+			} else {
+				sb.WriteString("[" + f.expr(n.Index, level) + "]")
+			}
+			sb.WriteString(" " + n.Op.String() + " " + f.expr(n.Expr, level))
+		}
+	}
+	return sb.String()
+}
+
+func (f *fPrinter) statement(node ast.Node, level int) string {
+	switch n := node.(type) {
+	case *ast.Let:
+		return "let " + n.Identifier + " = " + f.expr(n.Expr, level)
+	case *ast.Var:
+		if n.IsRecursive {
+			return "var rec " + n.Identifier + " = " + f.expr(n.Expr, level)
+		}
+		return "var " + n.Identifier + " = " + f.expr(n.Expr, level)
+	case *ast.Mut:
+		return n.Identifier + " " + n.Op.String() + " " + f.expr(n.Expr, level)
+	case *ast.Destructure:
+		return n.Decl.String() + " " + f.pattern(n.Pattern, level) + " = " + f.expr(n.Expr, level)
+	case *ast.Branch:
+		s := "if " + f.expr(n.If.(*ast.If).Condition, level) + " " + f.block(n.If.(*ast.If).Block, level, 0)
+		for _, e := range n.Elifs {
+			elif := e.(*ast.If)
+			s += " else if " + f.expr(elif.Condition, level) + " " + f.block(elif.Block, level, 0)
+		}
+		if n.Else != nil {
+			s += " else " + f.block(n.Else.(*ast.Else).Block, level, 0)
+		}
+		return s
+	case *ast.For:
+		s := "for " + n.Id + " in "
+		if isImplicit(n.Init) {
+			s += f.expr(n.End, level)
+		} else {
+			s += f.expr(n.Init, level) + ", " + f.expr(n.End, level)
+			if !isImplicit(n.Step) {
+				s += ", " + f.expr(n.Step, level)
+			}
+		}
+		return s + " " + f.block(n.Block, level, 0)
+	case *ast.IFor:
+		if n.Key == "*_" {
+			return "for in " + f.expr(n.Expr, level) + " " + f.block(n.Block, level, 0)
+		}
+		if n.ValueSpan == (token.Span{}) {
+			target := n.Block.(*ast.Block).Statement[0].(*ast.Destructure).Pattern
+			return "for " + n.Key + ", " + f.pattern(target, level) + " in " + f.expr(n.Expr, level) + " " + f.block(n.Block, level, 1)
+		}
+		return "for " + n.Key + ", " + n.Value + " in " + f.expr(n.Expr, level) + " " + f.block(n.Block, level, 0)
+	case *ast.While:
+		return "while " + f.expr(n.Condition, level) + " " + f.block(n.Block, level, 0)
+	case *ast.Match:
+		var arms []fItem
+		for _, arm := range n.Arms {
+			arms = append(arms, spanItem(arm.Span, func(level int) string { return f.arm(arm, level) }))
+		}
+		return "match " + f.expr(n.Subject, level) + " {\n" + f.items(arms, level+1, n.Span.Start.Offset, n.Span.End.Offset-1, n.Span.Start.Line) + indent(level) + "}"
+	case *ast.Block:
+		return f.block(n, level, 0)
+	case *ast.Ret:
+		return "ret " + f.expr(n.Expr, level)
+	case *ast.Break:
+		return "break"
+	case *ast.Continue:
+		return "continue"
+	case *ast.Export:
+		return "export " + f.expr(n.Expr, level)
+	}
+	return ""
+}
+
+// arm writes an arm of a match. A block with a single statement
+// stays on the line of its pattern when it fits there.
+func (f *fPrinter) arm(arm *ast.MatchArm, level int) string {
+	s := f.pattern(arm.Pattern, level)
+	if arm.Guard != nil {
+		s += " if " + f.expr(arm.Guard, level)
+	}
+	s += " => "
+	b := arm.Block.(*ast.Block)
+	if items := f.statements(b.Statement); len(items) == 1 && !f.hasComments(b.Span.Start.Offset, b.Span.End.Offset) {
+		breaks := f.breaks
+		stmt := items[0].print(level)
+		f.breaks = breaks
+		if line := s + "{ " + stmt + " }"; !strings.Contains(stmt, "\n") && fits(level, line) {
+			return line
+		}
+	}
+	return s + f.block(b, level, 0)
+}
+
+// block writes b with its statements one level deeper than level, leaving
+// out the first skip of them, which the parser adds to destructure a
+// parameter or the value of a loop.
+func (f *fPrinter) block(node ast.Node, level int, skip int) string {
+	b := node.(*ast.Block)
+	start, end := b.Span.Start.Offset, b.Span.End.Offset-1
+	items := f.statements(b.Statement[skip:])
+	if len(items) == 0 && !f.hasComments(start, end) {
+		return "{}"
+	}
+	open := "{"
+	for _, c := range f.comments {
+		if len(items) == 0 {
+			break
+		}
+		if !c.printed && c.start > start && c.end <= items[0].start && c.line == b.Span.Start.Line {
+			open += " " + c.text
+			c.printed = true
+		}
+	}
+	breaks := f.breaks
+	body := f.items(items, level+1, start, end, b.Span.Start.Line)
+	f.breaks = breaks
+	return open + "\n" + body + indent(level) + "}"
+}
+
+func (f *fPrinter) expr(node ast.Node, level int) string {
+	switch n := node.(type) {
+	case *ast.Reference:
+		return n.Value
+	case *ast.Integer:
+		if s, ok := f.literal(n.Span); ok {
+			return s
+		}
+		return strconv.FormatInt(n.Value, 10)
+	case *ast.Float:
+		if s, ok := f.literal(n.Span); ok {
+			return s
+		}
+		return strconv.FormatFloat(n.Value, 'g', -1, 64)
+	case *ast.String:
+		if s, ok := f.literal(n.Span); ok {
+			return s
+		}
+		return strconv.Quote(n.Value)
+	case *ast.Boolean:
+		return strconv.FormatBool(n.Value)
+	case *ast.Nil:
+		return "nil"
+	case *ast.List:
+		var items []fItem
+		for _, e := range n.ExprList {
+			items = append(items, spanItem(nodeSpan(e), func(level int) string { return f.expr(e, level) }))
+		}
+		return f.group("[", "]", items, n.Span, level, false)
+	case *ast.Object:
+		var items []fItem
+		for _, pair := range n.Pairs {
+			items = append(items, spanItem(pair.Span, func(level int) string { return f.pair(pair, level) }))
+		}
+		return f.group("{", "}", items, n.Span, level, true)
+	case *ast.PrefixExpr:
+		operand := f.operand(n.Expr, level)
+		if n.Op == token.NOT {
+			return "not " + operand
+		}
+		if n.Op == token.SUB && strings.HasPrefix(operand, "-") {
+			return "- " + operand
+		}
+		return n.Op.String() + operand
+	case *ast.BinaryExpr:
+		return f.binary(n, level)
+	case *ast.IGet:
+		return f.operand(n.Indexable, level) + "[" + f.expr(n.Index, level) + "]"
+	case *ast.Slice:
+		s := f.operand(n.Value, level) + "["
+		if n.First != nil {
+			s += f.expr(n.First, level)
+		}
+		s += ".."
+		if n.Last != nil {
+			s += f.expr(n.Last, level)
+		}
+		return s + "]"
+	case *ast.Select:
+		return f.operand(n.Selectable, level) + "." + n.Selector.(*ast.Property).Value
+	case *ast.CallExpr:
+		return f.operand(n.Fun, level) + f.args(n.Args, n.Ellipsis, level)
+	case *ast.MethodCallExpr:
+		return f.operand(n.Obj, level) + token.METHOD_CALL.String() + n.Prop.(*ast.Property).Value + f.args(n.Args, n.Ellipsis, level)
+	case *ast.Fun:
+		return f.fun(n, level)
+	case *ast.Import:
+		return "import(" + strconv.Quote(strings.TrimSuffix(n.Path, vidaFileExtension)) + ")"
+	case *ast.Enum:
+		s := "enum { " + n.Variants[0]
+		if n.HasInitVal {
+			s += " = " + strconv.FormatInt(n.Init, 10)
+		}
+		for _, v := range n.Variants[1:] {
+			s += " " + v
+		}
+		return s + " }"
+	}
+	return ""
+}
+
+// literal returns the text of a literal as written in the source,
+// so that numbers keep their base and strings their quotes.
+func (f *fPrinter) literal(span token.Span) (string, bool) {
+	if span.End.Offset <= span.Start.Offset || span.End.Offset > len(f.src) {
+		return "", false
+	}
+	return string(f.src[span.Start.Offset:span.End.Offset]), true
+}
+
+// operand writes node where only a primary expression fits, as before
+// a selector or after a prefix operator, wrapping it in parentheses otherwise.
+func (f *fPrinter) operand(node ast.Node, level int) string {
+	switch node.(type) {
+	case *ast.BinaryExpr, *ast.PrefixExpr, *ast.Fun:
+		return "(" + f.expr(node, level) + ")"
+	}
+	return f.expr(node, level)
+}
+
+// binary writes a chain of operators of the same precedence, adding the
+// parentheses the tree needs. A chain of and or or that does not fit
+// on a line breaks after every operator.
+func (f *fPrinter) binary(n *ast.BinaryExpr, level int) string {
+	prec := n.Op.Precedence()
+	chain := []ast.Node{n.Rhs}
+	ops := []token.Token{n.Op}
+	lhs := n.Lhs
+	for {
+		l, ok := lhs.(*ast.BinaryExpr)
+		if !ok || l.Op.Precedence() != prec {
+			break
+		}
+		chain = append(chain, l.Rhs)
+		ops = append(ops, l.Op)
+		lhs = l.Lhs
+	}
+	chain = append(chain, lhs)
+	slices.Reverse(chain)
+	slices.Reverse(ops)
+	operands := make([]string, len(chain))
+	for i, e := range chain {
+		operands[i] = f.side(e, prec, i > 0, level)
+	}
+	var sb strings.Builder
+	sb.WriteString(operands[0])
+	for i, op := range ops {
+		sb.WriteString(" " + op.String() + " " + operands[i+1])
+	}
+	s := sb.String()
+	if (n.Op != token.AND && n.Op != token.OR) || strings.Contains(s, "\n") || fits(level, s) {
+		return s
+	}
+	f.breaks++
+	sb.Reset()
+	sb.WriteString(operands[0])
+	for i, op := range ops {
+		sb.WriteString(" " + op.String() + "\n" + indent(level+1) + operands[i+1])
+	}
+	return sb.String()
+}
+
+// side writes an operand of a binary operator of precedence prec. The right
+// operand needs parentheses for the same precedence, since operators group
+// to the left, and a short function takes all that follows as its body.
+func (f *fPrinter) side(node ast.Node, prec int, right bool, level int) string {
+	switch n := node.(type) {
+	case *ast.BinaryExpr:
+		if p := n.Op.Precedence(); p < prec || right && p == prec {
+			return "(" + f.expr(n, level) + ")"
+		}
+	case *ast.Fun:
+		if isArrow(n) {
+			return "(" + f.expr(n, level) + ")"
+		}
+	}
+	return f.expr(node, level)
+}
+
+// args writes the arguments of a call, one per line when they do not fit
+// on the line of the call. The argument given by ellipsis is spread.
+func (f *fPrinter) args(args []ast.Node, ellipsis int, level int) string {
+	text := func(level int) []string {
+		xs := make([]string, len(args))
+		for i, a := range args {
+			xs[i] = f.expr(a, level)
+			if ellipsis == ellipsisFirst && i == 0 || ellipsis == ellipsisLast && i == len(args)-1 {
+				xs[i] = token.ELLIPSIS.String() + xs[i]
+			}
+		}
+		return xs
+	}
+	printed, breaks := f.mark(), f.breaks
+	s := "(" + strings.Join(text(level), ", ") + ")"
+	if f.breaks == breaks && (strings.Contains(s, "\n") || fits(level, s)) {
+		return s
+	}
+	f.reset(printed)
+	return "(\n" + indent(level+1) + strings.Join(text(level+1), ",\n"+indent(level+1)) + "\n" + indent(level) + ")"
+}
+
+// mark returns which comments have been printed, for reset to
+// forget the ones printed after it when a part is printed again.
+func (f *fPrinter) mark() []bool {
+	printed := make([]bool, len(f.comments))
+	for i, c := range f.comments {
+		printed[i] = c.printed
+	}
+	return printed
+}
+
+func (f *fPrinter) reset(printed []bool) {
+	for i, c := range f.comments {
+		c.printed = printed[i]
+	}
+}
+
+// group writes the items of a list or an object between open and close, on
+// one line when they fit there and no comment or multi-line item is among
+// them, and one per line followed by a comma otherwise.
+func (f *fPrinter) group(open, close string, items []fItem, span token.Span, level int, spaced bool) string {
+	if len(items) == 0 && !f.hasComments(span.Start.Offset, span.End.Offset) {
+		return open + close
+	}
+	if !f.hasComments(span.Start.Offset, span.End.Offset) {
+		xs := make([]string, len(items))
+		multiline := false
+		for i, item := range items {
+			xs[i] = item.print(level + 1)
+			multiline = multiline || strings.Contains(xs[i], "\n")
+		}
+		s := strings.Join(xs, ", ")
+		if spaced {
+			s = " " + s + " "
+		}
+		if s = open + s + close; !multiline && fits(level, s) {
+			return s
+		}
+		for i := range items {
+			x := xs[i]
+			items[i].print = func(int) string { return x }
+		}
+	}
+	for i := range items {
+		items[i].suffix = ","
+	}
+	return open + "\n" + f.items(items, level+1, span.Start.Offset, span.End.Offset-1, span.Start.Line) + indent(level) + close
+}
+
+func (f *fPrinter) pair(pair *ast.Pair, level int) string {
+	key := pair.Key.(*ast.Property).Value
+	if n, ok := pair.Value.(*ast.Nil); ok && n.Span == (token.Span{}) {
+		return key
+	}
+	return key + " = " + f.expr(pair.Value, level)
+}
+
+// fun writes a function. A parameter with a hidden name stands for the
+// list or object the parser destructures at the start of the body.
+func (f *fPrinter) fun(n *ast.Fun, level int) string {
+	b := n.Body.(*ast.Block)
+	skip := 0
+	params := make([]string, len(n.Args))
+	for i, arg := range n.Args {
+		params[i] = arg
+		if strings.HasPrefix(arg, "*") {
+			params[i] = f.pattern(b.Statement[skip].(*ast.Destructure).Pattern, level)
+			skip++
+		}
+	}
+	if n.IsVar {
+		params[len(params)-1] += token.ELLIPSIS.String()
+	}
+	s := "fun"
+	if len(params) > 0 {
+		s += " " + strings.Join(params, ", ")
+	}
+	if isArrow(n) {
+		return s + " => " + f.expr(b.Statement[len(b.Statement)-1].(*ast.Ret).Expr, level)
+	}
+	return s + " " + f.block(b, level, skip)
+}
+
+func (f *fPrinter) pattern(node ast.Node, level int) string {
+	switch n := node.(type) {
+	case *ast.Wildcard:
+		return "_"
+	case *ast.BindPattern:
+		return n.Identifier
+	case *ast.ValuePattern:
+		return f.expr(n.Value, level)
+	case *ast.ListPattern:
+		xs := make([]string, 0, len(n.Elements)+1)
+		for _, e := range n.Elements {
+			xs = append(xs, f.pattern(e, level))
+		}
+		if n.Rest != nil {
+			xs = append(xs, token.ELLIPSIS.String()+f.pattern(n.Rest, level))
+		}
+		return "[" + strings.Join(xs, ", ") + "]"
+	case *ast.ObjectPattern:
+		xs := make([]string, 0, len(n.Fields))
+		for _, field := range n.Fields {
+			s := field.Key
+			if b, ok := field.Pattern.(*ast.BindPattern); !ok || b.Identifier != field.Key {
+				s += ": " + f.pattern(field.Pattern, level)
+			}
+			if field.Default != nil {
+				s += " = " + f.expr(field.Default, level)
+			}
+			xs = append(xs, s)
+		}
+		if len(xs) == 0 {
+			return "{}"
+		}
+		return "{ " + strings.Join(xs, ", ") + " }"
+	}
+	return ""
+}
+
+// isArrow reports whether n was written with => and an expression as its body.
+// A body in braces ends with the ret nil the parser adds, which has no span.
+func isArrow(n *ast.Fun) bool {
+	b := n.Body.(*ast.Block)
+	r, ok := b.Statement[len(b.Statement)-1].(*ast.Ret)
+	return ok && r.Span != (token.Span{})
+}
+
+// isImplicit reports whether node is a number the parser filled in,
+// like the start and the step of a loop over a range.
+func isImplicit(node ast.Node) bool {
+	n, ok := node.(*ast.Integer)
+	return ok && n.Span == (token.Span{})
+}
+
+func fits(level int, s string) bool {
+	return level*len(formatIndent)+len(s) <= formatWidth
+}
+
+func indent(level int) string {
+	return strings.Repeat(formatIndent, level)
+}
+
+// nodeSpan returns the span of node, or the zero span for nodes without one.
+func nodeSpan(node ast.Node) token.Span {
+	v := reflect.ValueOf(node)
+	if !v.IsValid() || v.IsNil() {
+		return token.Span{}
+	}
+	if span := v.Elem().FieldByName("Span"); span.IsValid() {
+		return span.Interface().(token.Span)
+	}
+	return token.Span{}
+}
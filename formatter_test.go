@@ -0,0 +1,81 @@
+package vida
+
+import "testing"
+
+// canonical is the formatted form of layouts, which all write the same program.
+const canonical = `// squares
+let xs = [1, 2, 3]
+let o = { a = 1, b, c = fun x => x * (2 + 3) } // shorthand b
+
+var rec f = fun n {
+    if n == 0 {
+        ret 0
+    } else {
+        ret f(n - 1)
+    }
+}
+for i in 0, 10, 2 {
+    print(i)
+}
+`
+
+var layouts = []string{
+	canonical,
+	`// squares
+let xs = [
+  1,
+  2, 3,
+]
+let o = {
+    a = 1
+    b c = fun x => x * ((2 + 3))
+} // shorthand b
+
+
+var rec f = fun n { if n == 0 { ret 0 }
+  else { ret f(n-1) } }
+for i in 0,10,2 {
+print(i)
+}
+`,
+}
+
+func TestFormatIgnoresLayout(t *testing.T) {
+	for k, src := range layouts {
+		out, err := Format([]byte(src), "layout.vida")
+		if err != nil {
+			t.Fatalf("layout %v: %v", k, err)
+		}
+		if string(out) != canonical {
+			t.Errorf("layout %v formats as\n%v\nwant\n%v", k, string(out), canonical)
+		}
+	}
+}
+
+func TestFormatKeepsComments(t *testing.T) {
+	src := "let xs = [1, // one\n    2]\nfor in 3 { // loop\n    print(xs) /* after */\n}\n// last\n"
+	want := "let xs = [\n    1, // one\n    2,\n]\nfor in 3 { // loop\n    print(xs) /* after */\n}\n// last\n"
+	out, err := Format([]byte(src), "comments.vida")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != want {
+		t.Errorf("got\n%v\nwant\n%v", string(out), want)
+	}
+	again, err := Format(out, "comments.vida")
+	if err != nil || string(again) != string(out) {
+		t.Errorf("formatting the output again changed it:\n%v", string(again))
+	}
+}
+
+func TestFormatKeepsTrailingCommentOnStatement(t *testing.T) {
+	src := "if x == 1 { print(1) } else { print(2) } // tail\nprint(3)\n"
+	want := "if x == 1 {\n    print(1)\n} else {\n    print(2)\n} // tail\nprint(3)\n"
+	out, err := Format([]byte(src), "tail.vida")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != want {
+		t.Errorf("got\n%v\nwant\n%v", string(out), want)
+	}
+}
@@ -1,10 +1,6 @@
 package vida
 
-import (
-	"fmt"
-
-	"github.com/alkemist-17/vida/verror"
-)
+import "github.com/alkemist-17/vida/verror"
 
 func loadFoundationException() Value {
 	m := &Object{Value: make(map[string]Value)}
@@ -15,9 +11,7 @@ func loadFoundationException() Value {
 
 func riseException(args ...Value) (Value, error) {
 	if len(args) > 0 {
-		err := fmt.Errorf("%s", fmt.Sprintf("\n\n  [%v]\n   Message : %v\n\n", verror.ExceptionErrType, args[0].String()))
-		return NilValue, err
+		return NilValue, verror.New("", args[0].String(), verror.ExceptionErrType, 0)
 	}
-	err := fmt.Errorf("%s", fmt.Sprintf("\n\n  [%v]\n\n", verror.ExceptionErrType))
-	return NilValue, err
+	return NilValue, verror.New("", "", verror.ExceptionErrType, 0)
 }
@@ -0,0 +1,141 @@
+package vida
+
+import (
+	"sort"
+
+	"github.com/alkemist-17/vida/token"
+)
+
+func loadFoundationFunctional() Value {
+	m := &Object{Value: make(map[string]Value)}
+	m.Value["map"] = NFn(fnMap)
+	m.Value["filter"] = NFn(fnFilter)
+	m.Value["reduce"] = NFn(fnReduce)
+	m.Value["sort"] = NFn(fnSort)
+	m.Value["all"] = NFn(fnAll)
+	m.Value["any"] = NFn(fnAny)
+	m.UpdateKeys()
+	return m
+}
+
+func fnMap(vm *VM, args ...Value) (Value, error) {
+	if len(args) > 1 {
+		if xs, ok := args[0].(*List); ok {
+			ys := make([]Value, len(xs.Value))
+			for i, v := range xs.Value {
+				val, err := vm.Call(args[1], v)
+				if err != nil {
+					return NilValue, err
+				}
+				ys[i] = val
+			}
+			return &List{Value: ys}, nil
+		}
+	}
+	return NilValue, nil
+}
+
+func fnFilter(vm *VM, args ...Value) (Value, error) {
+	if len(args) > 1 {
+		if xs, ok := args[0].(*List); ok {
+			var ys []Value
+			for _, v := range xs.Value {
+				val, err := vm.Call(args[1], v)
+				if err != nil {
+					return NilValue, err
+				}
+				if val.Boolean() {
+					ys = append(ys, v)
+				}
+			}
+			return &List{Value: ys}, nil
+		}
+	}
+	return NilValue, nil
+}
+
+func fnReduce(vm *VM, args ...Value) (Value, error) {
+	if len(args) > 1 {
+		if xs, ok := args[0].(*List); ok {
+			var acc Value = NilValue
+			values := xs.Value
+			if len(args) > 2 {
+				acc = args[2]
+			} else if len(values) > 0 {
+				acc = values[0]
+				values = values[1:]
+			}
+			for _, v := range values {
+				val, err := vm.Call(args[1], acc, v)
+				if err != nil {
+					return NilValue, err
+				}
+				acc = val
+			}
+			return acc, nil
+		}
+	}
+	return NilValue, nil
+}
+
+func fnSort(vm *VM, args ...Value) (Value, error) {
+	if len(args) > 0 {
+		if xs, ok := args[0].(*List); ok {
+			var err error
+			less := func(i, j int) bool {
+				if err != nil {
+					return false
+				}
+				var val Value
+				if len(args) > 1 {
+					val, err = vm.Call(args[1], xs.Value[i], xs.Value[j])
+				} else {
+					val, err = xs.Value[i].Binop(uint64(token.LT), xs.Value[j])
+				}
+				return err == nil && bool(val.Boolean())
+			}
+			sort.SliceStable(xs.Value, less)
+			if err != nil {
+				return NilValue, err
+			}
+			return xs, nil
+		}
+	}
+	return NilValue, nil
+}
+
+func fnAll(vm *VM, args ...Value) (Value, error) {
+	if len(args) > 1 {
+		if xs, ok := args[0].(*List); ok {
+			for _, v := range xs.Value {
+				val, err := vm.Call(args[1], v)
+				if err != nil {
+					return NilValue, err
+				}
+				if !val.Boolean() {
+					return Bool(false), nil
+				}
+			}
+			return Bool(true), nil
+		}
+	}
+	return NilValue, nil
+}
+
+func fnAny(vm *VM, args ...Value) (Value, error) {
+	if len(args) > 1 {
+		if xs, ok := args[0].(*List); ok {
+			for _, v := range xs.Value {
+				val, err := vm.Call(args[1], v)
+				if err != nil {
+					return NilValue, err
+				}
+				if val.Boolean() {
+					return Bool(true), nil
+				}
+			}
+			return Bool(false), nil
+		}
+	}
+	return NilValue, nil
+}
@@ -3,6 +3,7 @@ package vida
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"reflect"
 	"strings"
@@ -14,18 +15,12 @@ var NilValue = Nil{}
 
 type LibsLoader map[string]func() Value
 
-type ErrorInfo map[string]map[int]uint
-
-var extensionlibsLoader LibsLoader
-
 const mainThIndex = 0
 
 const DefaultInputPrompt = "Input > "
 
 const foundationInterfaceName = "std/"
 
-var clbu *[]Value
-
 var coreLibNames = []string{
 	"--mt--",
 	"print",
@@ -46,11 +41,11 @@ var coreLibNames = []string{
 func loadCoreLib(store *[]Value) *[]Value {
 	*store = append(*store,
 		NilValue,
-		GFn(gfnPrint),
+		gfnPrint(store),
 		GFn(gfnLen),
 		GFn(gfnAppend),
 		GFn(gfnMakeList),
-		GFn(gfnLoadLib),
+		gfnLoadLib(store),
 		GFn(gfnType),
 		GFn(gfnAssert),
 		GFn(gfnFormat),
@@ -63,13 +58,20 @@ func loadCoreLib(store *[]Value) *[]Value {
 	return store
 }
 
-func gfnPrint(args ...Value) (Value, error) {
-	var s []any
-	for _, v := range args {
-		s = append(s, v)
+// gfnPrint returns print, which writes to the output of the main thread.
+func gfnPrint(store *[]Value) GFn {
+	return func(args ...Value) (Value, error) {
+		var s []any
+		for _, v := range args {
+			s = append(s, v)
+		}
+		var out io.Writer = os.Stdout
+		if main, ok := (*store)[mainThIndex].(*Thread); ok && main.output != nil {
+			out = main.output
+		}
+		fmt.Fprintln(out, s...)
+		return NilValue, nil
 	}
-	fmt.Fprintln(os.Stdout, s...)
-	return NilValue, nil
 }
 
 func gfnLen(args ...Value) (Value, error) {
@@ -115,16 +117,13 @@ func gfnAssert(args ...Value) (Value, error) {
 		if args[0].Boolean() {
 			return NilValue, nil
 		}
-		err := fmt.Errorf("%s", fmt.Sprintf("\n\n  [%v]\n   Message : %v\n\n", verror.AssertionErrType, "Generic Assertion Failure Message"))
-		return NilValue, err
+		return NilValue, verror.New("", "Generic Assertion Failure Message", verror.AssertionErrType, 0)
 	}
 	if argsLength > 1 {
 		if args[0].Boolean() {
 			return NilValue, nil
 		}
-		err := fmt.Errorf("%s", fmt.Sprintf("\n\n  [%v]\n   Message : %v\n\n", verror.AssertionErrType, args[1].String()))
-		return NilValue, err
-
+		return NilValue, verror.New("", args[1].String(), verror.AssertionErrType, 0)
 	}
 	return NilValue, nil
 }
@@ -207,44 +206,62 @@ func gfnClone(args ...Value) (Value, error) {
 	return NilValue, nil
 }
 
-func gfnLoadLib(args ...Value) (Value, error) {
+func gfnLoadLib(store *[]Value) GFn {
+	return func(args ...Value) (Value, error) {
+		return loadLib(store, args...)
+	}
+}
+
+func loadLib(store *[]Value, args ...Value) (Value, error) {
 	if len(args) > 0 {
 		if v, ok := args[0].(*String); ok {
-			if strings.HasPrefix(v.Value, foundationInterfaceName) {
-				switch v.Value[len(foundationInterfaceName):] {
-				case "text":
-					return loadFoundationText(), nil
-				case "math":
-					return loadFoundationMath(), nil
-				case "bin":
-					return loadFoundationBinary(), nil
-				case "time":
-					return loadFoundationTime(), nil
-				case "cast":
-					return loadFoundationCasting(), nil
-				case "rand":
-					return loadFoundationRandom(), nil
-				case "io":
-					return loadFoundationIO(), nil
-				case "os":
-					return loadFoundationOS(), nil
-				case "exception":
-					return loadFoundationException(), nil
-				case "net":
-					return loadFoundationNetworkIO(), nil
-				case "co":
-					return loadFoundationCoroutine(), nil
-				case "core":
-					return loadFoundationCorelib(), nil
-				}
-			} else if l, isPresent := extensionlibsLoader[v.Value]; isPresent {
-				return l(), nil
+			main := (*store)[mainThIndex].(*Thread)
+			if l := libLoader(store, main.libsLoader, v.Value); l != nil {
+				return main.sandbox.load(v.Value, l)
 			}
 		}
 	}
 	return NilValue, nil
 }
 
+func libLoader(store *[]Value, libsLoader LibsLoader, name string) func() Value {
+	if strings.HasPrefix(name, foundationInterfaceName) {
+		switch name[len(foundationInterfaceName):] {
+		case "text":
+			return loadFoundationText
+		case "math":
+			return loadFoundationMath
+		case "bin":
+			return loadFoundationBinary
+		case "time":
+			return loadFoundationTime
+		case "cast":
+			return loadFoundationCasting
+		case "rand":
+			return loadFoundationRandom
+		case "io":
+			return loadFoundationIO
+		case "os":
+			return func() Value { return loadFoundationOS(store) }
+		case "exception":
+			return loadFoundationException
+		case "net":
+			return loadFoundationNetworkIO
+		case "co":
+			return func() Value { return loadFoundationCoroutine(store) }
+		case "fn":
+			return loadFoundationFunctional
+		case "core":
+			return func() Value { return loadFoundationCorelib(store) }
+		case "test":
+			return func() Value { return loadFoundationTest(store) }
+		}
+	} else if l, isPresent := libsLoader[name]; isPresent {
+		return l
+	}
+	return nil
+}
+
 func gfnError(args ...Value) (Value, error) {
 	if len(args) > 0 {
 		return Error{Message: args[0]}, nil
@@ -321,17 +338,64 @@ func gfnCopy(args ...Value) (Value, error) {
 	return NilValue, nil
 }
 
+// DeepEqual compares lists and objects by their contents,
+// and any other value with Equals or else by its Go representation.
 func DeepEqual(args ...Value) (Value, error) {
 	if len(args) > 1 {
-		return Bool(reflect.DeepEqual(args[0], args[1])), nil
+		return Bool(deepEqual(args[0], args[1])), nil
 	}
 	return NilValue, nil
 }
 
-func loadFoundationCorelib() Value {
+func deepEqual(a, b Value) bool {
+	return deepEqualVisited(a, b, make(map[[2]Value]bool))
+}
+
+// deepEqualVisited compares lists and objects by their items. A pair of
+// containers already being compared is taken as equal, as reflect.DeepEqual
+// does, so that comparing values that hold themselves ends.
+func deepEqualVisited(a, b Value, visited map[[2]Value]bool) bool {
+	switch x := a.(type) {
+	case *List:
+		y, ok := b.(*List)
+		if !ok || len(x.Value) != len(y.Value) {
+			return false
+		}
+		if x == y || visited[[2]Value{x, y}] {
+			return true
+		}
+		visited[[2]Value{x, y}] = true
+		for i := range x.Value {
+			if !deepEqualVisited(x.Value[i], y.Value[i], visited) {
+				return false
+			}
+		}
+		return true
+	case *Object:
+		y, ok := b.(*Object)
+		if !ok || len(x.Value) != len(y.Value) {
+			return false
+		}
+		if x == y || visited[[2]Value{x, y}] {
+			return true
+		}
+		visited[[2]Value{x, y}] = true
+		for k, v := range x.Value {
+			w, ok := y.Value[k]
+			if !ok || !deepEqualVisited(v, w, visited) {
+				return false
+			}
+		}
+		return true
+	default:
+		return bool(a.Equals(b)) || reflect.DeepEqual(a, b)
+	}
+}
+
+func loadFoundationCorelib(store *[]Value) Value {
 	m := &Object{Value: make(map[string]Value)}
-	for i := 0; i < len((*clbu)); i++ {
-		m.Value[coreLibNames[i]] = (*clbu)[i]
+	for i := 0; i < len(coreLibNames); i++ {
+		m.Value[coreLibNames[i]] = (*store)[i]
 	}
 	m.UpdateKeys()
 	return m
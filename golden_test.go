@@ -0,0 +1,65 @@
+package vida
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alkemist-17/vida/ast"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// goldenSource is the program whose syntax tree and compiled code
+// are kept as JSON in testdata.
+const goldenSource = "let add = fun a, b {\n    ret a + b\n}\nvar xs = [add(1, 2)]\n"
+
+// golden compares v encoded as JSON with the file name in testdata,
+// or rewrites the file when the tests run with -update.
+func golden(t *testing.T, name string, v any) {
+	t.Helper()
+	got, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%v does not match, got\n%s", path, got)
+	}
+}
+
+func TestDescribeGolden(t *testing.T) {
+	tree, err := newParser([]byte(goldenSource), "golden.vida").parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "golden.ast.json", ast.Describe(tree))
+}
+
+func TestDisassembleGolden(t *testing.T) {
+	script, _, err := compileSource([]byte(goldenSource), "golden.vida", "", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := Disassemble(script)
+	if want := fmt.Sprintf("%v.%v.%v", major, minor, patch); code.Version != want {
+		t.Errorf("version = %v, want %v", code.Version, want)
+	}
+	code.Version = ""
+	golden(t, "golden.code.json", code)
+}
@@ -1,32 +1,64 @@
 package vida
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/alkemist-17/vida/ast"
 	"github.com/alkemist-17/vida/lexer"
 	"github.com/alkemist-17/vida/token"
+	"github.com/alkemist-17/vida/verror"
 )
 
+// An Interpreter owns all of the state of a single script run: its store,
+// konstants, threads and extension libs. Separate Interpreters share nothing
+// and may run concurrently on different goroutines. A single Interpreter must
+// not be used from more than one goroutine at a time.
 type Interpreter struct {
-	parser   *parser
-	compiler *compiler
 	vm       *VM
+	globals  map[string]int
+	exports  Value
+	debugger *debugger
+	profiler *profiler
+	traced   bool
 }
 
 func NewInterpreter(path string, extensionlibloader map[string]func() Value) (*Interpreter, error) {
+	return NewSandboxedInterpreter(path, extensionlibloader, nil)
+}
+
+// NewSandboxedInterpreter creates an Interpreter whose imports and loaded
+// libraries are restricted by the given sandbox. A nil sandbox restricts nothing.
+// The path may name a source script or a bytecode file made by Build.
+func NewSandboxedInterpreter(path string, extensionlibloader map[string]func() Value, sandbox *Sandbox) (*Interpreter, error) {
 	src, err := readScript(path)
 	if err != nil {
 		return nil, err
 	}
-	p := newParser(src, path)
-	rAst, err := p.parse()
-	if err != nil {
-		return nil, err
+	return newInterpreter(path, "", src, extensionlibloader, sandbox)
+}
+
+// NewInterpreterFromSource creates an Interpreter for a script that is not read
+// from a file, like inline code or the standard input. The source may also hold
+// bytecode made by Build. The name stands for the script in errors, and imports
+// are resolved from the working directory.
+func NewInterpreterFromSource(name string, src []byte, extensionlibloader map[string]func() Value) (*Interpreter, error) {
+	return newInterpreter(name, "", src, extensionlibloader, nil)
+}
+
+// newInterpreter creates an Interpreter for src, resolving its imports against
+// dir, or against the working directory when dir is empty.
+func newInterpreter(path, dir string, src []byte, extensionlibloader map[string]func() Value, sandbox *Sandbox) (*Interpreter, error) {
+	var script *Script
+	var err error
+	var globals map[string]int
+	if isBytecode(src) {
+		script, globals, err = decodeScript(src, path)
+	} else {
+		script, globals, err = compileSource(src, path, dir, sandbox, false)
 	}
-	c := newMainCompiler(rAst, path)
-	script, err := c.compileScript()
 	if err != nil {
 		return nil, err
 	}
@@ -34,111 +66,222 @@ func NewInterpreter(path string, extensionlibloader map[string]func() Value) (*I
 	if err != nil {
 		return nil, err
 	}
+	mainThread.sandbox = sandbox
 	return &Interpreter{
-		parser:   p,
-		compiler: c,
-		vm:       &VM{mainThread},
+		vm:      &VM{mainThread},
+		globals: globals,
 	}, nil
 }
 
+// compileSource compiles src, resolving its imports against dir. With debug set,
+// every statement is compiled along with a trace instruction recording its line.
+func compileSource(src []byte, path, dir string, sandbox *Sandbox, debug bool) (*Script, map[string]int, error) {
+	p := newParser(src, path)
+	rAst, err := p.parse()
+	if err != nil {
+		return nil, nil, err
+	}
+	c := newMainCompiler(rAst, path)
+	c.dir = dir
+	c.sandbox = sandbox
+	c.debug = debug
+	script, err := c.compileScript()
+	if err != nil {
+		return nil, nil, err
+	}
+	return script, c.sb.GlobalSet, nil
+}
+
+// NewDebugger creates an Interpreter whose Debug method runs the script
+// under an interactive line debugger reading commands from the standard input.
 func NewDebugger(path string, extensionlibloader map[string]func() Value) (*Interpreter, error) {
-	src, err := readScript(path)
+	i, err := newLineInterpreter(path, "", extensionlibloader)
 	if err != nil {
 		return nil, err
 	}
-	p := newParser(src, path)
-	rAst, err := p.parse()
+	i.debugger = newDebugger(i.globals)
+	return i, nil
+}
+
+// NewProfiler creates an Interpreter whose Profile method runs the script
+// counting the statements it executes by function and by line.
+func NewProfiler(path string, extensionlibloader map[string]func() Value) (*Interpreter, error) {
+	i, err := newLineInterpreter(path, "", extensionlibloader)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println(ast.PrintAST(rAst))
-	fmt.Print("\n\nPress 'Enter' to continue => ")
-	fmt.Scanf(" ")
-	c := newMainCompiler(rAst, path)
-	script, err := c.compileScript()
+	i.profiler = newProfiler()
+	return i, nil
+}
+
+// newLineInterpreter compiles the script at path recording the line
+// of every statement, which the debugger and the profiler rely on.
+// Imports are resolved against dir, or against the working directory when dir is empty.
+func newLineInterpreter(path, dir string, extensionlibloader map[string]func() Value) (*Interpreter, error) {
+	src, err := readScript(path)
+	if err != nil {
+		return nil, err
+	}
+	script, globals, err := compileSource(src, path, dir, nil, true)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println(PrintBytecode(script, script.MainFunction.CoreFn.ScriptName))
-	fmt.Print("\n\nPress 'Enter' to continue => ")
-	fmt.Scanf(" ")
 	mainThread, err := newMainThread(script, extensionlibloader)
 	if err != nil {
 		return nil, err
 	}
 	return &Interpreter{
-		parser:   p,
-		compiler: c,
-		vm:       &VM{mainThread},
+		vm:      &VM{mainThread},
+		globals: globals,
+		traced:  true,
 	}, nil
 }
 
 func PrintAST(path string) error {
+	rAst, err := SyntaxTree(path)
+	if err != nil {
+		return err
+	}
+	fmt.Println(ast.PrintAST(rAst))
+	return nil
+}
+
+// SyntaxTree parses the script at path. See ast.Describe for a form of it
+// ready to be encoded as JSON.
+func SyntaxTree(path string) (*ast.Ast, error) {
 	src, err := readScript(path)
 	if err != nil {
+		return nil, err
+	}
+	return newParser(src, path).parse()
+}
+
+func PrintTokens(path string) error {
+	tokens, err := Tokens(path)
+	if len(tokens) == 0 && err != nil {
 		return err
 	}
-	p := newParser(src, path)
-	rAst, err := p.parse()
+	fmt.Printf("%4v %-15v %-2v\n\n", "line", "token", "repr")
+	for _, t := range tokens {
+		fmt.Printf("%4v %-15v %-2v\n", t.Line, t.Token, t.Lit)
+	}
 	if err != nil {
 		return err
 	}
-	fmt.Println(ast.PrintAST(rAst))
+	fmt.Println()
 	return nil
 }
 
-func PrintTokens(path string) error {
+// Tokens returns the tokens of the script at path up to its EOF, comments included.
+// On a lexical error, the tokens before it are returned with the error.
+func Tokens(path string) ([]token.TokenInfo, error) {
 	src, err := readScript(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	l := lexer.New(src, path)
-	hadError := false
-	fmt.Printf("%4v %-15v %-2v\n\n", "line", "token", "repr")
+	var tokens []token.TokenInfo
 	for {
 		line, tok, lit := l.Next()
 		if l.LexicalError.Message != "" {
-			hadError = true
-			break
+			return tokens, l.LexicalError
 		}
-		fmt.Printf("%4v %-15v %-2v\n", line, tok, lit)
+		tokens = append(tokens, token.TokenInfo{Lit: lit, Line: line, Token: tok, Span: l.Span()})
 		if tok == token.EOF {
-			fmt.Println()
-			break
+			return tokens, nil
 		}
 	}
-	if hadError {
-		return l.LexicalError
-	}
-	return nil
 }
 
 func PrintMachineCode(path string) error {
-	src, err := readScript(path)
+	script, err := compileFile(path)
 	if err != nil {
 		return err
 	}
-	p := newParser(src, path)
-	rAst, err := p.parse()
+	fmt.Println(PrintBytecode(script, script.MainFunction.CoreFn.ScriptName))
+	return nil
+}
+
+// MachineCode compiles the script at path and decodes its code.
+func MachineCode(path string) (Disassembly, error) {
+	script, err := compileFile(path)
 	if err != nil {
-		return err
+		return Disassembly{}, err
 	}
-	c := newMainCompiler(rAst, path)
-	script, err := c.compileScript()
+	return Disassemble(script), nil
+}
+
+func compileFile(path string) (*Script, error) {
+	rAst, err := SyntaxTree(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	fmt.Println(PrintBytecode(script, script.MainFunction.CoreFn.ScriptName))
-	return nil
+	return newMainCompiler(rAst, path).compileScript()
 }
 
 func (i *Interpreter) Run() (Result, error) {
-	return i.vm.run()
+	return i.RunContext(context.Background())
+}
+
+// RunContext runs the script like Run, but stops it with a verror.LimitError
+// as soon as ctx is cancelled or its deadline passes.
+func (i *Interpreter) RunContext(ctx context.Context) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Failure, verror.LimitError{ScriptName: i.vm.Script.MainFunction.CoreFn.ScriptName, Err: err}
+	}
+	if ctx.Done() != nil {
+		l := i.limits()
+		l.setContext(ctx)
+		defer l.setContext(context.Background())
+	}
+	val, err := i.vm.run()
+	if err != nil {
+		return Failure, err
+	}
+	i.exports = val
+	return Success, nil
+}
+
+// SetArgs sets the arguments that std/os.args returns to the script.
+// Until it is called, the script sees the arguments of the process.
+func (i *Interpreter) SetArgs(args []string) {
+	if args == nil {
+		args = []string{}
+	}
+	i.vm.args = args
+}
+
+// SetOutput sets where print writes. Until it is called,
+// print writes to the standard output.
+func (i *Interpreter) SetOutput(w io.Writer) {
+	i.vm.output = w
+}
+
+// SetMaxInstructions limits the number of instructions the interpreter may execute.
+// The count is shared by the main script, its coroutines and Call, and it starts
+// over each time the limit is set. Zero means no limit.
+func (i *Interpreter) SetMaxInstructions(n uint64) {
+	l := i.limits()
+	l.maxSteps = n
+	l.steps = 0
+}
+
+// SetMaxCallDepth limits how deeply function calls may nest in any thread.
+// Zero means no limit.
+func (i *Interpreter) SetMaxCallDepth(n int) {
+	i.limits().maxDepth = n
+}
+
+func (i *Interpreter) limits() *limits {
+	if i.vm.limits == nil {
+		i.vm.limits = &limits{}
+	}
+	return i.vm.limits
 }
 
 func (i *Interpreter) MeasureRunTime() (Result, error) {
 	init := time.Now()
-	r, err := i.vm.run()
+	r, err := i.Run()
 	end := time.Since(init)
 	fmt.Printf("\n\nThe interpreter has finished.\n\n")
 	fmt.Printf("Time = %vs\n", end.Seconds())
@@ -146,10 +289,74 @@ func (i *Interpreter) MeasureRunTime() (Result, error) {
 	return r, err
 }
 
+// Exports returns the value exported by the main script,
+// or nil if the script has not run or does not export anything.
+func (i *Interpreter) Exports() Value {
+	if i.exports == nil {
+		return NilValue
+	}
+	return i.exports
+}
+
+// Global returns the current value of a global defined in the main script.
+func (i *Interpreter) Global(name string) (Value, bool) {
+	idx, ok := i.globals[name]
+	if !ok {
+		return NilValue, false
+	}
+	return (*i.vm.Script.Store)[idx], true
+}
+
+// Call invokes a callable value with the given arguments and returns its result.
+// Vida functions run on the frame stack of the main thread, so Call may be used
+// after Run has finished as well as from native functions while the script runs.
+func (i *Interpreter) Call(fn Value, args ...Value) (Value, error) {
+	val, err := i.vm.Call(fn, args...)
+	if err != nil {
+		return NilValue, err
+	}
+	return val, nil
+}
+
+// Debug runs the script under the line debugger. The Interpreter must come from NewDebugger,
+// since a script compiled without the lines of its statements never stops.
 func (i *Interpreter) Debug() (Result, error) {
-	return i.vm.debug()
+	if !i.traced {
+		return Failure, errNotDebuggable
+	}
+	if i.debugger == nil {
+		i.debugger = newDebugger(i.globals)
+	}
+	i.vm.hook = i.debugger.hook
+	result, err := i.Run()
+	if err == errDebugQuit {
+		return Failure, nil
+	}
+	return result, err
+}
+
+// Profile runs the script counting its statements. The Interpreter must come
+// from NewProfiler. The profile covers every statement run until the script
+// finished or failed, so it is returned along with any runtime error.
+func (i *Interpreter) Profile() (*Profile, error) {
+	if !i.traced {
+		return nil, errNotProfilable
+	}
+	if i.profiler == nil {
+		i.profiler = newProfiler()
+	}
+	i.vm.hook = i.profiler.count
+	init := time.Now()
+	_, err := i.Run()
+	return newProfile(i.profiler, i.vm, i.globals, time.Since(init)), err
 }
 
 func (i *Interpreter) PrintCallStack() {
 	i.vm.printCallStack()
 }
+
+// CallStack returns the script and line of every frame active when the
+// script stopped, innermost first. After a runtime error, it shows where it happened.
+func (i *Interpreter) CallStack() []verror.StackFrameInfo {
+	return i.vm.callStack()
+}
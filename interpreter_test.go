@@ -0,0 +1,147 @@
+package vida
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/alkemist-17/vida/verror"
+)
+
+// concurrent is run by many interpreters at once. Every interpreter gets its
+// own seed library, so a result from another one shows up as a wrong sum.
+const concurrent = `let co = load("std/co")
+let seed = load("seed")
+let gen = co.new(fun n {
+    for i in n {
+        co.yield(i)
+    }
+})
+var total = co.resume(gen, 100)
+for i in 99 {
+    total = total + co.resume(gen)
+}
+let result = total + seed
+`
+
+func TestConcurrentInterpreters(t *testing.T) {
+	var wg sync.WaitGroup
+	for k := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			loader := LibsLoader{"seed": func() Value { return Integer(k) }}
+			i, err := NewInterpreterFromSource("concurrent.vida", []byte(concurrent), loader)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := i.Run(); err != nil {
+				t.Error(err)
+				return
+			}
+			if v, _ := i.Global("result"); v != Integer(4950+k) {
+				t.Errorf("interpreter %v: result is %v, want %v", k, v, 4950+k)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// plugin exports functions for a host to call once it has run.
+const plugin = `let scale = 3
+let apply = fun f, x => f(x) * scale
+let calls = 0
+let count = fun {
+    calls = calls + 1
+    ret calls
+}
+export {
+    area = fun w, h => w * h * scale,
+    fails = fun => [1][5],
+}
+`
+
+func TestCall(t *testing.T) {
+	i, err := NewInterpreterFromSource("plugin.vida", []byte(plugin), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := i.Exports(); v != NilValue {
+		t.Errorf("exports before Run are %v, want nil", v)
+	}
+	if _, err := i.Run(); err != nil {
+		t.Fatal(err)
+	}
+	exports, ok := i.Exports().(*Object)
+	if !ok {
+		t.Fatalf("exports are %v, want an object", i.Exports())
+	}
+	if v, err := i.Call(exports.Value["area"], Integer(2), Integer(5)); err != nil || v != Integer(30) {
+		t.Errorf("area(2, 5) = %v, %v, want 30", v, err)
+	}
+	_, err = i.Call(exports.Value["fails"])
+	var vErr verror.VidaError
+	if !errors.As(err, &vErr) || vErr.Line != 10 {
+		t.Errorf("fails() = %v, want a runtime error at line 10", err)
+	}
+	apply, _ := i.Global("apply")
+	inc := GFn(func(args ...Value) (Value, error) {
+		return args[0].(Integer) + 1, nil
+	})
+	if v, err := i.Call(apply, inc, Integer(4)); err != nil || v != Integer(15) {
+		t.Errorf("apply(inc, 4) = %v, %v, want 15", v, err)
+	}
+	count, _ := i.Global("count")
+	for n := 1; n <= 3; n++ {
+		if v, err := i.Call(count); err != nil || v != Integer(n) {
+			t.Errorf("call %v of count = %v, %v, want %v", n, v, err, n)
+		}
+	}
+	if v, ok := i.Global("calls"); !ok || v != Integer(3) {
+		t.Errorf("calls = %v, %v, want 3", v, ok)
+	}
+	if _, ok := i.Global("missing"); ok {
+		t.Error("found a global that the script does not define")
+	}
+	if _, err := i.Call(Integer(1)); err == nil {
+		t.Error("calling an integer did not fail")
+	}
+}
+
+func TestDebugNeedsDebugger(t *testing.T) {
+	i, err := NewInterpreterFromSource("debug.vida", []byte("let x = 1\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := i.Debug(); err != errNotDebuggable {
+		t.Errorf("Debug on a script compiled without traces = %v, want %v", err, errNotDebuggable)
+	}
+}
+
+func TestProfileNeedsProfiler(t *testing.T) {
+	i, err := NewInterpreterFromSource("profile.vida", []byte("let x = 1\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := i.Profile(); p != nil || err != errNotProfilable {
+		t.Errorf("Profile on a script compiled without traces = %v, %v, want nil, %v", p, err, errNotProfilable)
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	src := "let co = load(\"std/co\")\nprint(\"main\", 1)\nco.resume(co.new(fun { print(\"thread\") }))\n"
+	var out bytes.Buffer
+	i, err := NewInterpreterFromSource("output.vida", []byte(src), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.SetOutput(&out)
+	if _, err := i.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "main 1\nthread\n"; out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
@@ -11,13 +11,16 @@ import (
 
 type Lexer struct {
 	LexicalError verror.VidaError
+	Errors       []verror.VidaError
 	src          []byte
 	ScriptName   string
 	pointer      int
 	leadPointer  int
 	srcLen       int
 	line         uint
+	lineStart    int
 	c            rune
+	start        token.Pos
 }
 
 const bom = 0xFEFF
@@ -47,16 +50,17 @@ func (l *Lexer) next() {
 		l.pointer = l.leadPointer
 		if l.c == '\n' {
 			l.line++
+			l.lineStart = l.pointer
 		}
 		r, w := rune(l.src[l.leadPointer]), 1
 		if r >= utf8.RuneSelf {
 			r, w = utf8.DecodeRune(l.src[l.leadPointer:])
 			if r == utf8.RuneError && w == 1 {
 				r = unexpected
-				l.LexicalError = verror.New(l.ScriptName, "script is not utf-8 encoded", verror.FileErrType, l.line)
+				l.record(verror.NewAt(l.ScriptName, "script is not utf-8 encoded", verror.FileErrType, token.Span{Start: l.pos(), End: l.pos()}))
 			} else if r == bom && l.pointer > 0 {
 				r = unexpected
-				l.LexicalError = verror.New(l.ScriptName, "Bom found in an unexpected place", verror.FileErrType, l.line)
+				l.record(verror.NewAt(l.ScriptName, "Bom found in an unexpected place", verror.FileErrType, token.Span{Start: l.pos(), End: l.pos()}))
 			}
 		}
 		l.c = r
@@ -73,6 +77,16 @@ func (l *Lexer) peek() byte {
 	return 0
 }
 
+// assignment returns compound when an operator is followed by '=', as in +=,
+// and operator otherwise.
+func (l *Lexer) assignment(operator, compound token.Token) token.Token {
+	if l.c == '=' {
+		l.next()
+		return compound
+	}
+	return operator
+}
+
 func (l *Lexer) skipWhitespace() {
 	for l.c == ' ' || l.c == '\t' || l.c == '\n' || l.c == '\r' {
 		l.next()
@@ -130,7 +144,7 @@ func (l *Lexer) scanComment() token.Token {
 			return token.COMMENT
 		}
 	}
-	l.LexicalError = verror.New(l.ScriptName, "unterminated comment", verror.LexicalErrType, l.line)
+	l.error("unterminated comment", verror.LexicalErrType)
 	return token.UNEXPECTED
 }
 
@@ -139,8 +153,7 @@ func (l *Lexer) scanString() (token.Token, string) {
 	for {
 		ch := l.c
 		if ch == '\n' || ch < 0 {
-			l.c = unexpected
-			l.LexicalError = verror.New(l.ScriptName, "unterminated string literal", verror.LexicalErrType, l.line)
+			l.error("unterminated string literal", verror.LexicalErrType)
 			return token.UNEXPECTED, ""
 		}
 		l.next()
@@ -160,8 +173,7 @@ func (l *Lexer) scanRawString() (token.Token, string) {
 	for {
 		ch := l.c
 		if ch < 0 {
-			l.c = unexpected
-			l.LexicalError = verror.New(l.ScriptName, "unterminated string literal", verror.LexicalErrType, l.line)
+			l.error("unterminated string literal", verror.LexicalErrType)
 			return token.UNEXPECTED, ""
 		}
 		l.next()
@@ -271,9 +283,34 @@ fractional:
 	return tok, string(l.src[init:l.pointer])
 }
 
+// Span returns the part of the source taken by the token last returned by Next.
+func (l *Lexer) Span() token.Span {
+	if l.pointer <= l.start.Offset {
+		return token.Span{Start: l.start, End: l.start}
+	}
+	return token.Span{Start: l.start, End: l.pos()}
+}
+
+func (l *Lexer) pos() token.Pos {
+	return token.Pos{Offset: l.pointer, Line: l.line, Column: uint(l.pointer-l.lineStart) + 1}
+}
+
+// error records a lexical error spanning from the start of the current token.
+func (l *Lexer) error(message string, errType string) {
+	l.record(verror.NewAt(l.ScriptName, message, errType, l.Span()))
+}
+
+// record keeps err as the last lexical error and adds it to the ones
+// found so far, since lexing goes on after an error.
+func (l *Lexer) record(err verror.VidaError) {
+	l.LexicalError = err
+	l.Errors = append(l.Errors, err)
+}
+
 func (l *Lexer) Next() (line uint, tok token.Token, lit string) {
 	l.skipWhitespace()
 	line = l.line
+	l.start = l.pos()
 	switch ch := l.c; {
 	case isLetter(ch):
 		lit = l.scanIdentifier()
@@ -304,24 +341,24 @@ func (l *Lexer) Next() (line uint, tok token.Token, lit string) {
 		case '`':
 			tok, lit = l.scanRawString()
 		case '+':
-			tok = token.ADD
+			tok = l.assignment(token.ADD, token.ADD_ASSIGN)
 		case '-':
 			if l.c == '-' {
 				l.next()
 				tok = token.METHOD_CALL
 			} else {
-				tok = token.SUB
+				tok = l.assignment(token.SUB, token.SUB_ASSIGN)
 			}
 		case '*':
-			tok = token.MUL
+			tok = l.assignment(token.MUL, token.MUL_ASSIGN)
 		case '/':
 			if l.c == '/' || l.c == '*' {
 				tok = l.scanComment()
 			} else {
-				tok = token.DIV
+				tok = l.assignment(token.DIV, token.DIV_ASSIGN)
 			}
 		case '%':
-			tok = token.REM
+			tok = l.assignment(token.REM, token.REM_ASSIGN)
 		case ',':
 			tok = token.COMMA
 		case '.':
@@ -342,7 +379,7 @@ func (l *Lexer) Next() (line uint, tok token.Token, lit string) {
 				tok = token.NEQ
 			} else {
 				tok = token.UNEXPECTED
-				l.LexicalError = verror.New(l.ScriptName, "found an unrecognized character '!'", verror.LexicalErrType, l.line)
+				l.error("found an unrecognized character '!'", verror.LexicalErrType)
 			}
 		case '<':
 			if l.c == '=' {
@@ -350,7 +387,7 @@ func (l *Lexer) Next() (line uint, tok token.Token, lit string) {
 				tok = token.LE
 			} else if l.c == '<' {
 				l.next()
-				tok = token.BSHL
+				tok = l.assignment(token.BSHL, token.BSHL_ASSIGN)
 			} else {
 				tok = token.LT
 			}
@@ -360,7 +397,7 @@ func (l *Lexer) Next() (line uint, tok token.Token, lit string) {
 				tok = token.GE
 			} else if l.c == '>' {
 				l.next()
-				tok = token.BSHR
+				tok = l.assignment(token.BSHR, token.BSHR_ASSIGN)
 			} else {
 				tok = token.GT
 			}
@@ -378,17 +415,19 @@ func (l *Lexer) Next() (line uint, tok token.Token, lit string) {
 			tok = token.RBRACKET
 		case '~':
 			tok = token.TILDE
+		case ':':
+			tok = token.COLON
 		case '|':
-			tok = token.BOR
+			tok = l.assignment(token.BOR, token.BOR_ASSIGN)
 		case '^':
-			tok = token.BXOR
+			tok = l.assignment(token.BXOR, token.BXOR_ASSIGN)
 		case '&':
-			tok = token.BAND
+			tok = l.assignment(token.BAND, token.BAND_ASSIGN)
 		default:
-			if tok != token.UNEXPECTED {
-				tok = token.UNEXPECTED
+			tok = token.UNEXPECTED
+			if ch != unexpected {
 				lit = string(ch)
-				l.LexicalError = verror.New(l.ScriptName, fmt.Sprintf("found an unrecognized character '%v'", lit), verror.LexicalErrType, l.line)
+				l.error(fmt.Sprintf("found an unrecognized character '%v'", lit), verror.LexicalErrType)
 			}
 		}
 	}
@@ -0,0 +1,54 @@
+package vida
+
+import (
+	"context"
+
+	"github.com/alkemist-17/vida/verror"
+)
+
+const pollInterval = 0x3FF
+
+// limits holds the execution budget shared by the main thread and its coroutines.
+// The VM checks it at jumps, loops and calls, which are the only places
+// where a script can run for an unbounded amount of time, on every call
+// from native code, and whenever execute returns.
+type limits struct {
+	done     <-chan struct{}
+	ctx      context.Context
+	steps    uint64
+	maxSteps uint64
+	maxDepth int
+	polls    uint64
+}
+
+func (l *limits) check(steps *uint64) error {
+	l.steps += *steps
+	*steps = 0
+	if l.maxSteps != 0 && l.steps > l.maxSteps {
+		return verror.ErrInstructionLimit
+	}
+	if l.done != nil {
+		l.polls++
+		if l.polls&pollInterval == 0 {
+			select {
+			case <-l.done:
+				return l.ctx.Err()
+			default:
+			}
+		}
+	}
+	return nil
+}
+
+func (l *limits) checkDepth(fp int) error {
+	if l.maxDepth != 0 && fp >= l.maxDepth {
+		return verror.ErrCallDepthLimit
+	}
+	return nil
+}
+
+func (l *limits) setContext(ctx context.Context) {
+	l.ctx = ctx
+	l.done = ctx.Done()
+	l.polls = 0
+}
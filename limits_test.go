@@ -0,0 +1,91 @@
+package vida
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alkemist-17/vida/verror"
+)
+
+const forever = `var n = 0
+while true {
+    n = n + 1
+}
+`
+
+func limitError(t *testing.T, err error, cause error) {
+	t.Helper()
+	var lErr verror.LimitError
+	if !errors.As(err, &lErr) {
+		t.Fatalf("expected a LimitError, got %v", err)
+	}
+	if !errors.Is(err, cause) {
+		t.Errorf("expected the limit error to wrap %v, got %v", cause, lErr.Err)
+	}
+}
+
+func newLimited(t *testing.T, src string) *Interpreter {
+	t.Helper()
+	i, err := NewInterpreterFromSource("limits.vida", []byte(src), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return i
+}
+
+func TestRunContextDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := newLimited(t, forever).RunContext(ctx)
+	limitError(t, err, context.DeadlineExceeded)
+}
+
+func TestRunContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	_, err := newLimited(t, forever).RunContext(ctx)
+	limitError(t, err, context.Canceled)
+
+	_, err = newLimited(t, "let x = 1\n").RunContext(ctx)
+	limitError(t, err, context.Canceled)
+}
+
+func TestMaxInstructions(t *testing.T) {
+	i := newLimited(t, forever)
+	i.SetMaxInstructions(10000)
+	_, err := i.Run()
+	limitError(t, err, verror.ErrInstructionLimit)
+
+	i = newLimited(t, "var n = 0\nfor k in 10 {\n    n = n + k\n}\n")
+	i.SetMaxInstructions(10000)
+	if _, err := i.Run(); err != nil {
+		t.Errorf("a script within the budget failed: %v", err)
+	}
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	src := "let down = fun n {\n    if n == 0 {\n        ret 0\n    }\n    ret 1 + down(n - 1)\n}\nlet result = down(30)\n"
+	i := newLimited(t, src)
+	i.SetMaxCallDepth(20)
+	_, err := i.Run()
+	limitError(t, err, verror.ErrCallDepthLimit)
+
+	i = newLimited(t, src)
+	i.SetMaxCallDepth(40)
+	if _, err := i.Run(); err != nil {
+		t.Errorf("a script within the depth limit failed: %v", err)
+	}
+}
+
+func TestMaxInstructionsThroughCallbacks(t *testing.T) {
+	src := "let fn = load(\"std/fn\")\nvar xs = []\nfor k in 3000 {\n    xs = xs + [k]\n}\nlet sums = fn.map(xs, fun a => fn.map(xs, fun b => a + b))\n"
+	i := newLimited(t, src)
+	i.SetMaxInstructions(100000)
+	_, err := i.Run()
+	limitError(t, err, verror.ErrInstructionLimit)
+}
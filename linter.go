@@ -0,0 +1,553 @@
+package vida
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/alkemist-17/vida/ast"
+	"github.com/alkemist-17/vida/lexer"
+	"github.com/alkemist-17/vida/token"
+)
+
+// Rules checked by Lint. A comment holding lint:ignore followed by some
+// of them silences those rules on its line, or on the next line of code
+// when the comment stands on a line of its own. Without rules it silences all.
+const (
+	LintUnusedVar    = "unused-var"
+	LintShadow       = "shadow"
+	LintUnreachable  = "unreachable"
+	LintImportAssign = "import-assign"
+	LintArgCount     = "arg-count"
+)
+
+const lintIgnore = "lint:ignore"
+
+// LintWarning is a likely mistake found in a script that still compiles.
+type LintWarning struct {
+	Script  string
+	Line    uint
+	Rule    string
+	Message string
+}
+
+func (w LintWarning) String() string {
+	return fmt.Sprintf("%v:%v: %v (%v)", w.Script, w.Line, w.Message, w.Rule)
+}
+
+type lintBinding struct {
+	name        string
+	line        uint
+	fun         *ast.Fun
+	imported    bool
+	reassigned  bool
+	used        bool
+	checkUnused bool
+}
+
+type lintScope struct {
+	level    int
+	bindings []*lintBinding
+}
+
+type lintCall struct {
+	binding *lintBinding
+	global  string
+	args    int
+	line    uint
+}
+
+type linter struct {
+	script   string
+	scopes   []*lintScope
+	level    int
+	line     uint
+	globals  map[string]*lintBinding
+	calls    []lintCall
+	warnings []LintWarning
+}
+
+// Lint parses src and returns the warnings found in it, sorted by line.
+// It does not compile the script, so it reports no undefined references.
+func Lint(src []byte, scriptName string) ([]LintWarning, error) {
+	tree, err := newParser(bytes.Clone(src), scriptName).parse()
+	if err != nil {
+		return nil, err
+	}
+	l := &linter{script: scriptName, globals: make(map[string]*lintBinding)}
+	l.openScope()
+	l.statements(tree.Statement)
+	l.closeScope()
+	l.checkCalls()
+	ignored := lintDirectives(src, scriptName)
+	warnings := slices.DeleteFunc(l.warnings, func(w LintWarning) bool {
+		rules, ok := ignored[w.Line]
+		return ok && (len(rules) == 0 || slices.Contains(rules, w.Rule))
+	})
+	slices.SortStableFunc(warnings, func(a, b LintWarning) int {
+		return int(a.Line) - int(b.Line)
+	})
+	return warnings, nil
+}
+
+func (l *linter) warn(line uint, rule string, format string, args ...any) {
+	l.warnings = append(l.warnings, LintWarning{Script: l.script, Line: line, Rule: rule, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) openScope() {
+	l.scopes = append(l.scopes, &lintScope{level: l.level})
+}
+
+func (l *linter) closeScope() {
+	scope := l.scopes[len(l.scopes)-1]
+	l.scopes = l.scopes[:len(l.scopes)-1]
+	for _, b := range scope.bindings {
+		if b.checkUnused && !b.used && !strings.HasPrefix(b.name, "_") {
+			l.warn(b.line, LintUnusedVar, "%v declared and never used", b.name)
+		}
+	}
+}
+
+func (l *linter) lookup(name string) (*lintBinding, *lintScope) {
+	for i := len(l.scopes) - 1; i >= 0; i-- {
+		for j := len(l.scopes[i].bindings) - 1; j >= 0; j-- {
+			if l.scopes[i].bindings[j].name == name {
+				return l.scopes[i].bindings[j], l.scopes[i]
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (l *linter) declare(name string, line uint) *lintBinding {
+	if prev, scope := l.lookup(name); prev != nil {
+		switch {
+		case scope == l.scopes[len(l.scopes)-1]:
+			l.warn(line, LintShadow, "%v redeclares the local of line %v", name, prev.line)
+		case scope.level != l.level:
+			l.warn(line, LintShadow, "%v shadows the local of line %v in an enclosing function", name, prev.line)
+		default:
+			l.warn(line, LintShadow, "%v shadows the local of line %v", name, prev.line)
+		}
+	}
+	b := &lintBinding{name: name, line: line}
+	scope := l.scopes[len(l.scopes)-1]
+	scope.bindings = append(scope.bindings, b)
+	return b
+}
+
+func (l *linter) use(name string) {
+	if b, _ := l.lookup(name); b != nil {
+		b.used = true
+	}
+}
+
+func (l *linter) assign(name string, line uint) {
+	b, _ := l.lookup(name)
+	if b == nil {
+		b = l.globals[name]
+	}
+	if b == nil {
+		return
+	}
+	b.reassigned = true
+	if b.imported {
+		l.warn(line, LintImportAssign, "assignment to %v, which holds an imported module", name)
+	}
+}
+
+func (l *linter) call(name string, args int, ellipsis int, line uint) {
+	if ellipsis != 0 {
+		return
+	}
+	if b, _ := l.lookup(name); b != nil {
+		l.calls = append(l.calls, lintCall{binding: b, args: args, line: line})
+	} else {
+		l.calls = append(l.calls, lintCall{global: name, args: args, line: line})
+	}
+}
+
+// checkCalls compares the calls to names bound once to a function
+// literal with the number of parameters of that function.
+func (l *linter) checkCalls() {
+	for _, c := range l.calls {
+		b := c.binding
+		if b == nil {
+			b = l.globals[c.global]
+		}
+		if b == nil || b.fun == nil || b.reassigned {
+			continue
+		}
+		arity := len(b.fun.Args)
+		switch {
+		case b.fun.IsVar && c.args < arity-1:
+			l.warn(c.line, LintArgCount, "%v takes at least %v arguments, but is called with %v", b.name, arity-1, c.args)
+		case !b.fun.IsVar && c.args != arity:
+			l.warn(c.line, LintArgCount, "%v takes %v arguments, but is called with %v", b.name, arity, c.args)
+		}
+	}
+}
+
+func isImport(expr ast.Node) bool {
+	switch e := expr.(type) {
+	case *ast.Import:
+		return true
+	case *ast.CallExpr:
+		ref, ok := e.Fun.(*ast.Reference)
+		return ok && ref.Value == "load"
+	}
+	return false
+}
+
+func (l *linter) statements(stmts []ast.Node) {
+	reported := false
+	terminated := false
+	for i := 0; i < len(stmts); i++ {
+		line := statementLine(stmts[i])
+		if line != 0 {
+			l.line = line
+		}
+		if terminated && !reported && line != 0 {
+			l.warn(line, LintUnreachable, "unreachable statement")
+			reported = true
+		}
+		if ref, ok := stmts[i].(*ast.ReferenceStmt); ok && i+1 < len(stmts) {
+			if c, ok := stmts[i+1].(*ast.CallStmt); ok {
+				l.call(ref.Value, len(c.Args), c.Ellipsis, c.Line)
+			}
+		}
+		l.statement(stmts[i])
+		if terminates(stmts[i]) {
+			terminated = true
+		}
+	}
+}
+
+func (l *linter) statement(node ast.Node) {
+	switch n := node.(type) {
+	case *ast.Let:
+		l.expression(n.Expr)
+		if b, ok := l.globals[n.Identifier]; ok {
+			b.reassigned = true
+			if b.imported {
+				l.warn(n.Line, LintImportAssign, "assignment to %v, which holds an imported module", n.Identifier)
+			}
+			return
+		}
+		b := &lintBinding{name: n.Identifier, line: n.Line, imported: isImport(n.Expr)}
+		b.fun, _ = n.Expr.(*ast.Fun)
+		l.globals[n.Identifier] = b
+	case *ast.Var:
+		var b *lintBinding
+		if n.IsRecursive {
+			b = l.declare(n.Identifier, n.Line)
+			l.expression(n.Expr)
+		} else {
+			l.expression(n.Expr)
+			b = l.declare(n.Identifier, n.Line)
+		}
+		b.checkUnused = true
+		b.imported = isImport(n.Expr)
+		b.fun, _ = n.Expr.(*ast.Fun)
+	case *ast.Destructure:
+		l.expression(n.Expr)
+		l.destructure(n.Pattern, n.Decl)
+	case *ast.Mut:
+		if n.Op.IsAssignOperator() {
+			l.use(n.Identifier)
+		}
+		l.expression(n.Expr)
+		l.assign(n.Identifier, n.Line)
+	case *ast.ReferenceStmt:
+		l.use(n.Value)
+	case *ast.IGetStmt:
+		l.expression(n.Index)
+	case *ast.CallStmt:
+		l.expressions(n.Args)
+	case *ast.MethodCallStmt:
+		l.expressions(n.Args)
+	case *ast.ISet:
+		l.expression(n.Index)
+		l.expression(n.Expr)
+	case *ast.Block:
+		l.openScope()
+		l.statements(n.Statement)
+		l.closeScope()
+	case *ast.Branch:
+		l.statement(n.If)
+		for _, elif := range n.Elifs {
+			l.statement(elif)
+		}
+		if n.Else != nil {
+			l.statement(n.Else)
+		}
+	case *ast.If:
+		l.expression(n.Condition)
+		l.statement(n.Block)
+	case *ast.Else:
+		l.statement(n.Block)
+	case *ast.For:
+		l.expression(n.Init)
+		l.expression(n.End)
+		l.expression(n.Step)
+		l.openScope()
+		l.declare(n.Id, n.Line)
+		l.statement(n.Block)
+		l.closeScope()
+	case *ast.IFor:
+		l.expression(n.Expr)
+		l.openScope()
+		for _, id := range []string{n.Key, n.Value} {
+			if !strings.HasPrefix(id, "*") {
+				l.declare(id, n.Line)
+			}
+		}
+		l.statement(n.Block)
+		l.closeScope()
+	case *ast.While:
+		l.expression(n.Condition)
+		l.statement(n.Block)
+	case *ast.Match:
+		l.expression(n.Subject)
+		reported := false
+		for k, arm := range n.Arms {
+			if k > 0 && !reported && matchesAll(n.Arms[k-1]) {
+				l.warn(arm.Line, LintUnreachable, "unreachable match arm")
+				reported = true
+			}
+			l.openScope()
+			l.pattern(arm.Pattern)
+			l.expression(arm.Guard)
+			l.statement(arm.Block)
+			l.closeScope()
+		}
+	case *ast.Ret:
+		l.expression(n.Expr)
+	case *ast.Export:
+		l.expression(n.Expr)
+	}
+}
+
+// destructure declares the names bound by a destructuring, which
+// are checked for use when they are declared by var.
+func (l *linter) destructure(node ast.Node, decl token.Token) {
+	switch n := node.(type) {
+	case *ast.BindPattern:
+		if decl == token.LET {
+			if _, ok := l.globals[n.Identifier]; !ok {
+				l.globals[n.Identifier] = &lintBinding{name: n.Identifier, line: n.Line}
+			}
+			return
+		}
+		l.declare(n.Identifier, n.Line).checkUnused = decl == token.VAR
+	case *ast.ListPattern:
+		for _, e := range n.Elements {
+			l.destructure(e, decl)
+		}
+		l.destructure(n.Rest, decl)
+	case *ast.ObjectPattern:
+		for _, f := range n.Fields {
+			l.expression(f.Default)
+			l.destructure(f.Pattern, decl)
+		}
+	}
+}
+
+func (l *linter) pattern(node ast.Node) {
+	switch n := node.(type) {
+	case *ast.BindPattern:
+		l.declare(n.Identifier, n.Line).checkUnused = true
+	case *ast.ValuePattern:
+		l.expression(n.Value)
+	case *ast.ListPattern:
+		for _, e := range n.Elements {
+			l.pattern(e)
+		}
+		l.pattern(n.Rest)
+	case *ast.ObjectPattern:
+		for _, f := range n.Fields {
+			l.expression(f.Default)
+			l.pattern(f.Pattern)
+		}
+	}
+}
+
+func (l *linter) expressions(nodes []ast.Node) {
+	for _, n := range nodes {
+		l.expression(n)
+	}
+}
+
+func (l *linter) expression(node ast.Node) {
+	switch n := node.(type) {
+	case *ast.Reference:
+		l.use(n.Value)
+	case *ast.List:
+		l.expressions(n.ExprList)
+	case *ast.Object:
+		for _, p := range n.Pairs {
+			l.expression(p.Value)
+		}
+	case *ast.PrefixExpr:
+		l.expression(n.Expr)
+	case *ast.BinaryExpr:
+		l.expression(n.Lhs)
+		l.expression(n.Rhs)
+	case *ast.IGet:
+		l.expression(n.Indexable)
+		l.expression(n.Index)
+	case *ast.Slice:
+		l.expression(n.Value)
+		l.expression(n.First)
+		l.expression(n.Last)
+	case *ast.Select:
+		l.expression(n.Selectable)
+	case *ast.CallExpr:
+		if ref, ok := n.Fun.(*ast.Reference); ok {
+			l.call(ref.Value, len(n.Args), n.Ellipsis, n.Line)
+		}
+		l.expression(n.Fun)
+		l.expressions(n.Args)
+	case *ast.MethodCallExpr:
+		l.expression(n.Obj)
+		l.expressions(n.Args)
+	case *ast.Fun:
+		l.level++
+		l.openScope()
+		for _, arg := range n.Args {
+			if !strings.HasPrefix(arg, "*") {
+				l.declare(arg, l.line)
+			}
+		}
+		l.statement(n.Body)
+		l.closeScope()
+		l.level--
+	}
+}
+
+// statementLine returns the line where a statement starts,
+// or 0 for the statements the parser adds on its own.
+func statementLine(node ast.Node) uint {
+	switch n := node.(type) {
+	case *ast.Let:
+		return n.Line
+	case *ast.Var:
+		return n.Line
+	case *ast.Mut:
+		return n.Line
+	case *ast.ReferenceStmt:
+		return n.Line
+	case *ast.IGetStmt:
+		return n.Line
+	case *ast.CallStmt:
+		return n.Line
+	case *ast.MethodCallStmt:
+		return n.Line
+	case *ast.ISet:
+		return n.Line
+	case *ast.For:
+		return n.Line
+	case *ast.IFor:
+		return n.Line
+	case *ast.While:
+		return n.Line
+	case *ast.Ret:
+		return n.Line
+	case *ast.Export:
+		return n.Line
+	case *ast.Break:
+		return n.Line
+	case *ast.Continue:
+		return n.Line
+	case *ast.Branch:
+		return n.If.(*ast.If).Line
+	case *ast.Destructure:
+		return n.Line
+	case *ast.Match:
+		return n.Line
+	case *ast.Block:
+		for _, s := range n.Statement {
+			if line := statementLine(s); line != 0 {
+				return line
+			}
+		}
+	}
+	return 0
+}
+
+// terminates reports whether the statements after node in the same block never run.
+func terminates(node ast.Node) bool {
+	switch n := node.(type) {
+	case *ast.Ret, *ast.Break, *ast.Continue:
+		return true
+	case *ast.Block:
+		return slices.ContainsFunc(n.Statement, terminates)
+	case *ast.Branch:
+		if n.Else == nil || !terminates(n.If.(*ast.If).Block) || !terminates(n.Else.(*ast.Else).Block) {
+			return false
+		}
+		for _, elif := range n.Elifs {
+			if !terminates(elif.(*ast.If).Block) {
+				return false
+			}
+		}
+		return true
+	case *ast.Match:
+		return slices.ContainsFunc(n.Arms, matchesAll) && !slices.ContainsFunc(n.Arms, func(arm *ast.MatchArm) bool {
+			return !terminates(arm.Block)
+		})
+	}
+	return false
+}
+
+// matchesAll reports whether a match arm is taken for any value, so the arms after it never are.
+func matchesAll(arm *ast.MatchArm) bool {
+	if arm.Guard != nil {
+		return false
+	}
+	switch arm.Pattern.(type) {
+	case *ast.Wildcard, *ast.BindPattern:
+		return true
+	}
+	return false
+}
+
+// lintDirectives maps every line silenced by a lint:ignore comment
+// to the rules silenced on it, or to none when all of them are.
+func lintDirectives(src []byte, scriptName string) map[uint][]string {
+	ignored := make(map[uint][]string)
+	var pending [][]string
+	var last uint
+	l := lexer.New(bytes.Clone(src), scriptName)
+	for {
+		line, tok, _ := l.Next()
+		switch tok {
+		case token.EOF, token.UNEXPECTED:
+			return ignored
+		case token.COMMENT:
+			span := l.Span()
+			start, end := span.Start.Offset, span.End.Offset
+			text := string(src[start:min(end, len(src))])
+			k := strings.Index(text, lintIgnore)
+			if k < 0 {
+				continue
+			}
+			text = strings.TrimSuffix(strings.TrimSpace(text[k+len(lintIgnore):]), "*/")
+			rules := strings.FieldsFunc(text, func(r rune) bool {
+				return r == ',' || r == ' ' || r == '\t'
+			})
+			if line == last {
+				ignored[line] = append(ignored[line], rules...)
+			} else {
+				pending = append(pending, rules)
+			}
+		default:
+			for _, rules := range pending {
+				ignored[line] = append(ignored[line], rules...)
+			}
+			pending = nil
+			last = line
+		}
+	}
+}
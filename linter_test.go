@@ -0,0 +1,44 @@
+package vida
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// lints holds, for every rule, a script that breaks it and one that does
+// not, along with the warnings expected as line:rule.
+var lints = []struct {
+	name string
+	src  string
+	want []string
+}{
+	{"unused-var", "let f = fun {\n    var x = 1\n}\nf()\n", []string{"2:unused-var"}},
+	{"used-var", "let f = fun {\n    var x = 1\n    var _y = 2\n    print(x)\n}\nf()\n", nil},
+	{"shadow", "let f = fun {\n    var x = 1\n    if x {\n        var x = 2\n        print(x)\n    }\n}\nf()\n", []string{"4:shadow"}},
+	{"no-shadow", "let f = fun {\n    if true {\n        var x = 1\n        print(x)\n    }\n    var x = 2\n    print(x)\n}\nf()\n", nil},
+	{"unreachable", "let f = fun {\n    ret 1\n    print(2)\n}\nf()\n", []string{"3:unreachable"}},
+	{"reachable", "let f = fun x {\n    if x {\n        ret 1\n    }\n    print(2)\n}\nf(true)\n", nil},
+	{"import-assign", "let co = load(\"std/co\")\nco = 1\n", []string{"2:import-assign"}},
+	{"no-import-assign", "let co = load(\"std/co\")\nvar n = 1\nn = 2\nprint(co, n)\n", nil},
+	{"arg-count", "let f = fun a, b {\n    ret a + b\n}\nf(1)\n", []string{"4:arg-count"}},
+	{"right-arg-count", "let f = fun a, b {\n    ret a + b\n}\nf(1, 2)\n", nil},
+	{"ignored", "let f = fun a, b {\n    ret a + b\n}\nf(1) // lint:ignore arg-count\n// lint:ignore\nf(1)\n", nil},
+	{"ignored-other-rule", "let f = fun a, b {\n    ret a + b\n}\nf(1) // lint:ignore shadow\n", []string{"4:arg-count"}},
+}
+
+func TestLintRules(t *testing.T) {
+	for _, c := range lints {
+		warnings, err := Lint([]byte(c.src), c.name+".vida")
+		if err != nil {
+			t.Fatalf("%v: %v", c.name, err)
+		}
+		var got []string
+		for _, w := range warnings {
+			got = append(got, fmt.Sprintf("%v:%v", w.Line, w.Rule))
+		}
+		if !slices.Equal(got, c.want) {
+			t.Errorf("%v: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,574 @@
+package vida
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alkemist-17/vida/token"
+	"github.com/alkemist-17/vida/verror"
+)
+
+// The Language Server Protocol server
+//
+// ServeLSP speaks the Language Server Protocol over a pair of streams, so editors
+// get diagnostics, navigation, hovers and completions for Vida scripts.
+// Every time a document changes it is compiled with a symbol table, which records
+// the span of every name the symbol builder declares and of every reference,
+// along with the declaration it resolves to.
+
+const (
+	lspSyncFull           = 1
+	lspSeverityError      = 1
+	lspSeverityWarning    = 2
+	lspCompletionFunction = 3
+	lspCompletionField    = 5
+	lspCompletionVariable = 6
+	lspCompletionKeyword  = 14
+	lspMethodNotFound     = -32601
+	lspInvalidParams      = -32602
+)
+
+// lspCoreLib is the def of the identifiers bound to a name of the corelib.
+const lspCoreLib = -1
+
+type lspMessage struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Code     string   `json:"code,omitempty"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspCompletionItem struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type lspTextDocument struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+type lspPositionParams struct {
+	TextDocument lspTextDocument `json:"textDocument"`
+	Position     lspPosition     `json:"position"`
+	Context      struct {
+		IncludeDeclaration bool `json:"includeDeclaration"`
+	} `json:"context"`
+}
+
+// lspOccurrence is an identifier of a document bound to the declaration
+// it names, an index of defs, or to -1 for the names of the corelib.
+type lspOccurrence struct {
+	start int
+	end   int
+	name  string
+	def   int
+	decl  bool
+}
+
+type lspDocument struct {
+	uri         string
+	path        string
+	text        string
+	lines       []int
+	diagnostics []lspDiagnostic
+	defs        []symbolDef
+	occurrences []lspOccurrence
+}
+
+type lspServer struct {
+	in        *bufio.Reader
+	out       io.Writer
+	libs      LibsLoader
+	documents map[string]*lspDocument
+}
+
+// ServeLSP serves the Language Server Protocol on in and out until the editor
+// sends exit or closes in. Documents are compiled from the directory of their
+// files, so that their imports resolve the same way they do when they run.
+func ServeLSP(in io.Reader, out io.Writer, extensionlibloader map[string]func() Value) error {
+	s := &lspServer{
+		in:        bufio.NewReader(in),
+		out:       out,
+		libs:      extensionlibloader,
+		documents: make(map[string]*lspDocument),
+	}
+	for {
+		data, err := readFrame(s.in)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		msg := &lspMessage{}
+		if err := json.Unmarshal(data, msg); err != nil {
+			return err
+		}
+		if !s.handle(msg) {
+			return nil
+		}
+	}
+}
+
+func (s *lspServer) send(message map[string]any) {
+	message["jsonrpc"] = "2.0"
+	data, _ := json.Marshal(message)
+	writeFrame(s.out, data)
+}
+
+func (s *lspServer) respond(msg *lspMessage, result any) {
+	s.send(map[string]any{"id": msg.ID, "result": result})
+}
+
+func (s *lspServer) fail(msg *lspMessage, code int, message string) {
+	s.send(map[string]any{"id": msg.ID, "error": map[string]any{"code": code, "message": message}})
+}
+
+func (s *lspServer) notify(method string, params any) {
+	s.send(map[string]any{"method": method, "params": params})
+}
+
+func (msg *lspMessage) isRequest() bool {
+	return len(msg.ID) > 0 && string(msg.ID) != "null"
+}
+
+// handle answers a message. It returns false once the editor asks to exit.
+func (s *lspServer) handle(msg *lspMessage) bool {
+	switch msg.Method {
+	case "initialize":
+		s.respond(msg, map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":   lspSyncFull,
+				"definitionProvider": true,
+				"referencesProvider": true,
+				"hoverProvider":      true,
+				"completionProvider": map[string]any{"triggerCharacters": []string{"."}},
+			},
+			"serverInfo": map[string]any{"name": Name(), "version": Version()},
+		})
+	case "shutdown":
+		s.respond(msg, nil)
+	case "exit":
+		return false
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument lspTextDocument `json:"textDocument"`
+		}
+		if json.Unmarshal(msg.Params, &params) == nil {
+			s.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument   lspTextDocument `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if json.Unmarshal(msg.Params, &params) == nil && len(params.ContentChanges) > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		var params struct {
+			TextDocument lspTextDocument `json:"textDocument"`
+		}
+		if json.Unmarshal(msg.Params, &params) == nil {
+			delete(s.documents, params.TextDocument.URI)
+			s.notify("textDocument/publishDiagnostics", map[string]any{"uri": params.TextDocument.URI, "diagnostics": []lspDiagnostic{}})
+		}
+	case "textDocument/definition", "textDocument/references", "textDocument/hover", "textDocument/completion":
+		var params lspPositionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			s.fail(msg, lspInvalidParams, err.Error())
+			return true
+		}
+		doc, ok := s.documents[params.TextDocument.URI]
+		if !ok {
+			s.respond(msg, nil)
+			return true
+		}
+		offset := doc.offset(params.Position)
+		switch msg.Method {
+		case "textDocument/definition":
+			s.respond(msg, doc.definition(offset))
+		case "textDocument/references":
+			s.respond(msg, doc.references(offset, params.Context.IncludeDeclaration))
+		case "textDocument/hover":
+			s.respond(msg, doc.hover(offset))
+		case "textDocument/completion":
+			s.respond(msg, s.completion(doc, offset))
+		}
+	default:
+		if msg.isRequest() {
+			s.fail(msg, lspMethodNotFound, fmt.Sprintf("method %v not supported", msg.Method))
+		}
+	}
+	return true
+}
+
+func (s *lspServer) update(uri, text string) {
+	doc := newLSPDocument(uri, text, s.documents[uri])
+	s.documents[uri] = doc
+	s.notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "diagnostics": doc.diagnostics})
+}
+
+func uriPath(uri string) string {
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		return filepath.FromSlash(u.Path)
+	}
+	return uri
+}
+
+// newLSPDocument compiles a new version of a document. While it does not parse,
+// as it happens midway through typing, it keeps the index of prev.
+func newLSPDocument(uri, text string, prev *lspDocument) *lspDocument {
+	doc := &lspDocument{
+		uri:         uri,
+		path:        uriPath(uri),
+		text:        text,
+		lines:       []int{0},
+		diagnostics: []lspDiagnostic{},
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			doc.lines = append(doc.lines, i+1)
+		}
+	}
+	symbols := newSymbolTable()
+	tree, err := newParser([]byte(text), doc.path).parse()
+	if err == nil {
+		c := newMainCompiler(tree, doc.path)
+		c.symbols = symbols
+		c.dir = filepath.Dir(doc.path)
+		if _, err = c.compileScript(); err == nil {
+			warnings, _ := Lint([]byte(text), doc.path)
+			for _, w := range warnings {
+				doc.diagnostics = append(doc.diagnostics, lspDiagnostic{
+					Range:    doc.lineRange(w.Line),
+					Severity: lspSeverityWarning,
+					Code:     w.Rule,
+					Source:   "vida lint",
+					Message:  w.Message,
+				})
+			}
+		}
+	}
+	if list, ok := err.(verror.ErrorList); ok {
+		for _, e := range list {
+			doc.diagnostics = append(doc.diagnostics, doc.errorDiagnostic(e))
+		}
+	} else if err != nil {
+		doc.diagnostics = append(doc.diagnostics, doc.errorDiagnostic(err))
+	}
+	if tree == nil && prev != nil {
+		doc.carry(prev)
+	} else {
+		doc.index(symbols)
+	}
+	return doc
+}
+
+// carry keeps the index of prev for a version of the document that does not
+// parse. The identifiers before and after the part of the text that changed
+// move along with it, and the ones in that part, or declared there, are dropped.
+func (doc *lspDocument) carry(prev *lspDocument) {
+	old, text := prev.text, doc.text
+	head := 0
+	for head < len(old) && head < len(text) && old[head] == text[head] {
+		head++
+	}
+	tail := 0
+	for tail < len(old)-head && tail < len(text)-head && old[len(old)-1-tail] == text[len(text)-1-tail] {
+		tail++
+	}
+	shift := len(text) - len(old)
+	lineShift := strings.Count(text[head:len(text)-tail], "\n") - strings.Count(old[head:len(old)-tail], "\n")
+	move := func(start, end int) (int, int, bool) {
+		switch {
+		case end < head:
+			return start, end, true
+		case start > len(old)-tail:
+			return start + shift, end + shift, true
+		}
+		return 0, 0, false
+	}
+	doc.defs = slices.Clone(prev.defs)
+	dropped := make([]bool, len(doc.defs))
+	for k := range doc.defs {
+		span := &doc.defs[k].span
+		if !span.IsValid() {
+			continue
+		}
+		start, end, ok := move(span.Start.Offset, span.End.Offset)
+		switch {
+		case !ok:
+			*span = token.Span{}
+			dropped[k] = true
+		case start != span.Start.Offset:
+			span.Start.Offset, span.End.Offset = start, end
+			span.Start.Line = uint(int(span.Start.Line) + lineShift)
+			span.End.Line = uint(int(span.End.Line) + lineShift)
+		}
+	}
+	for _, occ := range prev.occurrences {
+		var ok bool
+		if occ.start, occ.end, ok = move(occ.start, occ.end); ok && (occ.def < 0 || !dropped[occ.def]) {
+			doc.occurrences = append(doc.occurrences, occ)
+		}
+	}
+}
+
+// index lists the identifiers of the document, in the order they appear,
+// at the spans where the compiler declared or referenced them.
+func (doc *lspDocument) index(symbols *symbolTable) {
+	doc.defs = symbols.defs
+	for k, def := range symbols.defs {
+		if def.span.End.Offset > def.span.Start.Offset {
+			doc.occurrences = append(doc.occurrences, lspOccurrence{start: def.span.Start.Offset, end: def.span.End.Offset, name: def.name, def: k, decl: true})
+		}
+	}
+	for _, ref := range symbols.refs {
+		if ref.span.End.Offset > ref.span.Start.Offset {
+			doc.occurrences = append(doc.occurrences, lspOccurrence{start: ref.span.Start.Offset, end: ref.span.End.Offset, name: ref.name, def: ref.def})
+		}
+	}
+	slices.SortFunc(doc.occurrences, func(a, b lspOccurrence) int { return cmp.Compare(a.start, b.start) })
+}
+
+func (doc *lspDocument) position(offset int) lspPosition {
+	line := sort.Search(len(doc.lines), func(i int) bool { return doc.lines[i] > offset }) - 1
+	return lspPosition{Line: line, Character: utf16Length(doc.text[doc.lines[line]:offset])}
+}
+
+func (doc *lspDocument) offset(p lspPosition) int {
+	if p.Line < 0 {
+		return 0
+	}
+	if p.Line >= len(doc.lines) {
+		return len(doc.text)
+	}
+	offset := doc.lines[p.Line]
+	for units := 0; offset < len(doc.text) && doc.text[offset] != '\n' && units < p.Character; {
+		r, size := utf8.DecodeRuneInString(doc.text[offset:])
+		units += utf16Length(string(r))
+		offset += size
+	}
+	return offset
+}
+
+func utf16Length(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+func (doc *lspDocument) errorDiagnostic(err error) lspDiagnostic {
+	d := lspDiagnostic{Range: doc.lineRange(0), Severity: lspSeverityError, Source: "vida", Message: err.Error()}
+	var vErr verror.VidaError
+	if errors.As(err, &vErr) {
+		d.Range, d.Message = doc.lineRange(vErr.Line), strings.TrimSpace(vErr.Message)
+		if vErr.Span.IsValid() && vErr.Span.Start.Line == vErr.Line && vErr.Span.End.Offset <= len(doc.text) {
+			d.Range = lspRange{Start: doc.position(vErr.Span.Start.Offset), End: doc.position(vErr.Span.End.Offset)}
+		}
+	}
+	return d
+}
+
+// lineRange returns the range of a line numbered from 1 as the compiler does,
+// without its leading spaces. Line 0 stands for the first line.
+func (doc *lspDocument) lineRange(line uint) lspRange {
+	k := max(int(line)-1, 0)
+	if k >= len(doc.lines) {
+		k = len(doc.lines) - 1
+	}
+	start, end := doc.lines[k], len(doc.text)
+	if k+1 < len(doc.lines) {
+		end = doc.lines[k+1] - 1
+	}
+	text := doc.text[start:end]
+	start += len(text) - len(strings.TrimLeft(text, " \t"))
+	end -= len(text) - len(strings.TrimRight(text, " \t\r"))
+	return lspRange{Start: doc.position(start), End: doc.position(max(start, end))}
+}
+
+func (doc *lspDocument) location(occ lspOccurrence) lspLocation {
+	return lspLocation{URI: doc.uri, Range: lspRange{Start: doc.position(occ.start), End: doc.position(occ.end)}}
+}
+
+func (doc *lspDocument) occurrenceAt(offset int) (lspOccurrence, bool) {
+	for _, occ := range doc.occurrences {
+		if occ.start <= offset && offset <= occ.end {
+			return occ, true
+		}
+	}
+	return lspOccurrence{}, false
+}
+
+func (doc *lspDocument) definition(offset int) any {
+	occ, ok := doc.occurrenceAt(offset)
+	if !ok || occ.def < 0 {
+		return nil
+	}
+	span := doc.defs[occ.def].span
+	return lspLocation{URI: doc.uri, Range: lspRange{Start: doc.position(span.Start.Offset), End: doc.position(span.End.Offset)}}
+}
+
+func (doc *lspDocument) references(offset int, includeDeclaration bool) []lspLocation {
+	locations := []lspLocation{}
+	occ, ok := doc.occurrenceAt(offset)
+	if !ok {
+		return locations
+	}
+	for _, other := range doc.occurrences {
+		if other.def == occ.def && (other.def >= 0 || other.name == occ.name) && (includeDeclaration || !other.decl) {
+			locations = append(locations, doc.location(other))
+		}
+	}
+	return locations
+}
+
+func (doc *lspDocument) hover(offset int) any {
+	occ, ok := doc.occurrenceAt(offset)
+	if !ok {
+		return nil
+	}
+	var text string
+	switch {
+	case occ.def >= 0:
+		def := doc.defs[occ.def]
+		kinds := [...]string{symbolGlobal: "let", symbolLocal: "var", symbolParam: "parameter", symbolLoop: "loop variable", symbolPattern: "pattern variable"}
+		text = fmt.Sprintf("%v %v\ndeclared at line %v", kinds[def.kind], def.name, def.span.Start.Line)
+		if def.module != "" {
+			text += fmt.Sprintf("\nlibrary %v", def.module)
+		}
+	case occ.def == lspCoreLib:
+		k := slices.Index(coreLibNames, occ.name)
+		if k < 1 {
+			return nil
+		}
+		var lines []string
+		for _, line := range strings.Split(coreLibDescription[k], "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		text = fmt.Sprintf("%v\n\n%v", occ.name, strings.Join(lines, "\n"))
+	default:
+		return nil
+	}
+	return map[string]any{
+		"contents": map[string]any{"kind": "plaintext", "value": text},
+		"range":    lspRange{Start: doc.position(occ.start), End: doc.position(occ.end)},
+	}
+}
+
+// completion offers the members of a library after a name bound to it and a dot,
+// and otherwise the keywords, the corelib and the names declared in the document.
+func (s *lspServer) completion(doc *lspDocument, offset int) []lspCompletionItem {
+	items := []lspCompletionItem{}
+	start := offset
+	for start > 0 && isIdentifierByte(doc.text[start-1]) {
+		start--
+	}
+	if start > 0 && doc.text[start-1] == '.' {
+		for _, occ := range doc.occurrences {
+			if occ.end == start-1 && occ.def >= 0 && doc.defs[occ.def].module != "" {
+				return s.members(doc.defs[occ.def].module)
+			}
+		}
+		end := start - 1
+		for start = end; start > 0 && isIdentifierByte(doc.text[start-1]); start-- {
+		}
+		for i := len(doc.defs) - 1; i >= 0; i-- {
+			if doc.defs[i].name == doc.text[start:end] && doc.defs[i].module != "" {
+				return s.members(doc.defs[i].module)
+			}
+		}
+		return items
+	}
+	for t := token.Token(0); int(t) < len(token.Tokens); t++ {
+		if t.IsKeyword() {
+			items = append(items, lspCompletionItem{Label: token.Tokens[t], Kind: lspCompletionKeyword})
+		}
+	}
+	for _, name := range coreLibNames[1:] {
+		items = append(items, lspCompletionItem{Label: name, Kind: lspCompletionFunction, Detail: "corelib"})
+	}
+	seen := make(map[string]bool)
+	for _, def := range doc.defs {
+		if !seen[def.name] && !strings.HasPrefix(def.name, "*") {
+			seen[def.name] = true
+			items = append(items, lspCompletionItem{Label: def.name, Kind: lspCompletionVariable})
+		}
+	}
+	return items
+}
+
+func (s *lspServer) members(module string) []lspCompletionItem {
+	items := []lspCompletionItem{}
+	store := loadCoreLib(&[]Value{})
+	load := libLoader(store, s.libs, module)
+	if load == nil {
+		return items
+	}
+	lib, ok := load().(*Object)
+	if !ok {
+		return items
+	}
+	keys := make([]string, 0, len(lib.Value))
+	for k := range lib.Value {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		kind := lspCompletionField
+		if lib.Value[k].IsCallable() {
+			kind = lspCompletionFunction
+		}
+		items = append(items, lspCompletionItem{Label: k, Kind: kind, Detail: lib.Value[k].Type()})
+	}
+	return items
+}
+
+func isIdentifierByte(b byte) bool {
+	return b == '_' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || b >= utf8.RuneSelf
+}
@@ -0,0 +1,36 @@
+package vida
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLSPKeepsIndexOnSyntaxError(t *testing.T) {
+	src := "let total = 10\nprint(total)\nlet half = total / 2\n"
+	doc := newLSPDocument("file:///tmp/doc.vida", src, nil)
+	if len(doc.diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", doc.diagnostics)
+	}
+	broken := strings.Replace(src, "print(total)", "print(total) +\nvar = (", 1)
+	doc = newLSPDocument(doc.uri, broken, doc)
+	if len(doc.diagnostics) == 0 {
+		t.Error("no diagnostic for the syntax error")
+	}
+	at := func(line, character int) int {
+		return doc.offset(lspPosition{Line: line, Character: character})
+	}
+	if doc.hover(at(1, 1)) == nil {
+		t.Error("no hover for print")
+	}
+	loc, ok := doc.definition(at(3, 12)).(lspLocation)
+	if !ok || loc.Range.Start != (lspPosition{Line: 0, Character: 4}) {
+		t.Errorf("definition of total after the edit is %v, want line 0, character 4", doc.definition(at(3, 12)))
+	}
+	hover, ok := doc.hover(at(3, 5)).(map[string]any)
+	if !ok || !strings.Contains(hover["contents"].(map[string]any)["value"].(string), "declared at line 4") {
+		t.Errorf("hover of half after the edit is %v, want it declared at line 4", doc.hover(at(3, 5)))
+	}
+	if got := doc.references(at(0, 5), true); len(got) != 3 {
+		t.Errorf("found %v references to total, want 3", len(got))
+	}
+}
@@ -6,9 +6,9 @@ import (
 	"runtime"
 )
 
-func loadFoundationOS() Value {
+func loadFoundationOS(store *[]Value) Value {
 	m := &Object{Value: make(map[string]Value)}
-	m.Value["args"] = GFn(args)
+	m.Value["args"] = gfnArgs(store)
 	m.Value["env"] = GFn(environ)
 	m.Value["exit"] = GFn(exit)
 	m.Value["getFromEnv"] = GFn(getEnv)
@@ -29,12 +29,21 @@ func loadFoundationOS() Value {
 	return m
 }
 
-func args(args ...Value) (Value, error) {
-	xs := &List{}
-	for _, v := range os.Args {
-		xs.Value = append(xs.Value, &String{Value: v})
+// gfnArgs returns the arguments given to the interpreter with SetArgs,
+// or those of the process when none were given.
+func gfnArgs(store *[]Value) GFn {
+	return func(args ...Value) (Value, error) {
+		main := (*store)[mainThIndex].(*Thread)
+		values := main.args
+		if values == nil {
+			values = os.Args
+		}
+		xs := &List{}
+		for _, v := range values {
+			xs.Value = append(xs.Value, &String{Value: v})
+		}
+		return xs, nil
 	}
-	return xs, nil
 }
 
 func environ(args ...Value) (Value, error) {
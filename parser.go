@@ -1,7 +1,9 @@
 package vida
 
 import (
+	"cmp"
 	"fmt"
+	"slices"
 	"strconv"
 
 	"github.com/alkemist-17/vida/ast"
@@ -15,13 +17,17 @@ const (
 	ellipsisLast
 )
 
+// bailout unwinds the parser from an error up to the statement that holds it.
+type bailout struct{}
+
 type parser struct {
-	err     verror.VidaError
+	errs    verror.ErrorList
 	current token.TokenInfo
 	next    token.TokenInfo
 	lexer   *lexer.Lexer
 	ast     *ast.Ast
 	ok      bool
+	braces  int
 }
 
 func newParser(src []byte, scriptName string) *parser {
@@ -36,46 +42,46 @@ func newParser(src []byte, scriptName string) *parser {
 }
 
 func (p *parser) parse() (*ast.Ast, error) {
-	for p.ok {
+	for {
 		switch p.current.Token {
-		case token.IDENTIFIER:
-			p.ast.Statement = append(p.ast.Statement, p.mutOrCall(&p.ast.Statement))
-		case token.LET:
-			p.ast.Statement = append(p.ast.Statement, p.global())
-		case token.VAR:
-			p.ast.Statement = append(p.ast.Statement, p.localStmt())
-		case token.IF:
-			p.ast.Statement = append(p.ast.Statement, p.ifStmt(false))
-		case token.FOR:
-			p.ast.Statement = append(p.ast.Statement, p.forLoop())
-		case token.WHILE:
-			p.ast.Statement = append(p.ast.Statement, p.loop())
-		case token.LCURLY:
-			p.ast.Statement = append(p.ast.Statement, p.block(false))
-			p.advance()
 		case token.COMMENT:
 			for p.current.Token == token.COMMENT {
 				p.advance()
 			}
 		case token.EXPORT:
-			p.ast.Statement = append(p.ast.Statement, p.export())
-			if p.ok {
-				return p.ast, nil
-			}
-			return nil, p.err
+			p.guard(func() { p.ast.Statement = append(p.ast.Statement, p.export()) }, false)
+			return p.result()
 		case token.EOF:
 			p.ast.Statement = append(p.ast.Statement, &ast.Ret{Expr: &ast.Nil{}})
-			return p.ast, nil
+			return p.result()
 		default:
-			if p.current.Token == token.UNEXPECTED {
-				p.err = p.lexer.LexicalError
-			} else {
-				p.err = verror.New(p.lexer.ScriptName, "expected high level statement", verror.SyntaxErrType, p.current.Line)
-			}
-			return nil, p.err
+			p.guard(p.statement, false)
 		}
 	}
-	return nil, p.err
+}
+
+func (p *parser) statement() {
+	switch p.current.Token {
+	case token.IDENTIFIER:
+		p.ast.Statement = append(p.ast.Statement, p.mutOrCall(&p.ast.Statement))
+	case token.LET:
+		p.ast.Statement = append(p.ast.Statement, p.global())
+	case token.VAR:
+		p.ast.Statement = append(p.ast.Statement, p.localStmt())
+	case token.IF:
+		p.ast.Statement = append(p.ast.Statement, p.ifStmt(false))
+	case token.FOR:
+		p.ast.Statement = append(p.ast.Statement, p.forLoop())
+	case token.WHILE:
+		p.ast.Statement = append(p.ast.Statement, p.loop())
+	case token.MATCH:
+		p.ast.Statement = append(p.ast.Statement, p.matchStmt(false))
+	case token.LCURLY:
+		p.ast.Statement = append(p.ast.Statement, p.block(false))
+		p.advance()
+	default:
+		p.error(verror.NewAt(p.lexer.ScriptName, "expected high level statement", verror.SyntaxErrType, p.current.Span))
+	}
 }
 
 func (p *parser) mutOrCall(statements *[]ast.Node) ast.Node {
@@ -86,103 +92,126 @@ func (p *parser) mutOrCall(statements *[]ast.Node) ast.Node {
 		return p.mutDSOrCall(statements)
 	}
 	line := p.current.Line
-	i := p.current.Lit
+	start := p.current.Span.Start
+	i, iSpan := p.current.Lit, p.current.Span
 	p.advance()
-	p.expect(token.ASSIGN)
+	op := p.assignment()
 	p.advance()
 	e := p.expression(token.LowestPrec)
+	span := p.span(start)
 	p.advance()
-	return &ast.Mut{Indentifier: i, Expr: e, Line: line}
+	return &ast.Mut{Identifier: i, Expr: e, Op: op, Line: line, Span: span, IdentifierSpan: iSpan}
 }
 
 func (p *parser) localStmt() ast.Node {
 	isRecursive := false
+	line := p.current.Line
+	start := p.current.Span.Start
 	p.advance()
+	if p.current.Token == token.LBRACKET || p.current.Token == token.LCURLY {
+		return p.destructure(token.VAR, line, start)
+	}
 	if p.current.Token == token.REC {
 		isRecursive = true
 		p.advance()
 	}
 	p.expect(token.IDENTIFIER)
-	i := p.current.Lit
+	i, iSpan := p.current.Lit, p.current.Span
 	p.advance()
 	p.expect(token.ASSIGN)
 	p.advance()
 	e := p.expression(token.LowestPrec)
+	span := p.span(start)
 	p.advance()
-	return &ast.Var{Identifier: i, Expr: e, IsRecursive: isRecursive}
+	return &ast.Var{Identifier: i, Expr: e, IsRecursive: isRecursive, Line: line, Span: span, IdentifierSpan: iSpan}
 }
 
 func (p *parser) global() ast.Node {
+	line := p.current.Line
+	start := p.current.Span.Start
 	p.advance()
+	if p.current.Token == token.LBRACKET || p.current.Token == token.LCURLY {
+		return p.destructure(token.LET, line, start)
+	}
 	p.expect(token.IDENTIFIER)
-	i := p.current.Lit
+	i, iSpan := p.current.Lit, p.current.Span
+	p.advance()
+	p.expect(token.ASSIGN)
+	p.advance()
+	e := p.expression(token.LowestPrec)
+	span := p.span(start)
+	p.advance()
+	return &ast.Let{Identifier: i, Expr: e, Line: line, Span: span, IdentifierSpan: iSpan}
+}
+
+func (p *parser) destructure(decl token.Token, line uint, start token.Pos) ast.Node {
+	target := p.pattern(false)
 	p.advance()
 	p.expect(token.ASSIGN)
 	p.advance()
 	e := p.expression(token.LowestPrec)
+	span := p.span(start)
 	p.advance()
-	return &ast.Let{Indentifier: i, Expr: e}
+	return &ast.Destructure{Pattern: target, Expr: e, Decl: decl, Line: line, Span: span}
 }
 
 func (p *parser) block(isInsideLoop bool) ast.Node {
 	block := &ast.Block{}
+	start := p.current.Span.Start
 	p.advance()
 	for p.current.Token != token.RCURLY {
-		switch p.current.Token {
-		case token.IDENTIFIER:
-			block.Statement = append(block.Statement, p.mutOrCall(&block.Statement))
-		case token.LET:
-			block.Statement = append(block.Statement, p.global())
-		case token.VAR:
-			block.Statement = append(block.Statement, p.localStmt())
-		case token.IF:
-			block.Statement = append(block.Statement, p.ifStmt(isInsideLoop))
-		case token.FOR:
-			block.Statement = append(block.Statement, p.forLoop())
-		case token.WHILE:
-			block.Statement = append(block.Statement, p.loop())
-		case token.RET:
-			block.Statement = append(block.Statement, p.ret())
-		case token.BREAK:
-			if isInsideLoop {
-				block.Statement = append(block.Statement, p.breakStmt())
-			} else {
-				if p.ok {
-					p.err = verror.New(p.lexer.ScriptName, "found a break keyword outside of a loop", verror.SyntaxErrType, p.current.Line)
-					p.ok = false
-				}
-				return block
-			}
-		case token.CONTINUE:
-			if isInsideLoop {
-				block.Statement = append(block.Statement, p.continueStmt())
-			} else {
-				if p.ok {
-					p.err = verror.New(p.lexer.ScriptName, "found a continue keyword outside of a loop", verror.SyntaxErrType, p.current.Line)
-					p.ok = false
-				}
-				return block
-			}
-		case token.LCURLY:
-			block.Statement = append(block.Statement, p.block(isInsideLoop))
-			p.advance()
-		case token.COMMENT:
-			for p.current.Token == token.COMMENT {
-				p.advance()
-			}
-		default:
-			if p.ok {
-				p.err = verror.New(p.lexer.ScriptName, "expected a block statement", verror.SyntaxErrType, p.current.Line)
-				p.ok = false
-			}
-			return block
+		if p.current.Token == token.EOF {
+			p.error(verror.NewAt(p.lexer.ScriptName, "expected a block statement", verror.SyntaxErrType, p.current.Span))
 		}
+		p.guard(func() { p.blockStatement(block, isInsideLoop) }, true)
 	}
+	block.Span = p.span(start)
 	return block
 }
 
+func (p *parser) blockStatement(block *ast.Block, isInsideLoop bool) {
+	switch p.current.Token {
+	case token.IDENTIFIER:
+		block.Statement = append(block.Statement, p.mutOrCall(&block.Statement))
+	case token.LET:
+		block.Statement = append(block.Statement, p.global())
+	case token.VAR:
+		block.Statement = append(block.Statement, p.localStmt())
+	case token.IF:
+		block.Statement = append(block.Statement, p.ifStmt(isInsideLoop))
+	case token.FOR:
+		block.Statement = append(block.Statement, p.forLoop())
+	case token.WHILE:
+		block.Statement = append(block.Statement, p.loop())
+	case token.MATCH:
+		block.Statement = append(block.Statement, p.matchStmt(isInsideLoop))
+	case token.RET:
+		block.Statement = append(block.Statement, p.ret())
+	case token.BREAK:
+		if !isInsideLoop {
+			p.error(verror.NewAt(p.lexer.ScriptName, "found a break keyword outside of a loop", verror.SyntaxErrType, p.current.Span))
+		}
+		block.Statement = append(block.Statement, p.breakStmt())
+	case token.CONTINUE:
+		if !isInsideLoop {
+			p.error(verror.NewAt(p.lexer.ScriptName, "found a continue keyword outside of a loop", verror.SyntaxErrType, p.current.Span))
+		}
+		block.Statement = append(block.Statement, p.continueStmt())
+	case token.LCURLY:
+		block.Statement = append(block.Statement, p.block(isInsideLoop))
+		p.advance()
+	case token.COMMENT:
+		for p.current.Token == token.COMMENT {
+			p.advance()
+		}
+	default:
+		p.error(verror.NewAt(p.lexer.ScriptName, "expected a block statement", verror.SyntaxErrType, p.current.Span))
+	}
+}
+
 func (p *parser) mutDSOrCall(statements *[]ast.Node) ast.Node {
-	*statements = append(*statements, &ast.ReferenceStmt{Value: p.current.Lit, Line: p.current.Line})
+	*statements = append(*statements, &ast.ReferenceStmt{Value: p.current.Lit, Line: p.current.Line, Span: p.current.Span})
+	start := p.current.Span.Start
 	var i ast.Node
 Loop:
 	for p.next.Token == token.LBRACKET ||
@@ -196,18 +225,18 @@ Loop:
 			i = p.expression(token.LowestPrec)
 			p.advance()
 			p.expect(token.RBRACKET)
-			if p.next.Token == token.ASSIGN {
+			if p.next.Token == token.ASSIGN || p.next.Token.IsAssignOperator() {
 				goto assignment
 			}
-			*statements = append(*statements, &ast.IGetStmt{Index: i, Line: p.current.Line})
+			*statements = append(*statements, &ast.IGetStmt{Index: i, Line: p.current.Line, Span: p.span(start)})
 		case token.DOT:
 			p.advance()
 			p.expect(token.IDENTIFIER)
-			i = &ast.Property{Value: p.current.Lit}
-			if p.next.Token == token.ASSIGN {
+			i = &ast.Property{Value: p.current.Lit, Span: p.current.Span}
+			if p.next.Token == token.ASSIGN || p.next.Token.IsAssignOperator() {
 				goto assignment
 			}
-			*statements = append(*statements, &ast.SelectStmt{Selector: i})
+			*statements = append(*statements, &ast.SelectStmt{Selector: i, Span: p.span(start)})
 		case token.LPAREN:
 			var args []ast.Node
 			var ellipsis int
@@ -243,17 +272,18 @@ Loop:
 				p.next.Token != token.DOT &&
 				p.next.Token != token.LPAREN &&
 				p.next.Token != token.METHOD_CALL {
+				span := p.span(start)
 				p.advance()
-				return &ast.CallStmt{Args: args, Ellipsis: ellipsis, Line: line}
+				return &ast.CallStmt{Args: args, Ellipsis: ellipsis, Line: line, Span: span}
 			}
-			*statements = append(*statements, &ast.CallStmt{Args: args, Ellipsis: ellipsis, Line: line})
+			*statements = append(*statements, &ast.CallStmt{Args: args, Ellipsis: ellipsis, Line: line, Span: p.span(start)})
 		case token.METHOD_CALL:
 			var args []ast.Node
 			var ellipsis int
 			p.advance()
 			p.expect(token.IDENTIFIER)
 			line := p.current.Line
-			prop := &ast.Property{Value: p.current.Lit}
+			prop := &ast.Property{Value: p.current.Lit, Span: p.current.Span}
 			p.advance()
 			p.expect(token.LPAREN)
 			p.advance()
@@ -287,25 +317,36 @@ Loop:
 				p.next.Token != token.DOT &&
 				p.next.Token != token.LPAREN &&
 				p.next.Token != token.METHOD_CALL {
+				span := p.span(start)
 				p.advance()
-				return &ast.MethodCallStmt{Args: args, Prop: prop, Ellipsis: ellipsis, Line: line}
+				return &ast.MethodCallStmt{Args: args, Prop: prop, Ellipsis: ellipsis, Line: line, Span: span}
 			}
-			*statements = append(*statements, &ast.MethodCallStmt{Args: args, Prop: prop, Ellipsis: ellipsis, Line: line})
+			*statements = append(*statements, &ast.MethodCallStmt{Args: args, Prop: prop, Ellipsis: ellipsis, Line: line, Span: p.span(start)})
 		default:
 			break Loop
 		}
 	}
 assignment:
 	p.advance()
-	p.expect(token.ASSIGN)
+	op := p.assignment()
 	p.advance()
 	e := p.expression(token.LowestPrec)
+	span := p.span(start)
 	p.advance()
-	return &ast.ISet{Index: i, Expr: e, Line: p.current.Line}
+	return &ast.ISet{Index: i, Expr: e, Op: op, Line: p.current.Line, Span: span}
+}
+
+// assignment expects = or a compound assignment operator, like +=, and returns it.
+func (p *parser) assignment() token.Token {
+	if !p.current.Token.IsAssignOperator() {
+		p.expect(token.ASSIGN)
+	}
+	return p.current.Token
 }
 
 func (p *parser) forLoop() ast.Node {
 	line := p.current.Line
+	start := p.current.Span.Start
 	p.advance()
 	if p.current.Token == token.IN {
 		p.advance()
@@ -313,15 +354,16 @@ func (p *parser) forLoop() ast.Node {
 		p.advance()
 		p.expect(token.LCURLY)
 		b := p.block(true)
+		span := p.span(start)
 		p.advance()
 		id := "*_"
-		return &ast.IFor{Key: id, Value: id, Expr: e, Block: b, Line: line}
+		return &ast.IFor{Key: id, Value: id, Expr: e, Block: b, Line: line, Span: span}
 	}
 	p.expect(token.IDENTIFIER)
-	id := p.current.Lit
+	id, idSpan := p.current.Lit, p.current.Span
 	p.advance()
 	if p.current.Token == token.COMMA {
-		return p.iterforLoop(id)
+		return p.iterforLoop(id, idSpan, start)
 	}
 	var init, end, step ast.Node
 	p.expect(token.IN)
@@ -342,20 +384,28 @@ func (p *parser) forLoop() ast.Node {
 		}
 		p.expect(token.LCURLY)
 		block := p.block(true)
+		span := p.span(start)
 		p.advance()
-		return &ast.For{Init: init, End: end, Id: id, Step: step, Block: block, Line: line}
+		return &ast.For{Init: init, End: end, Id: id, Step: step, Block: block, Line: line, Span: span, IdSpan: idSpan}
 	}
 	p.expect(token.LCURLY)
 	block := p.block(true)
+	span := p.span(start)
 	p.advance()
-	return &ast.For{Init: &ast.Integer{Value: 0}, End: init, Id: id, Step: &ast.Integer{Value: 1}, Block: block, Line: line}
+	return &ast.For{Init: &ast.Integer{Value: 0}, End: init, Id: id, Step: &ast.Integer{Value: 1}, Block: block, Line: line, Span: span, IdSpan: idSpan}
 }
 
-func (p *parser) iterforLoop(key string) ast.Node {
+func (p *parser) iterforLoop(key string, keySpan token.Span, start token.Pos) ast.Node {
 	line := p.current.Line
 	p.advance()
-	p.expect(token.IDENTIFIER)
-	v := p.current.Lit
+	var target ast.Node
+	v, vSpan := p.current.Lit, p.current.Span
+	if p.current.Token == token.LBRACKET || p.current.Token == token.LCURLY {
+		target = p.pattern(false)
+		v, vSpan = "*v", token.Span{}
+	} else {
+		p.expect(token.IDENTIFIER)
+	}
 	p.advance()
 	p.expect(token.IN)
 	p.advance()
@@ -363,66 +413,228 @@ func (p *parser) iterforLoop(key string) ast.Node {
 	p.advance()
 	p.expect(token.LCURLY)
 	b := p.block(true)
+	span := p.span(start)
 	p.advance()
-	return &ast.IFor{Key: key, Value: v, Expr: e, Block: b, Line: line}
+	if target != nil {
+		destructure(b, target, v, token.FOR, line)
+	}
+	return &ast.IFor{Key: key, Value: v, Expr: e, Block: b, Line: line, Span: span, KeySpan: keySpan, ValueSpan: vSpan}
+}
+
+// destructure makes block start by destructuring the hidden variable
+// that holds the value a loop or a function binds to a list or an object.
+func destructure(block ast.Node, target ast.Node, hidden string, decl token.Token, line uint) {
+	b := block.(*ast.Block)
+	d := &ast.Destructure{Pattern: target, Expr: &ast.Reference{Value: hidden, Line: line}, Decl: decl, Line: line, Span: b.Span}
+	b.Statement = append([]ast.Node{d}, b.Statement...)
 }
 
 func (p *parser) ifStmt(isInsideLoop bool) ast.Node {
+	line := p.current.Line
+	start := p.current.Span.Start
 	p.advance()
 	c := p.expression(token.LowestPrec)
 	p.advance()
 	p.expect(token.LCURLY)
 	b := p.block(isInsideLoop)
+	branch := &ast.Branch{If: &ast.If{Condition: c, Block: b, Line: line, Span: p.span(start)}}
+	branch.Span = p.span(start)
 	p.advance()
-	branch := &ast.Branch{If: &ast.If{Condition: c, Block: b}}
 	for p.current.Token == token.ELSE && p.next.Token == token.IF {
 		p.advance()
+		line := p.current.Line
+		elifStart := p.current.Span.Start
 		p.advance()
 		c := p.expression(token.LowestPrec)
 		p.advance()
 		p.expect(token.LCURLY)
 		b := p.block(isInsideLoop)
+		branch.Elifs = append(branch.Elifs, &ast.If{Condition: c, Block: b, Line: line, Span: p.span(elifStart)})
+		branch.Span = p.span(start)
 		p.advance()
-		branch.Elifs = append(branch.Elifs, &ast.If{Condition: c, Block: b})
 	}
 	if p.current.Token == token.ELSE {
+		elseStart := p.current.Span.Start
 		p.advance()
 		b := p.block(isInsideLoop)
+		branch.Else = &ast.Else{Block: b, Span: p.span(elseStart)}
+		branch.Span = p.span(start)
 		p.advance()
-		branch.Else = &ast.Else{Block: b}
 	}
 	return branch
 }
 
 func (p *parser) loop() ast.Node {
+	line := p.current.Line
+	start := p.current.Span.Start
 	p.advance()
 	c := p.expression(token.LowestPrec)
 	p.advance()
 	p.expect(token.LCURLY)
 	b := p.block(true)
+	span := p.span(start)
+	p.advance()
+	return &ast.While{Condition: c, Block: b, Line: line, Span: span}
+}
+
+func (p *parser) matchStmt(isInsideLoop bool) ast.Node {
+	line := p.current.Line
+	start := p.current.Span.Start
+	p.advance()
+	m := &ast.Match{Subject: p.expression(token.LowestPrec), Line: line}
 	p.advance()
-	return &ast.While{Condition: c, Block: b}
+	p.expect(token.LCURLY)
+	p.advance()
+	for p.current.Token != token.RCURLY || len(m.Arms) == 0 {
+		if p.current.Token == token.RCURLY || p.current.Token == token.EOF {
+			p.error(verror.NewAt(p.lexer.ScriptName, "expected a match arm", verror.SyntaxErrType, p.current.Span))
+		}
+		m.Arms = append(m.Arms, p.matchArm(isInsideLoop))
+	}
+	m.Span = p.span(start)
+	p.advance()
+	return m
+}
+
+func (p *parser) matchArm(isInsideLoop bool) *ast.MatchArm {
+	arm := &ast.MatchArm{Line: p.current.Line}
+	start := p.current.Span.Start
+	arm.Pattern = p.pattern(true)
+	p.advance()
+	if p.current.Token == token.IF {
+		p.advance()
+		arm.Guard = p.expression(token.LowestPrec)
+		p.advance()
+	}
+	p.expect(token.ARROW)
+	p.advance()
+	p.expect(token.LCURLY)
+	arm.Block = p.block(isInsideLoop)
+	arm.Span = p.span(start)
+	p.advance()
+	return arm
+}
+
+// pattern parses a pattern, leaving the parser on its last token. A name binds
+// the value unless it is _, which matches anything. A list matches its items in
+// order and binds the ones left over to the name before an ellipsis. An object
+// matches every field against the pattern after =, or binds it to a name of its
+// own, and takes the default after or instead when the field is missing or nil.
+// Literals and dotted paths, whose value is compared as a literal is, only fit
+// where a pattern may fail to match, so a destructuring is not refutable.
+func (p *parser) pattern(refutable bool) ast.Node {
+	start := p.current.Span.Start
+	switch p.current.Token {
+	case token.IDENTIFIER:
+		if refutable && p.next.Token == token.DOT {
+			e := p.primary()
+			return &ast.ValuePattern{Value: e, Span: p.span(start)}
+		}
+		if p.current.Lit == "_" {
+			return &ast.Wildcard{Span: p.current.Span}
+		}
+		return &ast.BindPattern{Identifier: p.current.Lit, Line: p.current.Line, Span: p.current.Span}
+	case token.SUB, token.ADD:
+		if !refutable {
+			break
+		}
+		if p.next.Token != token.INTEGER && p.next.Token != token.FLOAT {
+			p.error(verror.NewAt(p.lexer.ScriptName, "expected a number after the sign", verror.SyntaxErrType, p.next.Span))
+		}
+		e := p.prefix()
+		return &ast.ValuePattern{Value: e, Span: p.span(start)}
+	case token.INTEGER, token.FLOAT, token.STRING, token.TRUE, token.FALSE, token.NIL:
+		if !refutable {
+			break
+		}
+		e := p.operand()
+		return &ast.ValuePattern{Value: e, Span: p.span(start)}
+	case token.LBRACKET:
+		xs := &ast.ListPattern{}
+		p.advance()
+		for p.current.Token != token.RBRACKET {
+			if p.current.Token == token.ELLIPSIS {
+				p.advance()
+				p.expect(token.IDENTIFIER)
+				if p.current.Lit == "_" {
+					xs.Rest = &ast.Wildcard{Span: p.current.Span}
+				} else {
+					xs.Rest = &ast.BindPattern{Identifier: p.current.Lit, Line: p.current.Line, Span: p.current.Span}
+				}
+				p.advance()
+				p.expect(token.RBRACKET)
+				break
+			}
+			xs.Elements = append(xs.Elements, p.pattern(refutable))
+			p.advance()
+			if p.current.Token != token.RBRACKET {
+				p.expect(token.COMMA)
+				p.advance()
+			}
+		}
+		xs.Span = p.span(start)
+		return xs
+	case token.LCURLY:
+		obj := &ast.ObjectPattern{}
+		p.advance()
+		for p.current.Token != token.RCURLY {
+			p.expect(token.IDENTIFIER)
+			f := &ast.FieldPattern{Key: p.current.Lit}
+			fieldStart := p.current.Span.Start
+			if p.next.Token == token.COLON {
+				p.advance()
+				p.advance()
+				f.Pattern = p.pattern(refutable)
+			} else {
+				f.Pattern = &ast.BindPattern{Identifier: f.Key, Line: p.current.Line, Span: p.current.Span}
+			}
+			if p.next.Token == token.ASSIGN {
+				p.advance()
+				p.advance()
+				f.Default = p.expression(token.LowestPrec)
+			}
+			f.Span = p.span(fieldStart)
+			obj.Fields = append(obj.Fields, f)
+			p.advance()
+			if p.current.Token == token.COMMA {
+				p.advance()
+			}
+		}
+		obj.Span = p.span(start)
+		return obj
+	}
+	if refutable {
+		p.error(verror.NewAt(p.lexer.ScriptName, "expected a pattern", verror.SyntaxErrType, p.current.Span))
+	} else {
+		p.error(verror.NewAt(p.lexer.ScriptName, "expected a name, a list or an object to bind", verror.SyntaxErrType, p.current.Span))
+	}
+	return &ast.Wildcard{}
 }
 
 func (p *parser) breakStmt() ast.Node {
+	line := p.current.Line
+	span := p.current.Span
 	p.advance()
-	return &ast.Break{}
+	return &ast.Break{Line: line, Span: span}
 }
 
 func (p *parser) continueStmt() ast.Node {
+	line := p.current.Line
+	span := p.current.Span
 	p.advance()
-	return &ast.Continue{}
+	return &ast.Continue{Line: line, Span: span}
 }
 
 func (p *parser) expression(precedence int) ast.Node {
 	line := p.current.Line
+	start := p.current.Span.Start
 	e := p.prefix()
 	for p.next.Token.IsBinaryOperator() && p.next.Token.Precedence() > precedence {
 		p.advance()
 		op := p.current.Token
 		p.advance()
 		r := p.expression(op.Precedence())
-		e = &ast.BinaryExpr{Op: op, Lhs: e, Rhs: r, Line: line}
+		e = &ast.BinaryExpr{Op: op, Lhs: e, Rhs: r, Line: line, Span: p.span(start)}
 	}
 	return e
 }
@@ -431,14 +643,16 @@ func (p *parser) prefix() ast.Node {
 	switch p.current.Token {
 	case token.NOT, token.SUB, token.ADD, token.TILDE:
 		t := p.current.Token
+		start := p.current.Span.Start
 		p.advance()
 		e := p.prefix()
-		return &ast.PrefixExpr{Op: t, Expr: e, Line: p.current.Line}
+		return &ast.PrefixExpr{Op: t, Expr: e, Line: p.current.Line, Span: p.span(start)}
 	}
 	return p.primary()
 }
 
 func (p *parser) primary() ast.Node {
+	start := p.current.Span.Start
 	e := p.operand()
 Loop:
 	for p.next.Token == token.LBRACKET ||
@@ -448,23 +662,20 @@ Loop:
 		p.advance()
 		switch p.current.Token {
 		case token.LBRACKET:
-			e = p.indexOrSlice(e)
+			e = p.indexOrSlice(e, start)
 		case token.DOT:
 			p.advance()
 			switch p.current.Token {
 			case token.IDENTIFIER:
-				e = p.selector(e)
+				e = p.selector(e, start)
 			default:
-				if p.ok {
-					p.err = verror.New(p.lexer.ScriptName, "expected an identifier", verror.SyntaxErrType, p.current.Line)
-					p.ok = false
-				}
+				p.error(verror.NewAt(p.lexer.ScriptName, "expected an identifier", verror.SyntaxErrType, p.current.Span))
 				return &ast.Nil{}
 			}
 		case token.LPAREN:
-			e = p.callExpr(e)
+			e = p.callExpr(e, start)
 		case token.METHOD_CALL:
-			e = p.methodCallExpr(e)
+			e = p.methodCallExpr(e, start)
 		default:
 			break Loop
 		}
@@ -476,43 +687,35 @@ func (p *parser) operand() ast.Node {
 	switch p.current.Token {
 	case token.INTEGER:
 		if i, err := strconv.ParseUint(p.current.Lit, 0, 64); err == nil {
-			return &ast.Integer{Value: int64(i)}
+			return &ast.Integer{Value: int64(i), Span: p.current.Span}
 		} else {
-			if p.ok {
-				p.err = verror.New(p.lexer.ScriptName, "integer literal could not be processed", verror.SyntaxErrType, p.current.Line)
-				p.ok = false
-			}
+			p.error(verror.NewAt(p.lexer.ScriptName, "integer literal could not be processed", verror.SyntaxErrType, p.current.Span))
 			return &ast.Nil{}
 		}
 	case token.FLOAT:
 		if f, err := strconv.ParseFloat(p.current.Lit, 64); err == nil {
-			return &ast.Float{Value: f}
-		}
-		if p.ok {
-			p.err = verror.New(p.lexer.ScriptName, "float literal could not be processed", verror.SyntaxErrType, p.current.Line)
-			p.ok = false
+			return &ast.Float{Value: f, Span: p.current.Span}
 		}
+		p.error(verror.NewAt(p.lexer.ScriptName, "float literal could not be processed", verror.SyntaxErrType, p.current.Span))
 		return &ast.Nil{}
 	case token.STRING:
 		s, e := strconv.Unquote(p.current.Lit)
 		if e != nil {
-			if p.ok {
-				p.err = verror.New(p.lexer.ScriptName, "string literal could not be processed", verror.SyntaxErrType, p.current.Line)
-				p.ok = false
-			}
+			p.error(verror.NewAt(p.lexer.ScriptName, "string literal could not be processed", verror.SyntaxErrType, p.current.Span))
 			return &ast.Nil{}
 		}
-		return &ast.String{Value: s}
+		return &ast.String{Value: s, Span: p.current.Span}
 	case token.TRUE:
-		return &ast.Boolean{Value: true}
+		return &ast.Boolean{Value: true, Span: p.current.Span}
 	case token.FALSE:
-		return &ast.Boolean{Value: false}
+		return &ast.Boolean{Value: false, Span: p.current.Span}
 	case token.NIL:
-		return &ast.Nil{}
+		return &ast.Nil{Span: p.current.Span}
 	case token.IDENTIFIER:
-		return &ast.Reference{Value: p.current.Lit, Line: p.current.Line}
+		return &ast.Reference{Value: p.current.Lit, Line: p.current.Line, Span: p.current.Span}
 	case token.LBRACKET:
 		xs := &ast.List{}
+		start := p.current.Span.Start
 		p.advance()
 		for p.current.Token != token.RBRACKET && p.current.Token != token.EOF {
 			e := p.expression(token.LowestPrec)
@@ -522,6 +725,7 @@ func (p *parser) operand() ast.Node {
 				p.advance()
 				if p.current.Token == token.RBRACKET {
 					p.expect(token.RBRACKET)
+					xs.Span = p.span(start)
 					return xs
 				}
 				e := p.expression(token.LowestPrec)
@@ -532,50 +736,47 @@ func (p *parser) operand() ast.Node {
 		}
 	endList:
 		p.expect(token.RBRACKET)
+		xs.Span = p.span(start)
 		return xs
 	case token.LCURLY:
 		obj := &ast.Object{Line: p.current.Line}
+		start := p.current.Span.Start
 		p.advance()
 	loop:
 		for p.current.Token != token.RCURLY {
 			p.expect(token.IDENTIFIER)
-			k := &ast.Property{Value: p.current.Lit}
+			k := &ast.Property{Value: p.current.Lit, Span: p.current.Span}
 			p.advance()
 			if p.current.Token == token.COMMA {
 				p.advance()
 			}
 			switch p.current.Token {
 			case token.IDENTIFIER:
-				obj.Pairs = append(obj.Pairs, &ast.Pair{Key: k, Value: &ast.Nil{}})
+				obj.Pairs = append(obj.Pairs, &ast.Pair{Key: k, Value: &ast.Nil{}, Span: k.Span})
 			case token.ASSIGN:
 				p.expect(token.ASSIGN)
 				p.advance()
 				v := p.expression(token.LowestPrec)
+				obj.Pairs = append(obj.Pairs, &ast.Pair{Key: k, Value: v, Span: p.span(k.Span.Start)})
 				p.advance()
-				obj.Pairs = append(obj.Pairs, &ast.Pair{Key: k, Value: v})
 				if p.current.Token == token.COMMA {
 					p.advance()
 				}
 			case token.RCURLY:
-				obj.Pairs = append(obj.Pairs, &ast.Pair{Key: k, Value: &ast.Nil{}})
+				obj.Pairs = append(obj.Pairs, &ast.Pair{Key: k, Value: &ast.Nil{}, Span: k.Span})
 				break loop
 			default:
-				if p.ok {
-					p.err = verror.New(p.lexer.ScriptName, "expected identifier or assignment", verror.SyntaxErrType, p.current.Line)
-					p.ok = false
-				}
+				p.error(verror.NewAt(p.lexer.ScriptName, "expected identifier or assignment", verror.SyntaxErrType, p.current.Span))
 				return &ast.Nil{}
 			}
 		}
 		p.expect(token.RCURLY)
+		obj.Span = p.span(start)
 		return obj
 	case token.LPAREN:
 		p.advance()
 		if p.current.Token == token.RPAREN {
-			if p.ok {
-				p.err = verror.New(p.lexer.ScriptName, "expected an expression after left parenthesis", verror.SyntaxErrType, p.current.Line)
-				p.ok = false
-			}
+			p.error(verror.NewAt(p.lexer.ScriptName, "expected an expression after left parenthesis", verror.SyntaxErrType, p.current.Span))
 			return &ast.Nil{}
 		}
 		e := p.expression(token.LowestPrec)
@@ -583,12 +784,12 @@ func (p *parser) operand() ast.Node {
 		p.expect(token.RPAREN)
 		return e
 	case token.FUN:
-		f := &ast.Fun{}
+		f := &ast.Fun{Line: p.current.Line}
+		start := p.current.Span.Start
+		targets := make(map[int]ast.Node)
 		p.advance()
-		if p.current.Token != token.ARROW && p.current.Token != token.LCURLY && p.current.Token != token.EOF {
-			p.expect(token.IDENTIFIER)
-			f.Args = append(f.Args, p.current.Lit)
-			p.advance()
+		if p.current.Token != token.ARROW && (p.current.Token != token.LCURLY || p.objectParam()) && p.current.Token != token.EOF {
+			p.param(f, targets)
 		}
 		for p.current.Token != token.ARROW && p.current.Token != token.LCURLY && p.current.Token != token.EOF {
 			if p.current.Token == token.ELLIPSIS {
@@ -598,26 +799,33 @@ func (p *parser) operand() ast.Node {
 			}
 			p.expect(token.COMMA)
 			p.advance()
-			p.expect(token.IDENTIFIER)
-			f.Args = append(f.Args, p.current.Lit)
-			p.advance()
+			p.param(f, targets)
 		}
 	endParams:
 		if p.current.Token == token.ARROW {
+			line := p.current.Line
 			p.advance()
+			exprStart := p.current.Span.Start
 			e := p.expression(token.LowestPrec)
-			b := &ast.Block{}
-			b.Statement = append(b.Statement, &ast.Ret{Expr: e})
+			b := &ast.Block{Span: p.span(exprStart)}
+			b.Statement = append(b.Statement, &ast.Ret{Expr: e, Line: line, Span: b.Span})
 			f.Body = b
-			return f
+		} else {
+			p.expect(token.LCURLY)
+			block := p.block(false)
+			block.(*ast.Block).Statement = append(block.(*ast.Block).Statement, &ast.Ret{Expr: &ast.Nil{}})
+			f.Body = block
 		}
-		p.expect(token.LCURLY)
-		block := p.block(false)
-		block.(*ast.Block).Statement = append(block.(*ast.Block).Statement, &ast.Ret{Expr: &ast.Nil{}})
-		f.Body = block
+		for k := len(f.Args) - 1; k >= 0; k-- {
+			if target, ok := targets[k]; ok {
+				destructure(f.Body, target, f.Args[k], token.FUN, f.Line)
+			}
+		}
+		f.Span = p.span(start)
 		return f
 	case token.IMPORT:
 		i := &ast.Import{Line: p.current.Line}
+		start := p.current.Span.Start
 		p.advance()
 		p.expect(token.LPAREN)
 		p.advance()
@@ -626,9 +834,11 @@ func (p *parser) operand() ast.Node {
 		i.Path = s + vidaFileExtension
 		p.advance()
 		p.expect(token.RPAREN)
+		i.Span = p.span(start)
 		return i
 	case token.ENUM:
 		e := &ast.Enum{}
+		start := p.current.Span.Start
 		p.advance()
 		p.expect(token.LCURLY)
 		p.advance()
@@ -654,10 +864,7 @@ func (p *parser) operand() ast.Node {
 						e.Init = int64(i)
 					}
 				} else {
-					if p.ok {
-						p.err = verror.New(p.lexer.ScriptName, "integer literal could not be processed", verror.SyntaxErrType, p.current.Line)
-						p.ok = false
-					}
+					p.error(verror.NewAt(p.lexer.ScriptName, "integer literal could not be processed", verror.SyntaxErrType, p.current.Span))
 					return &ast.Nil{}
 				}
 				p.advance()
@@ -667,53 +874,130 @@ func (p *parser) operand() ast.Node {
 				if i, err := strconv.ParseUint(p.current.Lit, 0, 64); err == nil {
 					e.Init = int64(i)
 				} else {
-					if p.ok {
-						p.err = verror.New(p.lexer.ScriptName, "integer literal could not be processed", verror.SyntaxErrType, p.current.Line)
-						p.ok = false
-					}
+					p.error(verror.NewAt(p.lexer.ScriptName, "integer literal could not be processed", verror.SyntaxErrType, p.current.Span))
 					return &ast.Nil{}
 				}
 				p.advance()
 			}
 		}
-		if !p.ok {
-			return &ast.Nil{}
-		}
 		for p.current.Token != token.RCURLY {
 			p.expect(token.IDENTIFIER)
 			e.Variants = append(e.Variants, p.current.Lit)
 			p.advance()
 		}
 		p.expect(token.RCURLY)
+		e.Span = p.span(start)
 		return e
 	default:
-		if p.ok {
-			if p.lexer.LexicalError.Message == "" {
-				p.err = verror.New(p.lexer.ScriptName, "expected a valid expression", verror.SyntaxErrType, p.current.Line)
-			} else {
-				p.err = verror.New(p.lexer.ScriptName, p.lexer.LexicalError.Error(), verror.SyntaxErrType, p.current.Line)
+		p.error(verror.NewAt(p.lexer.ScriptName, "expected a valid expression", verror.SyntaxErrType, p.current.Span))
+		return &ast.Nil{}
+	}
+}
+
+// param adds the parameter at the current token to f. A list or an object
+// to destructure gets a hidden name, and is kept in targets by its position.
+func (p *parser) param(f *ast.Fun, targets map[int]ast.Node) {
+	if p.current.Token == token.LBRACKET || p.current.Token == token.LCURLY {
+		targets[len(f.Args)] = p.pattern(false)
+		f.Args = append(f.Args, fmt.Sprintf("*%v", len(f.Args)))
+		f.ArgSpans = append(f.ArgSpans, token.Span{})
+	} else {
+		p.expect(token.IDENTIFIER)
+		f.Args = append(f.Args, p.current.Lit)
+		f.ArgSpans = append(f.ArgSpans, p.current.Span)
+	}
+	p.advance()
+}
+
+// objectParam reports whether the '{' right after fun starts an object pattern
+// for the first parameter instead of the body. A first field followed by ',',
+// ':' or '}' is only valid in a pattern. A field followed by '=' may also be an
+// assignment in the body, so what comes after the closing brace decides: the
+// rest of a parameter list ending in '=>', or in a '{' on the same line.
+func (p *parser) objectParam() bool {
+	if p.next.Token != token.IDENTIFIER {
+		return false
+	}
+	lx := *p.lexer
+	var line uint
+	var tok token.Token
+	scan := func() {
+		for line, tok, _ = lx.Next(); tok == token.COMMENT; line, tok, _ = lx.Next() {
+		}
+	}
+	skip := func() bool {
+		for depth := 1; depth > 0; {
+			scan()
+			switch tok {
+			case token.LCURLY, token.LBRACKET, token.LPAREN:
+				depth++
+			case token.RCURLY, token.RBRACKET, token.RPAREN:
+				depth--
+			case token.EOF:
+				return false
 			}
-			p.ok = false
 		}
-		return &ast.Nil{}
+		return true
+	}
+	scan()
+	switch tok {
+	case token.COMMA, token.COLON, token.RCURLY:
+		return true
+	case token.ASSIGN:
+		if !skip() {
+			return false
+		}
+	default:
+		return false
+	}
+	for {
+		prev := line
+		scan()
+		switch tok {
+		case token.ARROW:
+			return true
+		case token.LCURLY:
+			return line == prev
+		case token.ELLIPSIS:
+			continue
+		case token.COMMA:
+		default:
+			return false
+		}
+		scan()
+		switch tok {
+		case token.IDENTIFIER:
+		case token.LBRACKET, token.LCURLY:
+			if !skip() {
+				return false
+			}
+		default:
+			return false
+		}
 	}
 }
 
 func (p *parser) ret() ast.Node {
+	line := p.current.Line
+	start := p.current.Span.Start
 	p.advance()
 	e := p.expression(token.LowestPrec)
+	span := p.span(start)
 	p.advance()
-	return &ast.Ret{Expr: e}
+	return &ast.Ret{Expr: e, Line: line, Span: span}
 }
 
 func (p *parser) export() ast.Node {
+	line := p.current.Line
+	start := p.current.Span.Start
 	p.advance()
 	e := p.expression(token.LowestPrec)
+	span := p.span(start)
 	p.advance()
-	return &ast.Export{Expr: e}
+	return &ast.Export{Expr: e, Line: line, Span: span}
 }
 
-func (p *parser) callExpr(e ast.Node) ast.Node {
+func (p *parser) callExpr(e ast.Node, start token.Pos) ast.Node {
 	line := p.current.Line
 	var args []ast.Node
 	var ellipsis int
@@ -744,16 +1028,16 @@ func (p *parser) callExpr(e ast.Node) ast.Node {
 	}
 afterParen:
 	p.expect(token.RPAREN)
-	return &ast.CallExpr{Fun: e, Args: args, Ellipsis: ellipsis, Line: line}
+	return &ast.CallExpr{Fun: e, Args: args, Ellipsis: ellipsis, Line: line, Span: p.span(start)}
 }
 
-func (p *parser) methodCallExpr(e ast.Node) ast.Node {
+func (p *parser) methodCallExpr(e ast.Node, start token.Pos) ast.Node {
 	p.advance()
 	var args []ast.Node
 	var ellipsis int
 	p.expect(token.IDENTIFIER)
 	line := p.current.Line
-	prop := &ast.Property{Value: p.current.Lit}
+	prop := &ast.Property{Value: p.current.Lit, Span: p.current.Span}
 	p.advance()
 	p.expect(token.LPAREN)
 	p.advance()
@@ -783,10 +1067,10 @@ func (p *parser) methodCallExpr(e ast.Node) ast.Node {
 	}
 afterParen:
 	p.expect(token.RPAREN)
-	return &ast.MethodCallExpr{Args: args, Obj: e, Prop: prop, Ellipsis: ellipsis, Line: line}
+	return &ast.MethodCallExpr{Args: args, Obj: e, Prop: prop, Ellipsis: ellipsis, Line: line, Span: p.span(start)}
 }
 
-func (p *parser) indexOrSlice(e ast.Node) ast.Node {
+func (p *parser) indexOrSlice(e ast.Node, start token.Pos) ast.Node {
 	p.advance()
 	var index [2]ast.Node
 	mode := 2
@@ -813,32 +1097,123 @@ func (p *parser) indexOrSlice(e ast.Node) ast.Node {
 			Last:  index[1],
 			Mode:  mode,
 			Line:  p.current.Line,
+			Span:  p.span(start),
 		}
 	}
 	return &ast.IGet{
 		Indexable: e,
 		Index:     index[0],
 		Line:      p.current.Line,
+		Span:      p.span(start),
 	}
 }
 
-func (p *parser) selector(e ast.Node) ast.Node {
-	return &ast.Select{Selectable: e, Selector: &ast.Property{Value: p.current.Lit}, Line: p.current.Line}
+func (p *parser) selector(e ast.Node, start token.Pos) ast.Node {
+	return &ast.Select{Selectable: e, Selector: &ast.Property{Value: p.current.Lit, Span: p.current.Span}, Line: p.current.Line, Span: p.span(start)}
 }
 
 func (p *parser) expect(tok token.Token) {
-	if p.current.Token != tok && p.ok {
-		p.ok = false
+	if p.current.Token != tok {
 		message := fmt.Sprintf("expected token '%v', but got token '%v'", tok, p.current.Token)
-		p.err = verror.New(p.lexer.ScriptName, message, verror.SyntaxErrType, p.current.Line)
+		p.error(verror.NewAt(p.lexer.ScriptName, message, verror.SyntaxErrType, p.current.Span))
 	}
 }
 
+// error records err and gives up on the statement being parsed. An unexpected
+// token has been reported by the lexer already, and only the first error of
+// a line is kept, since the ones after it tend to be caused by it.
+func (p *parser) error(err verror.VidaError) {
+	p.ok = false
+	if p.current.Token != token.UNEXPECTED && (len(p.errs) == 0 || p.errs[len(p.errs)-1].Line != err.Line) {
+		p.errs = append(p.errs, err)
+	}
+	panic(bailout{})
+}
+
+// guard runs parse, which parses a statement. When the statement has an error,
+// guard skips the rest of it so that parsing goes on with the next one.
+func (p *parser) guard(parse func(), isInsideBlock bool) {
+	start, braces := p.current.Span.Start.Offset, p.braces
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+			p.synchronize(braces, isInsideBlock)
+			if p.current.Span.Start.Offset == start && p.current.Token != token.EOF {
+				p.advance()
+			}
+		}
+	}()
+	parse()
+}
+
+// synchronize skips tokens up to one that can start a statement in the block
+// opened by the given number of braces, or up to the brace that closes it.
+// An identifier only starts a statement on a line after the error.
+func (p *parser) synchronize(braces int, isInsideBlock bool) {
+	line := p.current.Line
+	depth := 0
+	for p.current.Token != token.EOF && p.braces >= braces {
+		if p.braces == braces && depth == 0 {
+			switch p.current.Token {
+			case token.RCURLY:
+				if isInsideBlock {
+					return
+				}
+			case token.LET, token.VAR, token.IF, token.FOR, token.WHILE, token.MATCH, token.RET, token.BREAK, token.CONTINUE, token.EXPORT:
+				return
+			case token.IDENTIFIER:
+				if p.current.Line > line {
+					return
+				}
+			}
+		}
+		switch p.current.Token {
+		case token.LBRACKET, token.LPAREN:
+			depth++
+		case token.RBRACKET, token.RPAREN:
+			depth = max(depth-1, 0)
+		}
+		p.advance()
+	}
+}
+
+// result returns the ast when the script has no errors, and every error
+// the lexer and the parser have found otherwise.
+func (p *parser) result() (*ast.Ast, error) {
+	errs := append(verror.ErrorList{}, p.errs...)
+	for _, e := range p.lexer.Errors {
+		if e.Span.Start.Offset <= p.current.Span.Start.Offset {
+			errs = append(errs, e)
+		}
+	}
+	slices.SortStableFunc(errs, func(a, b verror.VidaError) int {
+		return cmp.Compare(a.Span.Start.Offset, b.Span.Start.Offset)
+	})
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return p.ast, nil
+}
+
 func (p *parser) advance() token.Token {
-	p.current.Line, p.current.Token, p.current.Lit = p.next.Line, p.next.Token, p.next.Lit
+	switch p.current.Token {
+	case token.LCURLY:
+		p.braces++
+	case token.RCURLY:
+		p.braces = max(p.braces-1, 0)
+	}
+	p.current = p.next
 	p.next.Line, p.next.Token, p.next.Lit = p.lexer.Next()
 	for p.next.Token == token.COMMENT {
 		p.next.Line, p.next.Token, p.next.Lit = p.lexer.Next()
 	}
+	p.next.Span = p.lexer.Span()
 	return p.current.Token
 }
+
+// span returns the part of the script from start up to the end of the current token.
+func (p *parser) span(start token.Pos) token.Span {
+	return token.Span{Start: start, End: p.current.Span.End}
+}
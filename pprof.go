@@ -0,0 +1,156 @@
+package vida
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+)
+
+// Field numbers of the messages of the pprof profile.proto format.
+const (
+	pprofSampleType    = 1
+	pprofSample        = 2
+	pprofLocation      = 4
+	pprofFunction      = 5
+	pprofStringTable   = 6
+	pprofDurationNanos = 10
+	pprofPeriodType    = 11
+	pprofPeriod        = 12
+
+	pprofValueTypeType = 1
+	pprofValueTypeUnit = 2
+
+	pprofSampleLocation = 1
+	pprofSampleValue    = 2
+
+	pprofLocationID   = 1
+	pprofLocationLine = 4
+
+	pprofLineFunction = 1
+	pprofLineLine     = 2
+
+	pprofFunctionID        = 1
+	pprofFunctionName      = 2
+	pprofFunctionSystem    = 3
+	pprofFunctionFilename  = 4
+	pprofFunctionStartLine = 5
+)
+
+// protoBuffer encodes the few protocol buffer wire types pprof needs.
+type protoBuffer struct {
+	data []byte
+}
+
+func (b *protoBuffer) varint(field int, v uint64) {
+	b.data = binary.AppendUvarint(b.data, uint64(field)<<3)
+	b.data = binary.AppendUvarint(b.data, v)
+}
+
+func (b *protoBuffer) bytes(field int, v []byte) {
+	b.data = binary.AppendUvarint(b.data, uint64(field)<<3|2)
+	b.data = binary.AppendUvarint(b.data, uint64(len(v)))
+	b.data = append(b.data, v...)
+}
+
+func (b *protoBuffer) packed(field int, vs []uint64) {
+	var p []byte
+	for _, v := range vs {
+		p = binary.AppendUvarint(p, v)
+	}
+	b.bytes(field, p)
+}
+
+func (b *protoBuffer) message(field int, m *protoBuffer) {
+	b.bytes(field, m.data)
+}
+
+// pprofBuilder interns the strings, functions and locations of a pprof profile.
+type pprofBuilder struct {
+	out       protoBuffer
+	strings   map[string]uint64
+	functions map[*CoreFunction]uint64
+	locations map[lineKey]uint64
+}
+
+func (pb *pprofBuilder) str(s string) uint64 {
+	if id, ok := pb.strings[s]; ok {
+		return id
+	}
+	id := uint64(len(pb.strings))
+	pb.strings[s] = id
+	pb.out.bytes(pprofStringTable, []byte(s))
+	return id
+}
+
+func (pb *pprofBuilder) function(prof *Profile, fn *CoreFunction) uint64 {
+	if id, ok := pb.functions[fn]; ok {
+		return id
+	}
+	id := uint64(len(pb.functions) + 1)
+	pb.functions[fn] = id
+	var m protoBuffer
+	name := pb.str(prof.names[fn])
+	m.varint(pprofFunctionID, id)
+	m.varint(pprofFunctionName, name)
+	m.varint(pprofFunctionSystem, name)
+	m.varint(pprofFunctionFilename, pb.str(fn.ScriptName))
+	m.varint(pprofFunctionStartLine, uint64(prof.lineTable(fn).first))
+	pb.out.message(pprofFunction, &m)
+	return id
+}
+
+func (pb *pprofBuilder) location(prof *Profile, f stackFrame) uint64 {
+	k := lineKey{f.fn, prof.lineTable(f.fn).line(f.ip)}
+	if id, ok := pb.locations[k]; ok {
+		return id
+	}
+	id := uint64(len(pb.locations) + 1)
+	pb.locations[k] = id
+	var line protoBuffer
+	line.varint(pprofLineFunction, pb.function(prof, f.fn))
+	line.varint(pprofLineLine, uint64(k.line))
+	var m protoBuffer
+	m.varint(pprofLocationID, id)
+	m.message(pprofLocationLine, &line)
+	pb.out.message(pprofLocation, &m)
+	return id
+}
+
+func (pb *pprofBuilder) valueType(field int, typ, unit string) {
+	var m protoBuffer
+	m.varint(pprofValueTypeType, pb.str(typ))
+	m.varint(pprofValueTypeUnit, pb.str(unit))
+	pb.out.message(field, &m)
+}
+
+// WritePprof writes the sampled call stacks as a gzipped pprof profile,
+// so it can be explored with go tool pprof. Every sample stands for
+// the statements run since the previous one.
+func (prof *Profile) WritePprof(w io.Writer) error {
+	pb := &pprofBuilder{
+		strings:   make(map[string]uint64),
+		functions: make(map[*CoreFunction]uint64),
+		locations: make(map[lineKey]uint64),
+	}
+	pb.str("")
+	pb.valueType(pprofSampleType, "samples", "count")
+	pb.valueType(pprofSampleType, "statements", "count")
+	pb.valueType(pprofPeriodType, "statements", "count")
+	pb.out.varint(pprofPeriod, stackInterval)
+	pb.out.varint(pprofDurationNanos, uint64(prof.Duration.Nanoseconds()))
+	for _, s := range prof.stacks {
+		locs := make([]uint64, 0, len(s.frames))
+		for _, f := range s.frames {
+			locs = append(locs, pb.location(prof, f))
+		}
+		var m protoBuffer
+		m.packed(pprofSampleLocation, locs)
+		m.packed(pprofSampleValue, []uint64{s.count, s.count * stackInterval})
+		pb.out.message(pprofSample, &m)
+	}
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(pb.out.data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
@@ -0,0 +1,330 @@
+package vida
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// errNotProfilable is returned by Profile for a script compiled without trace instructions.
+var errNotProfilable = errors.New("the script was not compiled for profiling, create the interpreter with NewProfiler")
+
+// stackInterval is the number of statements between two samples of the call stack.
+// It is prime so that samples do not keep landing on the same statement of a loop.
+const stackInterval = 31
+
+// profiler counts every statement the VM executes, by function and by the ip
+// of its trace, and samples the call stack every stackInterval statements.
+// It runs as the hook of the main thread and its coroutines.
+type profiler struct {
+	counts  map[*CoreFunction][]uint64
+	ids     map[*CoreFunction]int
+	stacks  map[string]*stackSample
+	fn      *CoreFunction
+	current []uint64
+	ticks   uint64
+	key     []byte
+}
+
+type stackFrame struct {
+	fn *CoreFunction
+	ip int
+}
+
+type stackSample struct {
+	frames []stackFrame
+	count  uint64
+}
+
+func newProfiler() *profiler {
+	return &profiler{
+		counts: make(map[*CoreFunction][]uint64),
+		ids:    make(map[*CoreFunction]int),
+		stacks: make(map[string]*stackSample),
+	}
+}
+
+func (p *profiler) count(vm *VM, ip int) error {
+	if fn := vm.Frame.lambda.CoreFn; fn != p.fn {
+		p.fn = fn
+		p.current = p.counts[fn]
+		if len(p.current) < len(fn.Code) {
+			p.current = append(p.current, make([]uint64, len(fn.Code)-len(p.current))...)
+			p.counts[fn] = p.current
+		}
+	}
+	p.current[ip]++
+	p.ticks++
+	if p.ticks%stackInterval == 0 {
+		p.sample(vm, ip)
+	}
+	return nil
+}
+
+// sample records the call stack of vm, innermost frame first.
+func (p *profiler) sample(vm *VM, ip int) {
+	p.key = p.key[:0]
+	for k := vm.fp; k >= 0; k-- {
+		fip := ip
+		if k != vm.fp {
+			fip = vm.Frames[k].ip - 1
+		}
+		p.key = binary.AppendUvarint(p.key, uint64(p.id(vm.Frames[k].lambda.CoreFn)))
+		p.key = binary.AppendUvarint(p.key, uint64(fip))
+	}
+	if s, ok := p.stacks[string(p.key)]; ok {
+		s.count++
+		return
+	}
+	s := &stackSample{frames: make([]stackFrame, 0, vm.fp+1), count: 1}
+	for k := vm.fp; k >= 0; k-- {
+		fip := ip
+		if k != vm.fp {
+			fip = vm.Frames[k].ip - 1
+		}
+		s.frames = append(s.frames, stackFrame{fn: vm.Frames[k].lambda.CoreFn, ip: fip})
+	}
+	p.stacks[string(p.key)] = s
+}
+
+func (p *profiler) id(fn *CoreFunction) int {
+	id, ok := p.ids[fn]
+	if !ok {
+		id = len(p.ids) + 1
+		p.ids[fn] = id
+	}
+	return id
+}
+
+// A ProfileEntry holds the statements counted for a function or a line.
+// Lines are counted across every function they belong to and have no Name.
+// Self counts the statements run in the entry itself, exactly. Total also
+// counts the statements run in the functions it called, and it is estimated
+// from the sampled call stacks.
+type ProfileEntry struct {
+	Name   string
+	Script string
+	Line   uint
+	Self   uint64
+	Total  uint64
+}
+
+// A Profile is the result of running a script under the profiler.
+type Profile struct {
+	Script     string
+	Statements uint64
+	Duration   time.Duration
+	Functions  []ProfileEntry
+	Lines      []ProfileEntry
+	names      map[*CoreFunction]string
+	lines      map[*CoreFunction]*lineTable
+	stacks     []*stackSample
+	counts     map[*CoreFunction][]uint64
+	fns        []*CoreFunction
+}
+
+// lineTable maps the ips of a function to the lines of their statements.
+type lineTable struct {
+	starts []int
+	lines  []uint
+	first  uint
+}
+
+func newLineTable(fn *CoreFunction) *lineTable {
+	t := &lineTable{}
+	if fn.debug == nil {
+		return t
+	}
+	for ip := range fn.debug.lines {
+		t.starts = append(t.starts, ip)
+	}
+	slices.Sort(t.starts)
+	for _, ip := range t.starts {
+		line := fn.debug.lines[ip]
+		t.lines = append(t.lines, line)
+		if t.first == 0 || line < t.first {
+			t.first = line
+		}
+	}
+	return t
+}
+
+func (t *lineTable) line(ip int) uint {
+	i, found := slices.BinarySearch(t.starts, ip)
+	if !found {
+		i--
+	}
+	if i < 0 {
+		return 0
+	}
+	return t.lines[i]
+}
+
+type lineKey struct {
+	fn   *CoreFunction
+	line uint
+}
+
+type sourceLine struct {
+	script string
+	line   uint
+}
+
+func newProfile(p *profiler, vm *VM, globals map[string]int, duration time.Duration) *Profile {
+	prof := &Profile{
+		Script:     vm.Script.MainFunction.CoreFn.ScriptName,
+		Statements: p.ticks,
+		Duration:   duration,
+		names:      make(map[*CoreFunction]string),
+		lines:      make(map[*CoreFunction]*lineTable),
+		counts:     p.counts,
+		fns:        []*CoreFunction{vm.Script.MainFunction.CoreFn},
+	}
+	for _, v := range *vm.Script.Konstants {
+		if fn, ok := v.(*CoreFunction); ok {
+			prof.fns = append(prof.fns, fn)
+		}
+	}
+	prof.nameFunctions(vm, globals)
+	fnSelf := make(map[*CoreFunction]uint64)
+	lineSelf := make(map[sourceLine]uint64)
+	for fn, counts := range p.counts {
+		t := prof.lineTable(fn)
+		for ip, n := range counts {
+			if n != 0 {
+				fnSelf[fn] += n
+				lineSelf[sourceLine{fn.ScriptName, t.line(ip)}] += n
+			}
+		}
+	}
+	fnTotal := make(map[*CoreFunction]uint64)
+	lineTotal := make(map[sourceLine]uint64)
+	for _, s := range p.stacks {
+		prof.stacks = append(prof.stacks, s)
+		seenFn := make(map[*CoreFunction]bool)
+		seenLine := make(map[sourceLine]bool)
+		for _, f := range s.frames {
+			k := sourceLine{f.fn.ScriptName, prof.lineTable(f.fn).line(f.ip)}
+			if !seenFn[f.fn] {
+				seenFn[f.fn] = true
+				fnTotal[f.fn] += s.count * stackInterval
+			}
+			if !seenLine[k] {
+				seenLine[k] = true
+				lineTotal[k] += s.count * stackInterval
+			}
+		}
+	}
+	for fn, self := range fnSelf {
+		prof.Functions = append(prof.Functions, ProfileEntry{
+			Name:   prof.names[fn],
+			Script: fn.ScriptName,
+			Line:   prof.lineTable(fn).first,
+			Self:   self,
+			Total:  max(self, fnTotal[fn]),
+		})
+	}
+	for k, self := range lineSelf {
+		prof.Lines = append(prof.Lines, ProfileEntry{
+			Script: k.script,
+			Line:   k.line,
+			Self:   self,
+			Total:  max(self, lineTotal[k]),
+		})
+	}
+	sortEntries(prof.Functions)
+	sortEntries(prof.Lines)
+	return prof
+}
+
+// nameFunctions names every function after the global that holds it,
+// the main function "main" and any other function "fun".
+func (prof *Profile) nameFunctions(vm *VM, globals map[string]int) {
+	for name, idx := range globals {
+		if f, ok := (*vm.Script.Store)[idx].(*Function); ok {
+			if old, ok := prof.names[f.CoreFn]; !ok || name < old {
+				prof.names[f.CoreFn] = name
+			}
+		}
+	}
+	prof.names[vm.Script.MainFunction.CoreFn] = "main"
+	for _, fn := range prof.fns {
+		if _, ok := prof.names[fn]; !ok {
+			prof.names[fn] = "fun"
+		}
+	}
+}
+
+func (prof *Profile) lineTable(fn *CoreFunction) *lineTable {
+	t, ok := prof.lines[fn]
+	if !ok {
+		t = newLineTable(fn)
+		prof.lines[fn] = t
+	}
+	return t
+}
+
+func sortEntries(entries []ProfileEntry) {
+	slices.SortFunc(entries, func(a, b ProfileEntry) int {
+		return cmp.Or(
+			cmp.Compare(b.Self, a.Self),
+			cmp.Compare(b.Total, a.Total),
+			cmp.Compare(a.Script, b.Script),
+			cmp.Compare(a.Line, b.Line),
+			cmp.Compare(a.Name, b.Name))
+	})
+}
+
+// WriteReport writes the functions and the lines that ran the most
+// statements, at most n of each, or all of them when n is not positive.
+func (prof *Profile) WriteReport(w io.Writer, n int) {
+	fmt.Fprintf(w, "Profile of %v\n", prof.Script)
+	fmt.Fprintf(w, "%v statements in %v\n", prof.Statements, prof.Duration)
+	fmt.Fprintf(w, "Total counts are estimated from call stacks sampled every %v statements.\n\n", stackInterval)
+	fmt.Fprintln(w, "Functions")
+	fmt.Fprintf(w, "%14v %7v %14v %7v  %v\n", "self", "self%", "total", "total%", "function")
+	for _, e := range limitEntries(prof.Functions, n) {
+		fmt.Fprintf(w, "%14v %7v %14v %7v  %v %v:%v\n", e.Self, prof.percent(e.Self), e.Total, prof.percent(e.Total), e.Name, e.Script, e.Line)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Lines")
+	fmt.Fprintf(w, "%14v %7v %14v %7v  %v\n", "self", "self%", "total", "total%", "line")
+	sources := make(map[string][]string)
+	for _, e := range limitEntries(prof.Lines, n) {
+		fmt.Fprintf(w, "%14v %7v %14v %7v  %v:%v  %v\n", e.Self, prof.percent(e.Self), e.Total, prof.percent(e.Total), e.Script, e.Line, readSourceLine(sources, e.Script, e.Line))
+	}
+}
+
+func (prof *Profile) percent(n uint64) string {
+	if prof.Statements == 0 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(n)*100/float64(prof.Statements))
+}
+
+func limitEntries(entries []ProfileEntry, n int) []ProfileEntry {
+	if n > 0 && n < len(entries) {
+		return entries[:n]
+	}
+	return entries
+}
+
+func readSourceLine(sources map[string][]string, script string, line uint) string {
+	lines, ok := sources[script]
+	if !ok {
+		if data, err := os.ReadFile(script); err == nil {
+			lines = strings.Split(string(data), "\n")
+		}
+		sources[script] = lines
+	}
+	if line == 0 || int(line) > len(lines) {
+		return ""
+	}
+	return strings.TrimSpace(lines[line-1])
+}
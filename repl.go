@@ -0,0 +1,165 @@
+package vida
+
+import (
+	"maps"
+
+	"github.com/alkemist-17/vida/ast"
+	"github.com/alkemist-17/vida/lexer"
+	"github.com/alkemist-17/vida/token"
+	"github.com/alkemist-17/vida/verror"
+)
+
+const replScriptName = "repl"
+
+// A Repl compiles and runs source code one entry at a time. Every entry is
+// compiled with the same symbols, konstants and store as the entries before it,
+// so globals and top level locals stay visible from one entry to the next.
+type Repl struct {
+	vm *VM
+	c  *compiler
+}
+
+// replState is the part of the compiler that an entry with
+// a compilation error must not leave behind.
+type replState struct {
+	code    int
+	rAlloc  int
+	history int
+	globals map[string]int
+	index   int
+	store   int
+}
+
+func NewRepl(extensionlibloader map[string]func() Value) (*Repl, error) {
+	c := newMainCompiler(&ast.Ast{}, replScriptName)
+	c.script.Konstants = c.kb.Konstants
+	c.appendHeader()
+	c.appendEnd()
+	mainThread, err := newMainThread(c.script, extensionlibloader)
+	if err != nil {
+		return nil, err
+	}
+	return &Repl{vm: &VM{mainThread}, c: c}, nil
+}
+
+// Eval compiles and runs a single entry. When the entry is an expression,
+// its value is returned and isExpr is true.
+func (r *Repl) Eval(src string) (val Value, isExpr bool, err error) {
+	rAst, isExpr, err := parseEntry([]byte(src))
+	if err != nil {
+		return NilValue, false, err
+	}
+	c := r.c
+	c.currentFn.Code = c.currentFn.Code[:len(c.currentFn.Code)-1]
+	state := r.save()
+	for _, s := range rAst.Statement {
+		c.compileStmt(s)
+		if c.hadError {
+			err = verror.NewAt(replScriptName, c.errMsg, verror.CompilationErrType, c.spanErr)
+			r.restore(state)
+			c.appendEnd()
+			return NilValue, false, err
+		}
+	}
+	c.appendEnd()
+	val, err = r.vm.runFrom(state.code)
+	if err != nil {
+		return NilValue, false, err
+	}
+	return val, isExpr, nil
+}
+
+// Incomplete reports whether src opens more braces, brackets or parentheses
+// than it closes, so a reader should ask for more lines before calling Eval.
+func (r *Repl) Incomplete(src string) bool {
+	l := lexer.New([]byte(src), replScriptName)
+	depth := 0
+	for {
+		_, tok, _ := l.Next()
+		switch tok {
+		case token.LCURLY, token.LBRACKET, token.LPAREN:
+			depth++
+		case token.RCURLY, token.RBRACKET, token.RPAREN:
+			depth--
+		case token.EOF, token.UNEXPECTED:
+			return depth > 0
+		}
+	}
+}
+
+// Global returns the current value of a global defined by an earlier entry.
+func (r *Repl) Global(name string) (Value, bool) {
+	idx, ok := r.c.sb.GlobalSet[name]
+	if !ok {
+		return NilValue, false
+	}
+	return (*r.vm.Script.Store)[idx], true
+}
+
+func (r *Repl) save() replState {
+	c := r.c
+	return replState{
+		code:    len(c.currentFn.Code),
+		rAlloc:  c.rAlloc,
+		history: len(c.sb.History),
+		globals: maps.Clone(c.sb.GlobalSet),
+		index:   c.sb.index,
+		store:   len(*c.script.Store),
+	}
+}
+
+func (r *Repl) restore(s replState) {
+	c := r.c
+	c.fn = c.fn[:1]
+	c.currentFn = c.fn[0]
+	c.currentFn.Code = c.currentFn.Code[:s.code]
+	c.jumps = c.jumps[:0]
+	c.breakJumps = c.breakJumps[:0]
+	c.breakCount = c.breakCount[:0]
+	c.continueJumps = c.continueJumps[:0]
+	c.continueCount = c.continueCount[:0]
+	c.rAlloc = s.rAlloc
+	c.sb.History = c.sb.History[:s.history]
+	c.sb.GlobalSet = s.globals
+	c.sb.index = s.index
+	*c.script.Store = (*c.script.Store)[:s.store]
+	c.scope = 0
+	c.level = 0
+	c.mutLoc = false
+	c.fromRefStmt = false
+	c.hadError = false
+	c.errMsg = ""
+}
+
+// parseEntry parses src as a single expression when it is one,
+// and as a list of statements otherwise.
+func parseEntry(src []byte) (*ast.Ast, bool, error) {
+	p := newParser(src, replScriptName)
+	var e ast.Node
+	p.guard(func() {
+		e = p.expression(token.LowestPrec)
+		p.advance()
+	}, false)
+	if p.ok && p.current.Token == token.EOF {
+		return &ast.Ast{Statement: []ast.Node{&ast.Export{Expr: e}}}, true, nil
+	}
+	switch p = newParser(src, replScriptName); p.current.Token {
+	case token.IDENTIFIER, token.LET, token.VAR, token.IF, token.FOR, token.WHILE, token.MATCH, token.LCURLY, token.EXPORT, token.EOF:
+		rAst, err := p.parse()
+		return rAst, false, err
+	default:
+		if p.current.Token == token.UNEXPECTED {
+			return nil, false, p.lexer.LexicalError
+		}
+		p = newParser(src, replScriptName)
+		p.guard(func() {
+			p.expression(token.LowestPrec)
+			p.advance()
+		}, false)
+		if p.ok {
+			return nil, false, verror.NewAt(replScriptName, "expected a statement or an expression", verror.SyntaxErrType, p.current.Span)
+		}
+		_, err := p.result()
+		return nil, false, err
+	}
+}
@@ -0,0 +1,65 @@
+package vida
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/alkemist-17/vida/verror"
+)
+
+// eval runs the entries of a session in order and
+// returns the value of the last one.
+func eval(t *testing.T, r *Repl, entries ...string) Value {
+	t.Helper()
+	var val Value
+	for _, entry := range entries {
+		v, _, err := r.Eval(entry)
+		if err != nil {
+			t.Fatalf("%q: %v", entry, err)
+		}
+		val = v
+	}
+	return val
+}
+
+func TestReplKeepsGlobals(t *testing.T) {
+	r, err := NewRepl(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eval(t, r, "let x = 2", "var y = x * 3", "y = y + 1")
+	val, isExpr, err := r.Eval("x + y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isExpr || val != Integer(9) {
+		t.Errorf("x + y = %v, %v, want 9, true", val, isExpr)
+	}
+	if x, ok := r.Global("x"); !ok || x != Integer(2) {
+		t.Errorf("Global(x) = %v, %v, want 2, true", x, ok)
+	}
+}
+
+func TestReplRestoresAfterCompileError(t *testing.T) {
+	r, err := NewRepl(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eval(t, r, "let a = 1")
+	for _, entry := range []string{"let b = missing + 1", "let g = fun {\n    var c = 2\n    ret missing\n}"} {
+		_, _, err := r.Eval(entry)
+		var e verror.VidaError
+		if !errors.As(err, &e) || e.ErrType != verror.CompilationErrType {
+			t.Fatalf("%q = %v, want a compilation error", entry, err)
+		}
+	}
+	for _, name := range []string{"b", "g"} {
+		if _, ok := r.Global(name); ok {
+			t.Errorf("%v is defined after an entry that failed to compile", name)
+		}
+	}
+	val := eval(t, r, "let b = 5", "let g = fun {\n    var c = 2\n    ret a + b + c\n}", "g()")
+	if val != Integer(8) {
+		t.Errorf("g() = %v, want 8", val)
+	}
+}
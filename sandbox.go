@@ -0,0 +1,77 @@
+package vida
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/alkemist-17/vida/verror"
+)
+
+// A Sandbox restricts what a script can reach from its interpreter.
+// Entries in Allow and Deny name libraries as they are given to load,
+// like "std/os", or single members of them, like "std/os.run".
+// When Allow is not empty, only the libraries and members listed there
+// can be loaded. Deny always takes precedence over Allow.
+// When Root is not empty, every imported script must live inside it.
+type Sandbox struct {
+	Allow []string
+	Deny  []string
+	Root  string
+}
+
+func (s *Sandbox) checkImport(path string) error {
+	if s == nil || s.Root == "" {
+		return nil
+	}
+	root, err := resolvePath(s.Root)
+	if err != nil {
+		return verror.New(path, err.Error(), verror.FileErrType, 0)
+	}
+	target, err := resolvePath(path)
+	if err != nil {
+		return verror.New(path, err.Error(), verror.FileErrType, 0)
+	}
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return verror.New(path, "import outside of the sandbox root", verror.FileErrType, 0)
+	}
+	return nil
+}
+
+func (s *Sandbox) load(name string, loader func() Value) (Value, error) {
+	if s == nil {
+		return loader(), nil
+	}
+	if slices.Contains(s.Deny, name) {
+		return NilValue, fmt.Errorf("library '%v' is not allowed", name)
+	}
+	prefix := name + "."
+	whole := len(s.Allow) == 0 || slices.Contains(s.Allow, name)
+	if !whole && !slices.ContainsFunc(s.Allow, func(e string) bool { return strings.HasPrefix(e, prefix) }) {
+		return NilValue, fmt.Errorf("library '%v' is not allowed", name)
+	}
+	lib := loader()
+	if o, ok := lib.(*Object); ok {
+		for k := range o.Value {
+			member := prefix + k
+			if slices.Contains(s.Deny, member) || !whole && !slices.Contains(s.Allow, member) {
+				delete(o.Value, k)
+			}
+		}
+		o.UpdateKeys()
+	}
+	return lib, nil
+}
+
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if p, err := filepath.EvalSymlinks(abs); err == nil {
+		return p, nil
+	}
+	return abs, nil
+}
@@ -0,0 +1,129 @@
+package vida
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// sandboxDir makes a sandbox root with some scripts in it, and one more
+// script next to it, and runs the test from inside the root.
+func sandboxDir(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	files := map[string]string{
+		filepath.Join(dir, "outside.vida"): "export 1\n",
+		filepath.Join(root, "lib.vida"):    "export 2\n",
+		filepath.Join(root, "escape.vida"): "export import(\"../outside\")\n",
+		filepath.Join(root, "loads.vida"):  "let os = load(\"std/os\")\nexport os\n",
+	}
+	if err := os.Mkdir(root, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for path, src := range files {
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(dir, "outside.vida"), filepath.Join(root, "link.vida")); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(root)
+}
+
+func runSandboxed(t *testing.T, sandbox *Sandbox, src string) (*Interpreter, error) {
+	t.Helper()
+	if err := os.WriteFile("main.vida", []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	i, err := NewSandboxedInterpreter("main.vida", nil, sandbox)
+	if err != nil {
+		return nil, err
+	}
+	_, err = i.Run()
+	return i, err
+}
+
+func members(t *testing.T, i *Interpreter, name string) []string {
+	t.Helper()
+	v, _ := i.Global(name)
+	o, ok := v.(*Object)
+	if !ok {
+		t.Fatalf("%v is %v, want an object", name, v)
+	}
+	keys := make([]string, 0, len(o.Value))
+	for k := range o.Value {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func TestSandboxRoot(t *testing.T) {
+	sandboxDir(t)
+	sandbox := &Sandbox{Root: "."}
+	if _, err := runSandboxed(t, sandbox, "let x = import(\"lib\")\n"); err != nil {
+		t.Errorf("import inside the root failed: %v", err)
+	}
+	for _, path := range []string{"../outside", "escape", "link"} {
+		_, err := runSandboxed(t, sandbox, "let x = import(\""+path+"\")\n")
+		if err == nil || !strings.Contains(err.Error(), "import outside of the sandbox root") {
+			t.Errorf("import of %v: got %v, want it rejected", path, err)
+		} else if n := strings.Count(err.Error(), "Error]"); n != 1 {
+			t.Errorf("import of %v: reported as %v errors, want one:%v", path, n, err)
+		}
+	}
+	if _, err := runSandboxed(t, nil, "let x = import(\"escape\")\n"); err != nil {
+		t.Errorf("import without a sandbox failed: %v", err)
+	}
+}
+
+func TestSandboxDeny(t *testing.T) {
+	sandboxDir(t)
+	sandbox := &Sandbox{Deny: []string{"std/os"}}
+	for _, src := range []string{"let os = load(\"std/os\")\n", "let os = import(\"loads\")\n"} {
+		_, err := runSandboxed(t, sandbox, src)
+		if err == nil || !strings.Contains(err.Error(), "library 'std/os' is not allowed") {
+			t.Errorf("%q: got %v, want std/os denied", src, err)
+		}
+	}
+	sandbox = &Sandbox{Deny: []string{"std/os.run", "std/os.exit"}}
+	for _, src := range []string{"let os = load(\"std/os\")\n", "let os = import(\"loads\")\n"} {
+		i, err := runSandboxed(t, sandbox, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := members(t, i, "os")
+		if slices.Contains(keys, "run") || slices.Contains(keys, "exit") || !slices.Contains(keys, "args") {
+			t.Errorf("%q: std/os has %v, want every member but run and exit", src, keys)
+		}
+	}
+}
+
+func TestSandboxAllow(t *testing.T) {
+	sandboxDir(t)
+	sandbox := &Sandbox{Allow: []string{"std/math", "std/os.args"}}
+	for _, src := range []string{"let os = load(\"std/os\")\n", "let os = import(\"loads\")\n"} {
+		i, err := runSandboxed(t, sandbox, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keys := members(t, i, "os"); !slices.Equal(keys, []string{"args"}) {
+			t.Errorf("%q: std/os has %v, want only args", src, keys)
+		}
+	}
+	if _, err := runSandboxed(t, sandbox, "let math = load(\"std/math\")\n"); err != nil {
+		t.Errorf("loading an allowed library failed: %v", err)
+	}
+	_, err := runSandboxed(t, sandbox, "let text = load(\"std/text\")\n")
+	if err == nil || !strings.Contains(err.Error(), "library 'std/text' is not allowed") {
+		t.Errorf("got %v, want std/text rejected", err)
+	}
+	sandbox = &Sandbox{Allow: []string{"std/os"}, Deny: []string{"std/os"}}
+	if _, err := runSandboxed(t, sandbox, "let os = load(\"std/os\")\n"); err == nil {
+		t.Error("a library both allowed and denied was loaded")
+	}
+}
@@ -1,10 +1,13 @@
 package vida
 
+import "github.com/alkemist-17/vida/token"
+
 type lKey struct {
 	id    string
 	level int
 	scope int
 	reg   int
+	def   int
 }
 
 type symbolBuilder struct {
@@ -76,3 +79,40 @@ func (sb *symbolBuilder) clearLocals(compilerLevel int, scopeLevel int) int {
 	}
 	return count
 }
+
+// Kinds of the declarations recorded in a symbolTable.
+const (
+	symbolGlobal = iota
+	symbolLocal
+	symbolParam
+	symbolLoop
+	symbolPattern
+)
+
+type symbolDef struct {
+	name   string
+	span   token.Span
+	kind   int
+	module string
+}
+
+type symbolRef struct {
+	name string
+	span token.Span
+	def  int
+}
+
+// symbolTable records, while the compiler resolves names with the symbol builder,
+// the span of the identifier of every declaration and reference of a script, and
+// which declaration every reference resolves to. A reference to a name of the
+// corelib has a def of -1, and the hidden names the parser makes have no span.
+// Module holds the name given to load when a declaration binds a library.
+type symbolTable struct {
+	defs    []symbolDef
+	refs    []symbolRef
+	globals map[string]int
+}
+
+func newSymbolTable() *symbolTable {
+	return &symbolTable{globals: make(map[string]int)}
+}
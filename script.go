@@ -13,7 +13,6 @@ type Script struct {
 	Store        *[]Value
 	Konstants    *[]Value
 	MainFunction *Function
-	ErrorInfo
 }
 
 func newMainScript(name string) *Script {
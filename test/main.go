@@ -1,11 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/alkemist-17/vida"
 	"github.com/alkemist-17/vida/extension"
+	"github.com/alkemist-17/vida/verror"
 )
 
 func main() {
@@ -23,6 +28,13 @@ func main() {
 			fmt.Printf("\n\n\n")
 		}
 	}
+	for _, m := range malformed {
+		count++
+		fmt.Printf("Rejecting script '%v'\n", m.name)
+		b, code := build(m.name, m.src)
+		rejectScript(m.name, m.corrupt(b, code))
+		fmt.Printf("\n\n\n")
+	}
 	fmt.Printf("All %v tests were ok!\n\n\n", count)
 }
 
@@ -34,11 +46,143 @@ func executeScript(path string) {
 	fmt.Println(r)
 }
 
+// malformed holds scripts that are compiled with vida.Build and then corrupted
+// by patching one of their instructions. Each one has to be rejected.
+var malformed = []struct {
+	name    string
+	src     string
+	corrupt func(b []byte, code vida.Disassembly) []byte
+}{
+	{
+		name: "truncated",
+		src:  "let x = [1, 2, 3]\n",
+		corrupt: func(b []byte, code vida.Disassembly) []byte {
+			return b[:len(b)/2]
+		},
+	},
+	{
+		name: "register-out-of-range",
+		src:  "let f = fun {\n    var x = \"x\"\n}\nf()\n",
+		corrupt: func(b []byte, code vida.Disassembly) []byte {
+			fn := code.Functions[0]
+			return setWord(b, fn, 0, withB(fn.Code[0].Word, 2000))
+		},
+	},
+	{
+		name: "frame-overflow",
+		src:  "let f = fun a, b {\n    var x = \"x\"\n}\nf(1, 2)\n",
+		corrupt: func(b []byte, code vida.Disassembly) []byte {
+			fn := code.Functions[0]
+			return setWord(b, fn, 0, withB(fn.Code[0].Word, 1023))
+		},
+	},
+	{
+		name: "coroutine-overflow",
+		src:  "let co = load(\"std/co\")\nlet f = fun {\n    var x = \"x\"\n}\nco.resume(co.new(f, co.stack.of8))\n",
+		corrupt: func(b []byte, code vida.Disassembly) []byte {
+			fn := code.Functions[0]
+			return setWord(b, fn, 0, withB(fn.Code[0].Word, 100))
+		},
+	},
+	{
+		name: "clobbered-counter",
+		src:  "for i in 0, 3 {\n    var x = \"x\"\n}\n",
+		corrupt: func(b []byte, code vida.Disassembly) []byte {
+			loop := find(code.Main, "For")
+			body := code.Main.Code[loop+1]
+			return setWord(b, code.Main, body.IP, withB(body.Word, code.Main.Code[loop].Word&0xFFFF))
+		},
+	},
+	{
+		name: "clobbered-iterator",
+		src:  "for _, v in [1, 2] {\n    var x = \"x\"\n}\n",
+		corrupt: func(b []byte, code vida.Disassembly) []byte {
+			loop := find(code.Main, "IFor")
+			body := code.Main.Code[loop+1]
+			return setWord(b, code.Main, body.IP, withB(body.Word, code.Main.Code[loop].Word&0xFFFF))
+		},
+	},
+	{
+		name: "jump-into-loop",
+		src:  "var a = true\nif a {\n    a = false\n}\nfor i in 0, 3 {\n    var x = \"x\"\n}\n",
+		corrupt: func(b []byte, code vida.Disassembly) []byte {
+			check := code.Main.Code[find(code.Main, "Check")]
+			body := code.Main.Code[find(code.Main, "For")+1]
+			return setWord(b, code.Main, check.IP, withB(check.Word, uint64(body.IP)))
+		},
+	},
+}
+
+// build compiles src as the script name and returns its bytecode
+// along with its disassembly, which tells where every instruction is.
+func build(name, src string) ([]byte, vida.Disassembly) {
+	path := filepath.Join(os.TempDir(), name+".vida")
+	handleError(os.WriteFile(path, []byte(src), 0o644), path)
+	defer os.Remove(path)
+	b, err := vida.Build(path)
+	handleError(err, path)
+	code, err := vida.MachineCode(path)
+	handleError(err, path)
+	return b, code
+}
+
+// find returns the position in fn.Code of the first instruction op.
+func find(fn vida.DisassembledFunction, op string) int {
+	for k, v := range fn.Code {
+		if v.Op == op {
+			return k
+		}
+	}
+	handleError(fmt.Errorf("no %v instruction", op), fn.ScriptName)
+	return 0
+}
+
+// withB replaces the last operand of an instruction word, the register
+// a load writes to or the target of a jump.
+func withB(word, b uint64) uint64 {
+	return word&^0xFFFF | b
+}
+
+// setWord returns a copy of the bytecode b where the instruction at ip of fn
+// is word. The code of fn is found by its encoding, 8 bytes little endian
+// per instruction.
+func setWord(b []byte, fn vida.DisassembledFunction, ip int, word uint64) []byte {
+	var code []byte
+	for _, v := range fn.Code {
+		code = binary.LittleEndian.AppendUint64(code, v.Word)
+	}
+	at := bytes.Index(b, code)
+	if at < 0 {
+		handleError(errors.New("function code not found"), fn.ScriptName)
+	}
+	b = bytes.Clone(b)
+	binary.LittleEndian.PutUint64(b[at+(ip-fn.Code[0].IP)*8:], word)
+	return b
+}
+
+// rejectScript runs a corrupted script, which has to be rejected with a
+// verification error before any of its malformed code runs. Any other error,
+// like a stack overflow at run time, means the corruption got through.
+func rejectScript(name string, b []byte) {
+	i, err := vida.NewInterpreterFromSource(name, b, extension.LoadExtensions())
+	if err == nil {
+		_, err = i.Run()
+	}
+	if err == nil {
+		handleError(errors.New("the script ran without errors"), name)
+	}
+	var e verror.VidaError
+	if !errors.As(err, &e) || e.ErrType != verror.VerificationErrType {
+		handleError(fmt.Errorf("the script was not rejected by verification: %w", err), name)
+	}
+	fmt.Println(err)
+}
+
 func handleError(err error, path string) {
 	if err != nil {
 		fmt.Println(err)
 		fmt.Println(path)
-		os.Exit(0)
+		os.Exit(1)
 	}
 }
 
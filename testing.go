@@ -0,0 +1,105 @@
+package vida
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/alkemist-17/vida/verror"
+)
+
+// TestSuffix ends the name of every script the test runner discovers.
+const TestSuffix = "_test.vida"
+
+// testCase is a function registered with test.case.
+type testCase struct {
+	name string
+	fn   Value
+}
+
+// A TestResult holds the outcome of a single case registered with test.case.
+// Err is nil when the case passed.
+type TestResult struct {
+	Name     string
+	Err      error
+	Duration time.Duration
+}
+
+func loadFoundationTest(store *[]Value) Value {
+	m := &Object{Value: make(map[string]Value)}
+	m.Value["case"] = gfnTestCase(store)
+	m.Value["equal"] = GFn(gfnTestEqual)
+	m.Value["raises"] = NFn(fnTestRaises)
+	m.UpdateKeys()
+	return m
+}
+
+func gfnTestCase(store *[]Value) GFn {
+	return func(args ...Value) (Value, error) {
+		if len(args) > 1 {
+			if name, ok := args[0].(*String); ok && bool(args[1].IsCallable()) {
+				main := (*store)[mainThIndex].(*Thread)
+				main.tests = append(main.tests, testCase{name: name.Value, fn: args[1]})
+				return NilValue, nil
+			}
+		}
+		return NilValue, errors.New("test.case expects a name and a function")
+	}
+}
+
+func gfnTestEqual(args ...Value) (Value, error) {
+	if len(args) < 2 {
+		return NilValue, errors.New("test.equal expects the actual and the expected value")
+	}
+	if equal, _ := DeepEqual(args[0], args[1]); equal == Bool(true) {
+		return NilValue, nil
+	}
+	message := fmt.Sprintf("expected %v, got %v", args[1], args[0])
+	if len(args) > 2 {
+		message = fmt.Sprintf("%v: %v", args[2], message)
+	}
+	return NilValue, verror.New("", message, verror.AssertionErrType, 0)
+}
+
+// fnTestRaises calls its first argument with the rest of them,
+// and fails unless the call stops with an error or returns an error value.
+func fnTestRaises(vm *VM, args ...Value) (Value, error) {
+	if len(args) == 0 || !bool(args[0].IsCallable()) {
+		return NilValue, errors.New("test.raises expects a function")
+	}
+	val, err := vm.Call(args[0], args[1:]...)
+	if err != nil {
+		return NilValue, nil
+	}
+	if _, ok := val.(Error); ok {
+		return NilValue, nil
+	}
+	return NilValue, fmt.Errorf("expected an error, got %v", val)
+}
+
+// RunTests runs the script at path and then every case it registered with
+// test.case, in order. A failing case does not stop the ones after it.
+// Imports are resolved from the directory of the script, so they find the
+// same files wherever the tests are run from.
+// The error is not nil only when the script itself fails to compile or run.
+func RunTests(path string, extensionlibloader map[string]func() Value) ([]TestResult, error) {
+	src, err := readScript(path)
+	if err != nil {
+		return nil, err
+	}
+	i, err := newInterpreter(path, filepath.Dir(path), src, extensionlibloader, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := i.Run(); err != nil {
+		return nil, err
+	}
+	results := make([]TestResult, 0, len(i.vm.tests))
+	for _, c := range i.vm.tests {
+		init := time.Now()
+		_, err := i.Call(c.fn)
+		results = append(results, TestResult{Name: c.name, Err: err, Duration: time.Since(init)})
+	}
+	return results, nil
+}
@@ -0,0 +1,97 @@
+package vida
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alkemist-17/vida/verror"
+)
+
+func TestRunTestsImportsFromScriptDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sub")
+	files := map[string]string{
+		"helper.vida": "export {\n    double = fun x => x * 2,\n    fails = fun x => [x][5],\n}\n",
+		"t_test.vida": `let test = load("std/test")
+let helper = import("helper")
+
+test.case("double", fun {
+    test.equal(helper.double(2), 4)
+})
+
+test.case("fails", fun {
+    helper.fails(1)
+})
+`,
+	}
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	results, err := RunTests(filepath.Join(dir, "t_test.vida"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %v results, want 2", len(results))
+	}
+	if results[0].Err != nil {
+		t.Errorf("double failed: %v", results[0].Err)
+	}
+	var vErr verror.VidaError
+	if !errors.As(results[1].Err, &vErr) || vErr.ScriptName != filepath.Join(dir, "helper.vida") || vErr.Line != 3 {
+		t.Errorf("fails: got %v, want an error at line 3 of %v", results[1].Err, filepath.Join(dir, "helper.vida"))
+	}
+}
+
+func TestEqualCyclic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cyclic_test.vida")
+	src := `let test = load("std/test")
+
+test.case("same", fun {
+    let xs = [1]
+    xs[0] = xs
+    test.equal(xs, xs)
+})
+
+test.case("pair", fun {
+    let xs = [1]
+    xs[0] = xs
+    let ys = [1]
+    ys[0] = ys
+    let o = {}
+    o.self = o
+    let p = {}
+    p.self = p
+    test.equal(xs, ys)
+    test.equal(o, p)
+})
+`
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	results, err := RunTests(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %v results, want 2", len(results))
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("%v failed: %v", r.Name, r.Err)
+		}
+	}
+	xs := &List{Value: []Value{nil, Integer(2)}}
+	xs.Value[0] = xs
+	ys := &List{Value: []Value{nil, Integer(3)}}
+	ys.Value[0] = ys
+	if deepEqual(xs, ys) {
+		t.Error("cyclic lists with different items compared equal")
+	}
+}
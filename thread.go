@@ -2,6 +2,7 @@ package vida
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/alkemist-17/vida/token"
 	"github.com/alkemist-17/vida/verror"
@@ -36,35 +37,170 @@ func (state ThreadState) String() string {
 
 type Thread struct {
 	ReferenceSemanticsImpl
-	Frames []frame
-	Stack  []Value
-	Script *Script
-	Frame  *frame
-	State  ThreadState
-	fp     int
+	Frames     []frame
+	Stack      []Value
+	Script     *Script
+	Frame      *frame
+	State      ThreadState
+	fp         int
+	active     *Thread
+	libsLoader LibsLoader
+	limits     *limits
+	hook       func(vm *VM, ip int) error
+	sandbox    *Sandbox
+	tests      []testCase
+	args       []string
+	resumes    int
+	output     io.Writer
 }
 
+// maxResumes bounds how deeply co.resume calls may nest. Every nested
+// resume runs a new execute loop on the Go stack, and every thread starts
+// again at frame zero, so neither the frame stack nor the call depth limit
+// would stop a coroutine that resumes another one without end.
+const maxResumes = 200
+
 func newMainThread(script *Script, extensionlibsloader LibsLoader) (*Thread, error) {
-	extensionlibsLoader, clbu = extensionlibsloader, script.Store
 	th := &Thread{
-		Frames: make([]frame, frameSize),
-		Stack:  make([]Value, fullStack),
-		Script: script,
+		Frames:     make([]frame, frameSize),
+		Stack:      newStack(fullStack),
+		Script:     script,
+		libsLoader: extensionlibsloader,
 	}
 	(*(script.Store))[mainThIndex] = th
 	return th, nil
 }
 
-func newThread(fn *Function, script *Script, size int) *Thread {
+func newThread(fn *Function, main *Thread, size int) *Thread {
 	return &Thread{
 		Script: &Script{
-			Konstants:    script.Konstants,
-			Store:        script.Store,
-			ErrorInfo:    script.ErrorInfo,
+			Konstants:    main.Script.Konstants,
+			Store:        main.Script.Store,
 			MainFunction: fn,
 		},
 		Frames: make([]frame, size),
-		Stack:  make([]Value, size),
+		Stack:  newStack(size),
+		limits: main.limits,
+		hook:   main.hook,
+	}
+}
+
+// newStack returns a stack whose registers all hold nil,
+// so reading a register before writing it yields a Vida nil.
+func newStack(size int) []Value {
+	stack := make([]Value, size)
+	for i := range stack {
+		stack[i] = NilValue
+	}
+	return stack
+}
+
+func (th *Thread) resume(args []Value) (val Value, err error) {
+	switch th.State {
+	case Running, Waiting:
+		return Error{Message: &String{Value: "cannot resume a non-suspended thread"}}, nil
+	case Closed:
+		return Error{Message: &String{Value: "cannot resume a closed thread"}}, nil
+	}
+	main := (*th.Script.Store)[mainThIndex].(*Thread)
+	main.resumes++
+	defer func() { main.resumes-- }()
+	if err := main.checkResumes(th); err != nil {
+		return NilValue, err
+	}
+	caller := main
+	if main.active != nil {
+		caller = main.active
+	}
+	vm := &VM{th}
+	var ip int
+	if th.State == Ready {
+		if err := th.prepare(args); err != nil {
+			th.State = Closed
+			return NilValue, err
+		}
+	} else {
+		th.Frame.stack[th.Frame.ret] = packValues(args)
+		ip = th.Frame.ip
+	}
+	defer func() {
+		caller.State = Running
+		main.active = caller
+	}()
+	caller.State = Waiting
+	main.active = th
+	th.State = Running
+	val, err = vm.execute(ip)
+	if err != nil {
+		th.State = Closed
+	}
+	return val, err
+}
+
+// checkResumes reports an error once the resumes nested on the main
+// thread pass the call depth limit or maxResumes.
+func (main *Thread) checkResumes(th *Thread) error {
+	if main.limits != nil {
+		if err := main.limits.checkDepth(main.resumes); err != nil {
+			return verror.LimitError{ScriptName: th.Script.MainFunction.CoreFn.ScriptName, Err: err}
+		}
+	}
+	if main.resumes > maxResumes {
+		if main.limits != nil && main.limits.maxDepth != 0 {
+			return verror.LimitError{ScriptName: th.Script.MainFunction.CoreFn.ScriptName, Err: verror.ErrCallDepthLimit}
+		}
+		return verror.ErrStackOverflow
+	}
+	return nil
+}
+
+func (th *Thread) prepare(args []Value) error {
+	fn := th.Script.MainFunction
+	if fn.CoreFn.registers > len(th.Stack) {
+		return verror.ErrStackOverflow
+	}
+	if err := loadArgs(th.Stack, fn, args); err != nil {
+		return err
+	}
+	th.fp = 0
+	th.Frame = &th.Frames[0]
+	th.Frame.code = fn.CoreFn.Code
+	th.Frame.lambda = fn
+	th.Frame.stack = th.Stack[:]
+	return nil
+}
+
+func loadArgs(stack []Value, fn *Function, args []Value) error {
+	nargs := len(args)
+	if fn.CoreFn.IsVar {
+		if fn.CoreFn.Arity > nargs {
+			return verror.ErrNotEnoughArgs
+		}
+	} else if nargs != fn.CoreFn.Arity {
+		return verror.ErrArity
+	}
+	if nargs >= len(stack) {
+		return verror.ErrStackOverflow
+	}
+	copy(stack, args)
+	if fn.CoreFn.IsVar {
+		xs := make([]Value, nargs-fn.CoreFn.Arity)
+		copy(xs, args[fn.CoreFn.Arity:])
+		stack[fn.CoreFn.Arity] = &List{Value: xs}
+	}
+	return nil
+}
+
+func packValues(args []Value) Value {
+	switch len(args) {
+	case 0:
+		return NilValue
+	case 1:
+		return args[0]
+	default:
+		xs := make([]Value, len(args))
+		copy(xs, args)
+		return &List{Value: xs}
 	}
 }
 
@@ -0,0 +1,37 @@
+package vida
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/alkemist-17/vida/verror"
+)
+
+// nested resumes a new coroutine from inside every coroutine it starts.
+const nested = `let co = load("std/co")
+let r = fun n {
+    var t = co.new(fun => r(n + 1))
+    ret co.resume(t)
+}
+r(0)
+`
+
+func TestNestedResumeOverflow(t *testing.T) {
+	i, err := NewInterpreterFromSource("nested.vida", []byte(nested), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = i.Run()
+	var vErr verror.VidaError
+	if !errors.As(err, &vErr) || vErr.Message != verror.ErrStackOverflow.Error() {
+		t.Fatalf("expected a stack overflow, got %v", err)
+	}
+
+	i, err = NewInterpreterFromSource("nested.vida", []byte(nested), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.SetMaxCallDepth(50)
+	_, err = i.Run()
+	limitError(t, err, verror.ErrCallDepthLimit)
+}
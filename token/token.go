@@ -32,6 +32,7 @@ const (
 	DOUBLE_DOT
 	ELLIPSIS
 	TILDE
+	COLON
 	operator_end
 
 	binary_op_init
@@ -75,7 +76,21 @@ const (
 	EXPORT
 	ENUM
 	REC
+	MATCH
 	keyword_end
+
+	assign_op_init
+	ADD_ASSIGN
+	SUB_ASSIGN
+	MUL_ASSIGN
+	DIV_ASSIGN
+	REM_ASSIGN
+	BOR_ASSIGN
+	BAND_ASSIGN
+	BXOR_ASSIGN
+	BSHL_ASSIGN
+	BSHR_ASSIGN
+	assign_op_end
 )
 
 var Tokens = [...]string{
@@ -101,6 +116,7 @@ var Tokens = [...]string{
 	DOUBLE_DOT:  "..",
 	ELLIPSIS:    "...",
 	TILDE:       "~",
+	COLON:       ":",
 	ADD:         "+",
 	SUB:         "-",
 	MUL:         "*",
@@ -138,12 +154,47 @@ var Tokens = [...]string{
 	EXPORT:      "export",
 	ENUM:        "enum",
 	REC:         "rec",
+	MATCH:       "match",
+	ADD_ASSIGN:  "+=",
+	SUB_ASSIGN:  "-=",
+	MUL_ASSIGN:  "*=",
+	DIV_ASSIGN:  "/=",
+	REM_ASSIGN:  "%=",
+	BOR_ASSIGN:  "|=",
+	BAND_ASSIGN: "&=",
+	BXOR_ASSIGN: "^=",
+	BSHL_ASSIGN: "<<=",
+	BSHR_ASSIGN: ">>=",
 }
 
 type TokenInfo struct {
-	Lit   string
-	Line  uint
-	Token Token
+	Lit   string `json:"lit,omitempty"`
+	Line  uint   `json:"line"`
+	Token Token  `json:"token"`
+	Span  Span   `json:"span"`
+}
+
+// Pos is a place in a script: the offset of a byte from the start of the script,
+// and the line and column where it falls, both counted from 1.
+// Columns count bytes. The zero Pos is no place at all.
+type Pos struct {
+	Offset int  `json:"offset"`
+	Line   uint `json:"line"`
+	Column uint `json:"column"`
+}
+
+func (p Pos) IsValid() bool {
+	return p.Line > 0
+}
+
+// Span is the part of a script from Start up to End, which is not part of it.
+type Span struct {
+	Start Pos `json:"start"`
+	End   Pos `json:"end"`
+}
+
+func (s Span) IsValid() bool {
+	return s.Start.IsValid()
 }
 
 var keywords map[string]Token
@@ -159,6 +210,11 @@ func (token Token) String() string {
 	return Tokens[token]
 }
 
+// MarshalText encodes a token by its representation, as in String.
+func (token Token) MarshalText() ([]byte, error) {
+	return []byte(token.String()), nil
+}
+
 func (token Token) IsLiteral() bool {
 	return literal_init < token && token < literal_end
 }
@@ -171,6 +227,39 @@ func (token Token) IsBinaryOperator() bool {
 	return (binary_op_init < token && token < binary_op_end) || token == AND || token == OR || token == IN
 }
 
+// IsAssignOperator reports whether token is a compound assignment like +=.
+func (token Token) IsAssignOperator() bool {
+	return assign_op_init < token && token < assign_op_end
+}
+
+// BinaryOperator returns the operator a compound assignment applies,
+// so ADD for +=. Any other token is returned unchanged.
+func (token Token) BinaryOperator() Token {
+	switch token {
+	case ADD_ASSIGN:
+		return ADD
+	case SUB_ASSIGN:
+		return SUB
+	case MUL_ASSIGN:
+		return MUL
+	case DIV_ASSIGN:
+		return DIV
+	case REM_ASSIGN:
+		return REM
+	case BOR_ASSIGN:
+		return BOR
+	case BAND_ASSIGN:
+		return BAND
+	case BXOR_ASSIGN:
+		return BXOR
+	case BSHL_ASSIGN:
+		return BSHL
+	case BSHR_ASSIGN:
+		return BSHR
+	}
+	return token
+}
+
 func IsKeyword(name string) bool {
 	_, ok := keywords[name]
 	return ok
@@ -834,6 +834,19 @@ type CoreFunction struct {
 	Arity      int
 	IsVar      bool
 	ScriptName string
+	debug      *debugInfo
+	registers  int
+	// spans holds, for the ip following each instruction that can fail,
+	// the source of that instruction.
+	spans []token.Span
+}
+
+// span returns the source of the instruction just before ip.
+func (c *CoreFunction) span(ip int) token.Span {
+	if ip >= 0 && ip < len(c.spans) {
+		return c.spans[ip]
+	}
+	return token.Span{}
 }
 
 func (c *CoreFunction) Boolean() Bool {
@@ -1024,6 +1037,75 @@ func (gfn GFn) Type() string {
 	return "gfn"
 }
 
+// NFn is a native function that receives the VM running it,
+// so it can call back into any callable value through vm.Call.
+type NFn func(vm *VM, args ...Value) (Value, error)
+
+func (nfn NFn) Boolean() Bool {
+	return Bool(true)
+}
+
+func (nfn NFn) Prefix(op uint64) (Value, error) {
+	switch op {
+	case uint64(token.NOT):
+		return Bool(false), nil
+	default:
+		return NilValue, verror.ErrPrefixOpNotDefined
+	}
+}
+
+func (nfn NFn) Binop(op uint64, r Value) (Value, error) {
+	switch op {
+	case uint64(token.OR):
+		return nfn, nil
+	case uint64(token.AND):
+		return r, nil
+	case uint64(token.IN):
+		return IsMemberOf(nfn, r)
+	}
+	return NilValue, verror.ErrBinaryOpNotDefined
+}
+
+func (nfn NFn) IGet(index Value) (Value, error) {
+	return NilValue, verror.ErrValueNotIndexable
+}
+
+func (nfn NFn) ISet(index, val Value) error {
+	return verror.ErrValueNotIndexable
+}
+
+func (nfn NFn) Equals(other Value) Bool {
+	return false
+}
+
+func (nfn NFn) IsIterable() Bool {
+	return false
+}
+
+func (nfn NFn) IsCallable() Bool {
+	return true
+}
+
+func (nfn NFn) Call(args ...Value) (Value, error) {
+	return NilValue, verror.ErrNativeWithoutVM
+}
+
+func (nfn NFn) Iterator() Value {
+	return NilValue
+}
+
+func (nfn NFn) String() string {
+	return "NFn"
+}
+
+func (nfn NFn) Clone() Value {
+	return nfn
+}
+
+func (nfn NFn) Type() string {
+	return "nfn"
+}
+
 type Error struct {
 	ValueSemanticsImpl
 	Message Value
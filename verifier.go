@@ -0,0 +1,434 @@
+package vida
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/alkemist-17/vida/verror"
+)
+
+// verifier checks that every operand of every instruction of a script
+// refers to something that exists, and that loops are only entered through
+// their for, so a malformed program is rejected before it runs instead of
+// panicking inside the VM. It also counts the registers of every function,
+// which calls check against the stack left to them.
+type verifier struct {
+	script *Script
+	fn     *CoreFunction
+	name   string
+	ip     int
+	err    string
+}
+
+func verifyScript(script *Script) error {
+	v := &verifier{script: script}
+	main := script.MainFunction.CoreFn
+	if len(main.Code) < 2 || main.Code[0]>>shift32 != header>>shift32 {
+		return verror.New(main.ScriptName, "missing script header", verror.VerificationErrType, 0)
+	}
+	v.fn = main
+	v.name = "main function"
+	if !v.signature(main) {
+		return v.error()
+	}
+	for idx, k := range *script.Konstants {
+		if fn, ok := k.(*CoreFunction); ok {
+			v.fn = fn
+			v.name = fmt.Sprintf("function %v", idx)
+			if !v.signature(fn) {
+				return v.error()
+			}
+		}
+	}
+	v.name = "main function"
+	if !v.function(main, true) {
+		return v.error()
+	}
+	for idx, k := range *script.Konstants {
+		if fn, ok := k.(*CoreFunction); ok {
+			v.name = fmt.Sprintf("function %v", idx)
+			if !v.function(fn, false) {
+				return v.error()
+			}
+		}
+	}
+	return nil
+}
+
+func (v *verifier) error() error {
+	span := v.fn.span(v.ip + 1)
+	message := fmt.Sprintf("%v, instruction %v: %v", v.name, v.ip, v.err)
+	return verror.NewAt(v.fn.ScriptName, message, verror.VerificationErrType, span)
+}
+
+func (v *verifier) fail(format string, args ...any) bool {
+	v.err = fmt.Sprintf(format, args...)
+	return false
+}
+
+func (v *verifier) signature(fn *CoreFunction) bool {
+	if fn.Arity < 0 || fn.Arity >= fullStack || fn.Free < 0 || fn.Free > len(fn.Info) {
+		return v.fail("invalid function signature")
+	}
+	if len(fn.Code) == 0 {
+		return v.fail("empty function")
+	}
+	return true
+}
+
+func (v *verifier) function(fn *CoreFunction, isMain bool) bool {
+	v.fn = fn
+	v.ip = 0
+	start := 0
+	if isMain {
+		start = 1
+	}
+	switch fn.Code[len(fn.Code)-1] >> shift56 {
+	case ret, jump, end:
+	default:
+		v.ip = len(fn.Code) - 1
+		return v.fail("execution can run past the end of the function")
+	}
+	// A called function has its frame start right above the register holding
+	// it, so it is left one register less than main.
+	limit := fullStack
+	if !isMain {
+		limit--
+	}
+	for v.ip = start; v.ip < len(fn.Code); v.ip++ {
+		if !v.instruction(fn.Code[v.ip], isMain) {
+			return false
+		}
+		if n := countRegisters(fn.Code[v.ip:v.ip+1], *v.script.Konstants); n > limit {
+			return v.fail("register %v out of range", n-1)
+		}
+	}
+	if !v.loops(fn, start) {
+		return false
+	}
+	fn.registers = countRegisters(fn.Code, *v.script.Konstants)
+	return true
+}
+
+// loops checks that the body of a loop, from the instruction after its for up to
+// its loop instruction, is only entered through the for and never writes the
+// registers only the loop keeps: the counter, end and step of a for over a
+// range, or the iterator of a for over an iterable. So those registers always
+// hold what the for put there.
+func (v *verifier) loops(fn *CoreFunction, start int) bool {
+	for s := start; s < len(fn.Code); s++ {
+		var e, last int
+		B := int(fn.Code[s] & clean16)
+		switch fn.Code[s] >> shift56 {
+		case forSet:
+			e = int(fn.Code[s] >> shift16 & clean16)
+			last = B + 2
+		case iForSet:
+			e = int(fn.Code[s] >> shift32 & clean24)
+			last = B
+		default:
+			continue
+		}
+		for v.ip = s + 1; v.ip < e; v.ip++ {
+			if lo, hi, ok := writes(fn.Code[v.ip]); ok && lo <= last && B <= hi {
+				return v.fail("write to a register of the loop at instruction %v", s)
+			}
+		}
+		for v.ip = start; v.ip < len(fn.Code); v.ip++ {
+			if s <= v.ip && v.ip <= e {
+				continue
+			}
+			if t, ok := jumpTarget(fn.Code[v.ip]); ok && s < t && t <= e {
+				return v.fail("jump into the loop at instruction %v", s)
+			}
+		}
+	}
+	return true
+}
+
+// jumpTarget returns where the instruction i may jump to, if it jumps at all.
+func jumpTarget(i uint64) (int, bool) {
+	switch i >> shift56 {
+	case jump, check:
+		return int(i & clean16), true
+	case forSet, forLoop, iForLoop:
+		return int(i >> shift16 & clean16), true
+	case iForSet:
+		return int(i >> shift32 & clean24), true
+	}
+	return 0, false
+}
+
+// writes returns the registers from lo to hi the instruction i writes, if it
+// writes any. A call writes its result and may write every register from it
+// on: its arguments when they are spread and the frame of the function called.
+func writes(i uint64) (lo, hi int, ok bool) {
+	B := int(i & clean16)
+	switch i >> shift56 {
+	case load, prefix, binop, binopK, binopQ, binopG, eq, iGet, slice, list, object, fun, iForSet:
+		return B, B, true
+	case call:
+		return B, math.MaxInt, true
+	case forLoop:
+		return B, B + 3, true
+	case iForLoop:
+		return B + 1, B + 2, true
+	}
+	return 0, 0, false
+}
+
+func (v *verifier) instruction(i uint64, isMain bool) bool {
+	op := i >> shift56
+	A := int(i >> shift16 & clean16)
+	B := int(i & clean16)
+	P := int(i >> shift32 & clean24)
+	switch op {
+	case load:
+		return v.operand(P, A)
+	case store:
+		if P>>shift16 == storeFromGlobal {
+			if B == mainThIndex {
+				return v.fail("store into the main thread slot")
+			}
+			return v.global(B) && v.operand(P&clean16, A)
+		}
+		if P&clean16 == storeFromFree {
+			return v.free(B)
+		}
+		return v.free(B) && v.operand(P&clean16, A)
+	case check:
+		if P&clean8 > checkObject {
+			return v.fail("unknown check kind %v", P&clean8)
+		}
+		return v.target(B)
+	case jump:
+		return v.target(B)
+	case binopG:
+		return v.global(A) && v.global(P&clean16)
+	case binopK, binopQ:
+		return v.konst(A)
+	case eq:
+		s := P >> shift16
+		l := s >> shift2 & clean2bits
+		r := s & clean2bits
+		if l == storeFromKonst && r == storeFromKonst {
+			r = storeFromFree
+		}
+		return v.operand(l, P&clean16) && v.operand(r, A)
+	case binop, prefix, slice, list, object:
+		return true
+	case iGet:
+		scopeIndexable := P >> shift16 & clean8
+		if scopeIndexable == storeFromKonst {
+			scopeIndexable = storeFromFree
+		}
+		return v.operand(P>>shift20, A) && v.operand(scopeIndexable, P&clean16)
+	case iSet:
+		return v.operand(P>>shift20, A) && v.operand(P>>shift16&clean8, B)
+	case forSet:
+		if !v.target(A) {
+			return false
+		}
+		if v.fn.Code[A]>>shift56 != forLoop || int(v.fn.Code[A]>>shift16&clean16) != v.ip+1 {
+			return v.fail("for without a matching loop")
+		}
+		return true
+	case forLoop:
+		if !v.target(A) {
+			return false
+		}
+		if A == 0 || v.fn.Code[A-1]>>shift56 != forSet || int(v.fn.Code[A-1]&clean16) != B || int(v.fn.Code[A-1]>>shift16&clean16) != v.ip {
+			return v.fail("loop without a matching for")
+		}
+		return true
+	case iForSet:
+		if !v.target(P) {
+			return false
+		}
+		if v.fn.Code[P]>>shift56 != iForLoop || int(v.fn.Code[P]>>shift16&clean16) != v.ip+1 {
+			return v.fail("for without a matching loop")
+		}
+		return true
+	case iForLoop:
+		if !v.target(A) {
+			return false
+		}
+		if A == 0 || v.fn.Code[A-1]>>shift56 != iForSet || int(v.fn.Code[A-1]&clean16) != B || int(v.fn.Code[A-1]>>shift32&clean24) != v.ip {
+			return v.fail("loop without a matching for")
+		}
+		return true
+	case fun:
+		if !v.konst(A) {
+			return false
+		}
+		fn, ok := (*v.script.Konstants)[A].(*CoreFunction)
+		if !ok {
+			return v.fail("konstant %v is not a function", A)
+		}
+		for _, info := range fn.Info[:fn.Free] {
+			if !bool(info.IsLocal) && !v.free(info.Index) {
+				return false
+			}
+		}
+		return true
+	case call:
+		switch P & clean16 {
+		case 0, ellipsisFirst, ellipsisLast:
+		default:
+			return v.fail("unknown call mode %v", P&clean16)
+		}
+		return true
+	case ret:
+		return v.operand(B, A)
+	case trace:
+		return true
+	case end:
+		if !isMain {
+			return v.fail("end instruction outside of the main function")
+		}
+		return true
+	default:
+		return v.fail("unknown opcode %v", op)
+	}
+}
+
+func (v *verifier) operand(scope, index int) bool {
+	switch scope {
+	case storeFromLocal:
+		return true
+	case storeFromKonst:
+		return v.konst(index)
+	case storeFromGlobal:
+		return v.global(index)
+	case storeFromFree:
+		return v.free(index)
+	default:
+		return v.fail("unknown operand scope %v", scope)
+	}
+}
+
+func (v *verifier) konst(k int) bool {
+	if k < 0 || k >= len(*v.script.Konstants) {
+		return v.fail("konstant %v out of range", k)
+	}
+	return true
+}
+
+func (v *verifier) global(g int) bool {
+	if g < 0 || g >= len(*v.script.Store) {
+		return v.fail("global %v out of range", g)
+	}
+	return true
+}
+
+func (v *verifier) free(f int) bool {
+	if f < 0 || f >= v.fn.Free {
+		return v.fail("free variable %v out of range", f)
+	}
+	return true
+}
+
+func (v *verifier) target(ip int) bool {
+	if ip < 0 || ip >= len(v.fn.Code) || v.fn == v.script.MainFunction.CoreFn && ip == 0 {
+		return v.fail("jump target %v out of range", ip)
+	}
+	return true
+}
+
+// countRegisters returns how many registers of its frame a function with the
+// given code needs: one more than the highest register any of its instructions
+// reads or writes, including the ones its closures capture.
+func countRegisters(code []uint64, konstants []Value) int {
+	top := 0
+	use := func(r int) {
+		top = max(top, r+1)
+	}
+	for _, i := range code {
+		op := i >> shift56
+		A := int(i >> shift16 & clean16)
+		B := int(i & clean16)
+		P := int(i >> shift32 & clean24)
+		switch op {
+		case load:
+			if P == loadFromLocal {
+				use(A)
+			}
+			use(B)
+		case store:
+			if P&clean16 == storeFromLocal || P>>shift16 != storeFromGlobal && P&clean16 == storeFromFree {
+				use(A)
+			}
+		case check:
+			use(A)
+		case prefix:
+			use(A)
+			use(B)
+		case binopG, object:
+			use(B)
+		case binop:
+			use(A)
+			use(P & clean16)
+			use(B)
+		case binopK, binopQ:
+			use(P & clean16)
+			use(B)
+		case eq:
+			s := P >> shift16
+			if s>>shift2&clean2bits == storeFromLocal {
+				use(P & clean16)
+			}
+			if s&clean2bits == storeFromLocal {
+				use(A)
+			}
+			use(B)
+		case iGet:
+			if P>>shift20 == storeFromLocal {
+				use(A)
+			}
+			if P>>shift16&clean8 == storeFromLocal {
+				use(P & clean16)
+			}
+			use(B)
+		case iSet:
+			if P>>shift20 == storeFromLocal {
+				use(A)
+			}
+			if P>>shift16&clean8 == storeFromLocal {
+				use(B)
+			}
+			use(P & clean16)
+		case slice:
+			use(A + 2)
+			use(B)
+		case list:
+			use(A + P)
+			use(B)
+		case forSet, forLoop:
+			use(B + 3)
+		case iForSet:
+			use(A)
+			use(B + 2)
+		case iForLoop:
+			use(B + 2)
+		case fun:
+			use(B)
+			if A < len(konstants) {
+				if fn, ok := konstants[A].(*CoreFunction); ok {
+					for k, info := range fn.Info {
+						if k < fn.Free && info.IsLocal {
+							use(info.Index)
+						}
+					}
+				}
+			}
+		case call:
+			use(B + A)
+			use(B + P>>shift16)
+		case ret:
+			if B == storeFromLocal {
+				use(A)
+			}
+		}
+	}
+	return top
+}
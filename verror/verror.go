@@ -1,38 +1,96 @@
 package verror
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alkemist-17/vida/token"
 )
 
 const (
-	FileErrType        = "File"
-	LexicalErrType     = "Lexical"
-	SyntaxErrType      = "Syntax"
-	CompilationErrType = "Compilation"
-	RunTimeErrType     = "Runtime"
-	AssertionErrType   = "Assertion Failure"
-	ExceptionErrType   = "Exception"
-	MaxMemSize         = 0x7FFF_FFFF
+	FileErrType         = "File"
+	LexicalErrType      = "Lexical"
+	SyntaxErrType       = "Syntax"
+	CompilationErrType  = "Compilation"
+	RunTimeErrType      = "Runtime"
+	AssertionErrType    = "Assertion Failure"
+	ExceptionErrType    = "Exception"
+	LimitErrType        = "Limit"
+	VerificationErrType = "Verification"
+	MaxMemSize          = 0x7FFF_FFFF
 )
 
+// VidaError is an error found in a script. Span, when valid, is the part
+// of the script at fault, and Excerpt the source line where it starts,
+// which Error shows with carets under the span.
 type VidaError struct {
 	ScriptName string
 	Message    string
 	ErrType    string
 	Line       uint
+	Span       token.Span
+	Excerpt    string
 }
 
 func (e VidaError) Error() string {
 	switch e.ErrType {
 	case ExceptionErrType, AssertionErrType:
-		return fmt.Sprintf("\n\n  [%v]\n   Script    : %v\n   Near line : %v\n   Message   : %v\n\n", e.ErrType, e.ScriptName, e.Line, e.Message)
+		return fmt.Sprintf("\n\n  [%v]\n   Script    : %v\n   Near line : %v\n%v   Message   : %v\n\n%v", e.ErrType, e.ScriptName, e.Line, e.column(), e.Message, e.excerpt())
 	default:
 		if e.Line == 0 {
 			return fmt.Sprintf("\n\n  [%v Error]\n   Script  : %v\n   Message : %v\n\n", e.ErrType, e.ScriptName, e.Message)
 		}
-		return fmt.Sprintf("\n\n  [%v Error]\n   Script    : %v\n   Near line : %v\n   Message   : %v\n\n", e.ErrType, e.ScriptName, e.Line, e.Message)
+		return fmt.Sprintf("\n\n  [%v Error]\n   Script    : %v\n   Near line : %v\n%v   Message   : %v\n\n%v", e.ErrType, e.ScriptName, e.Line, e.column(), e.Message, e.excerpt())
+	}
+}
+
+func (e VidaError) column() string {
+	if !e.Span.IsValid() || e.Span.Start.Line != e.Line {
+		return ""
+	}
+	return fmt.Sprintf("   Column    : %v\n", e.Span.Start.Column)
+}
+
+// excerpt returns the source line of the error with carets under its span,
+// up to the end of the span or of the line.
+func (e VidaError) excerpt() string {
+	if e.Excerpt == "" || e.column() == "" {
+		return ""
+	}
+	start := min(int(e.Span.Start.Column)-1, len(e.Excerpt))
+	end := len(e.Excerpt)
+	if e.Span.End.Line == e.Span.Start.Line {
+		end = min(max(int(e.Span.End.Column)-1, start), end)
+	}
+	var pad strings.Builder
+	for _, r := range e.Excerpt[:start] {
+		if r == '\t' {
+			pad.WriteRune(r)
+		} else {
+			pad.WriteByte(' ')
+		}
 	}
+	carets := strings.Repeat("^", max(utf8.RuneCountInString(e.Excerpt[start:end]), 1))
+	number := fmt.Sprint(e.Line)
+	gutter := strings.Repeat(" ", len(number))
+	return fmt.Sprintf("   %v | %v\n   %v | %v%v\n\n", number, e.Excerpt, gutter, pad.String(), carets)
+}
+
+// WithSource returns the error with the line of src where its span starts as excerpt.
+func (e VidaError) WithSource(src []byte) VidaError {
+	if !e.Span.IsValid() || e.Span.Start.Offset > len(src) {
+		return e
+	}
+	start := bytes.LastIndexByte(src[:e.Span.Start.Offset], '\n') + 1
+	end := bytes.IndexByte(src[start:], '\n')
+	if end < 0 {
+		end = len(src) - start
+	}
+	e.Excerpt = strings.TrimRight(string(src[start:start+end]), "\r")
+	return e
 }
 
 func New(scriptName string, message string, errorType string, line uint) VidaError {
@@ -44,6 +102,68 @@ func New(scriptName string, message string, errorType string, line uint) VidaErr
 	}
 }
 
+// NewAt returns an error found at span, which also gives its line.
+func NewAt(scriptName string, message string, errorType string, span token.Span) VidaError {
+	return VidaError{
+		ScriptName: scriptName,
+		Line:       span.Start.Line,
+		Span:       span,
+		Message:    message,
+		ErrType:    errorType,
+	}
+}
+
+// ErrorList holds every error found in a script when there is more than one,
+// in the order they appear in the source.
+type ErrorList []VidaError
+
+func (list ErrorList) Error() string {
+	var b strings.Builder
+	for _, e := range list {
+		b.WriteString(e.Error())
+	}
+	return b.String()
+}
+
+func (list ErrorList) Unwrap() []error {
+	errs := make([]error, len(list))
+	for k, e := range list {
+		errs[k] = e
+	}
+	return errs
+}
+
+// Err returns nil for an empty list, its error for a list of one, and the list otherwise.
+func (list ErrorList) Err() error {
+	switch len(list) {
+	case 0:
+		return nil
+	case 1:
+		return list[0]
+	}
+	return list
+}
+
+// LimitError reports that a script was stopped before finishing because
+// it ran out of its execution budget or its context was cancelled.
+// Err holds the cause and can be inspected with errors.Is.
+type LimitError struct {
+	ScriptName string
+	Line       uint
+	Err        error
+}
+
+func (e LimitError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("\n\n  [%v Error]\n   Script  : %v\n   Message : %v\n\n", LimitErrType, e.ScriptName, e.Err)
+	}
+	return fmt.Sprintf("\n\n  [%v Error]\n   Script    : %v\n   Near line : %v\n   Message   : %v\n\n", LimitErrType, e.ScriptName, e.Line, e.Err)
+}
+
+func (e LimitError) Unwrap() error {
+	return e.Err
+}
+
 type StackFrameInfo struct {
 	ScriptName string
 	Line       uint
@@ -79,4 +199,8 @@ var (
 	ErrValueIsConstant                  = errors.New("value is constant")
 	ErrMaxMemSize                       = errors.New("max memory size")
 	ErrNotImplemented                   = errors.New("not implemented functionality for this value")
+	ErrNativeWithoutVM                  = errors.New("native function called outside of a running vm")
+	ErrYieldAcrossNative                = errors.New("cannot yield across a native function call")
+	ErrInstructionLimit                 = errors.New("instruction limit exceeded")
+	ErrCallDepthLimit                   = errors.New("call depth limit exceeded")
 )
@@ -8,8 +8,8 @@ const d uint64 = 'd'
 const a uint64 = 'a'
 
 const major uint64 = 0
-const minor uint64 = 3
-const patch uint64 = 19
+const minor uint64 = 5
+const patch uint64 = 0
 const inception uint64 = 25
 const header uint64 = v<<56 | i<<48 | d<<40 | a<<32 | major<<24 | minor<<16 | patch<<8 | inception
 const name = "Vida 🌱🐝🌻"
@@ -29,19 +29,98 @@ type frame struct {
 	ip     int
 	bp     int
 	ret    int
+	exit   bool
 }
 
 type VM struct {
 	*Thread
 }
 
-func (vm *VM) run() (Result, error) {
+func (vm *VM) run() (Value, error) {
+	return vm.runFrom(1)
+}
+
+// runFrom runs the main function starting at ip. It always starts
+// from the bottom frame, so it may be called again after an error.
+func (vm *VM) runFrom(ip int) (Value, error) {
+	vm.fp = 0
 	vm.Frame = &vm.Frames[vm.fp]
 	vm.Frame.code = vm.Script.MainFunction.CoreFn.Code
 	vm.Frame.lambda = vm.Script.MainFunction
 	vm.Frame.stack = vm.Stack[:]
-	ip := 1
-	var i, op, A, B, P uint64
+	vm.State = Running
+	val, err := vm.execute(ip)
+	vm.State = Closed
+	return val, err
+}
+
+// Call invokes a callable value from native code and returns its result.
+// Vida functions run on the frame stack of the thread that owns the VM,
+// above the registers of the instruction that is currently calling out.
+func (vm *VM) Call(fn Value, args ...Value) (Value, error) {
+	return vm.call(fn, args)
+}
+
+func (vm *VM) call(fn Value, args []Value) (Value, error) {
+	if vm.limits != nil {
+		var steps uint64
+		if err := vm.limits.check(&steps); err != nil {
+			return NilValue, verror.LimitError{ScriptName: vm.Script.MainFunction.CoreFn.ScriptName, Err: err}
+		}
+	}
+	lambda, ok := fn.(*Function)
+	if !ok {
+		if nfn, ok := fn.(NFn); ok {
+			return nfn(vm, args...)
+		}
+		if !fn.IsCallable() {
+			return NilValue, verror.ErrValueNotCallable
+		}
+		return fn.Call(args...)
+	}
+	if vm.fp+1 >= len(vm.Frames) {
+		return NilValue, verror.ErrStackOverflow
+	}
+	if vm.limits != nil {
+		if err := vm.limits.checkDepth(vm.fp + 1); err != nil {
+			return NilValue, verror.LimitError{ScriptName: lambda.CoreFn.ScriptName, Err: err}
+		}
+	}
+	base := vm.top()
+	if base+lambda.CoreFn.registers > len(vm.Stack) {
+		return NilValue, verror.ErrStackOverflow
+	}
+	if err := loadArgs(vm.Stack[base:], lambda, args); err != nil {
+		return NilValue, err
+	}
+	fp, state := vm.fp, vm.State
+	if state != Waiting {
+		vm.State = Running
+	}
+	vm.fp++
+	vm.Frame = &vm.Frames[vm.fp]
+	vm.Frame.lambda = lambda
+	vm.Frame.code = lambda.CoreFn.Code
+	vm.Frame.bp = base
+	vm.Frame.stack = vm.Stack[base:]
+	vm.Frame.exit = true
+	val, err := vm.execute(0)
+	vm.fp = fp
+	vm.Frame = &vm.Frames[fp]
+	vm.State = state
+	return val, err
+}
+
+func (vm *VM) top() int {
+	if vm.Frame == nil || vm.State != Running && vm.State != Waiting {
+		return 0
+	}
+	i := vm.Frame.code[vm.Frame.ip-1]
+	return vm.Frame.bp + int(i&clean16) + int(i>>shift16&clean16) + 1
+}
+
+func (vm *VM) execute(ip int) (Value, error) {
+	var i, op, A, B, P, steps uint64
 	for {
 		i = vm.Frame.code[ip]
 		op = i >> shift56
@@ -49,6 +128,7 @@ func (vm *VM) run() (Result, error) {
 		B = i & clean16
 		P = i >> shift32 & clean24
 		ip++
+		steps++
 		switch op {
 		case load:
 			switch P {
@@ -87,33 +167,42 @@ func (vm *VM) run() (Result, error) {
 				}
 			}
 		case check:
-			if P == 0 && !vm.Frame.stack[A].Boolean() {
+			if P == checkFalsy {
+				if !vm.Frame.stack[A].Boolean() {
+					ip = int(B)
+				}
+			} else if !hasShape(vm.Frame.stack[A], P) {
 				ip = int(B)
 			}
 		case jump:
+			if vm.limits != nil {
+				if err := vm.limits.check(&steps); err != nil {
+					return NilValue, vm.limitError(ip, err)
+				}
+			}
 			ip = int(B)
 		case binopG:
 			val, err := (*vm.Script.Store)[A].Binop(P>>shift16, (*vm.Script.Store)[P&clean16])
 			if err != nil {
-				return vm.createError(ip, err)
+				return NilValue, vm.createError(ip, err)
 			}
 			vm.Frame.stack[B] = val
 		case binop:
 			val, err := vm.Frame.stack[A].Binop(P>>shift16, vm.Frame.stack[P&clean16])
 			if err != nil {
-				return vm.createError(ip, err)
+				return NilValue, vm.createError(ip, err)
 			}
 			vm.Frame.stack[B] = val
 		case binopK:
 			val, err := vm.Frame.stack[P&clean16].Binop(P>>shift16, (*vm.Script.Konstants)[A])
 			if err != nil {
-				return vm.createError(ip, err)
+				return NilValue, vm.createError(ip, err)
 			}
 			vm.Frame.stack[B] = val
 		case binopQ:
 			val, err := (*vm.Script.Konstants)[A].Binop(P>>shift16, vm.Frame.stack[P&clean16])
 			if err != nil {
-				return vm.createError(ip, err)
+				return NilValue, vm.createError(ip, err)
 			}
 			vm.Frame.stack[B] = val
 		case eq:
@@ -172,7 +261,7 @@ func (vm *VM) run() (Result, error) {
 		case prefix:
 			val, err := vm.Frame.stack[A].Prefix(P)
 			if err != nil {
-				return vm.createError(ip, err)
+				return NilValue, vm.createError(ip, err)
 			}
 			vm.Frame.stack[B] = val
 		case iGet:
@@ -219,7 +308,7 @@ func (vm *VM) run() (Result, error) {
 				}
 			}
 			if err != nil {
-				return vm.createError(ip, err)
+				return NilValue, vm.createError(ip, err)
 			}
 			vm.Frame.stack[B] = val
 		case iSet:
@@ -273,12 +362,12 @@ func (vm *VM) run() (Result, error) {
 				}
 			}
 			if err != nil {
-				return vm.createError(ip, err)
+				return NilValue, vm.createError(ip, err)
 			}
 		case slice:
 			val, err := vm.processSlice(P, A)
 			if err != nil {
-				return vm.createError(ip, err)
+				return NilValue, vm.createError(ip, err)
 			}
 			vm.Frame.stack[B] = val
 		case list:
@@ -293,28 +382,36 @@ func (vm *VM) run() (Result, error) {
 			vm.Frame.stack[B] = &Object{Value: make(map[string]Value)}
 		case forSet:
 			if _, isInteger := vm.Frame.stack[B].(Integer); !isInteger {
-				return vm.createError(ip, verror.ErrExpectedInteger)
+				return NilValue, vm.createError(ip, verror.ErrExpectedInteger)
 			}
 			if _, isInteger := vm.Frame.stack[B+1].(Integer); !isInteger {
-				return vm.createError(ip, verror.ErrExpectedInteger)
+				return NilValue, vm.createError(ip, verror.ErrExpectedInteger)
 			}
 			if v, isInteger := vm.Frame.stack[B+2].(Integer); !isInteger {
-				return vm.createError(ip, verror.ErrExpectedInteger)
+				return NilValue, vm.createError(ip, verror.ErrExpectedInteger)
 			} else if v == 0 {
-				return vm.createError(ip, verror.ErrExpectedIntegerDifferentFromZero)
+				return NilValue, vm.createError(ip, verror.ErrExpectedIntegerDifferentFromZero)
 			}
 			ip = int(A)
 		case iForSet:
 			iterable := vm.Frame.stack[A]
 			if !iterable.IsIterable() {
-				return vm.createError(ip, verror.ErrValueNotIterable)
+				return NilValue, vm.createError(ip, verror.ErrValueNotIterable)
 			}
 			vm.Frame.stack[B] = iterable.Iterator()
 			ip = int(P)
 		case forLoop:
-			i := vm.Frame.stack[B].(Integer)
-			e := vm.Frame.stack[B+1].(Integer)
-			s := vm.Frame.stack[B+2].(Integer)
+			if vm.limits != nil {
+				if err := vm.limits.check(&steps); err != nil {
+					return NilValue, vm.limitError(ip, err)
+				}
+			}
+			i, isInteger := vm.Frame.stack[B].(Integer)
+			e, isEnd := vm.Frame.stack[B+1].(Integer)
+			s, isStep := vm.Frame.stack[B+2].(Integer)
+			if !isInteger || !isEnd || !isStep {
+				return NilValue, vm.createError(ip, verror.ErrExpectedInteger)
+			}
 			if s > 0 {
 				if i < e {
 					vm.Frame.stack[B+3] = i
@@ -331,7 +428,15 @@ func (vm *VM) run() (Result, error) {
 				}
 			}
 		case iForLoop:
-			i, _ := vm.Frame.stack[B].(Iterator)
+			if vm.limits != nil {
+				if err := vm.limits.check(&steps); err != nil {
+					return NilValue, vm.limitError(ip, err)
+				}
+			}
+			i, isIterator := vm.Frame.stack[B].(Iterator)
+			if !isIterator {
+				return NilValue, vm.createError(ip, verror.ErrValueNotIterable)
+			}
 			if i.Next() {
 				vm.Frame.stack[B+1] = i.Key()
 				vm.Frame.stack[B+2] = i.Value()
@@ -354,42 +459,58 @@ func (vm *VM) run() (Result, error) {
 			}
 			vm.Frame.stack[B] = fn
 		case call:
+			if vm.limits != nil {
+				if err := vm.limits.check(&steps); err != nil {
+					return NilValue, vm.limitError(ip, err)
+				}
+			}
 			val := vm.Frame.stack[B]
 			nargs := int(A)
 			F := P >> shift16
 			P = P & clean16
 			if !val.IsCallable() {
-				return vm.createError(ip, verror.ErrValueNotCallable)
+				return NilValue, vm.createError(ip, verror.ErrValueNotCallable)
 			}
 			if fn, ok := val.(*Function); ok {
-				if vm.fp >= frameSize {
-					return vm.createError(ip, verror.ErrStackOverflow)
+				if vm.fp+1 >= len(vm.Frames) {
+					return NilValue, vm.createError(ip, verror.ErrStackOverflow)
+				}
+				if vm.limits != nil {
+					if err := vm.limits.checkDepth(vm.fp + 1); err != nil {
+						return NilValue, vm.limitError(ip, err)
+					}
 				}
 				if P != 0 {
 					switch P {
 					case ellipsisFirst:
 						if xs, ok := vm.Frame.stack[B+F].(*List); ok {
+							if int(B)+int(F)+len(xs.Value) > len(vm.Frame.stack) {
+								return NilValue, vm.createError(ip, verror.ErrStackOverflow)
+							}
 							nargs = len(xs.Value) + int(F) - 1
 							for i, v := range xs.Value {
 								vm.Frame.stack[int(B)+int(F)+i] = v
 							}
 						} else {
-							return vm.createError(ip, verror.ErrVariadicArgs)
+							return NilValue, vm.createError(ip, verror.ErrVariadicArgs)
 						}
 					case ellipsisLast:
 						if xs, ok := vm.Frame.stack[int(B)+nargs].(*List); ok {
+							if int(B)+int(A)+len(xs.Value) > len(vm.Frame.stack) {
+								return NilValue, vm.createError(ip, verror.ErrStackOverflow)
+							}
 							nargs += len(xs.Value) - 1
 							for i, v := range xs.Value {
 								vm.Frame.stack[int(B)+int(A)+i] = v
 							}
 						} else {
-							return vm.createError(ip, verror.ErrVariadicArgs)
+							return NilValue, vm.createError(ip, verror.ErrVariadicArgs)
 						}
 					}
 				}
 				if fn.CoreFn.IsVar {
 					if fn.CoreFn.Arity > nargs {
-						return vm.createError(ip, verror.ErrNotEnoughArgs)
+						return NilValue, vm.createError(ip, verror.ErrNotEnoughArgs)
 					}
 					init := int(B) + 1 + fn.CoreFn.Arity
 					count := nargs - fn.CoreFn.Arity
@@ -399,7 +520,7 @@ func (vm *VM) run() (Result, error) {
 					}
 					vm.Frame.stack[init] = &List{Value: xs}
 				} else if nargs != fn.CoreFn.Arity {
-					return vm.createError(ip, verror.ErrArity)
+					return NilValue, vm.createError(ip, verror.ErrArity)
 				}
 				if fn == vm.Frame.lambda && vm.Frame.code[ip]>>shift56 == ret {
 					for i := 0; i < nargs; i++ {
@@ -408,20 +529,43 @@ func (vm *VM) run() (Result, error) {
 					ip = 0
 					continue
 				}
+				if vm.Frame.bp+int(B)+1+fn.CoreFn.registers > len(vm.Stack) {
+					return NilValue, vm.createError(ip, verror.ErrStackOverflow)
+				}
 				vm.Frame.ip = ip
 				vm.Frame.ret = int(B)
 				bs := vm.Frame.bp
 				vm.fp++
 				vm.Frame = &vm.Frames[vm.fp]
 				vm.Frame.lambda = fn
+				vm.Frame.exit = false
 				vm.Frame.bp = bs + int(B) + 1
 				vm.Frame.code = fn.CoreFn.Code
 				vm.Frame.stack = vm.Stack[vm.Frame.bp:]
 				ip = 0
 			} else {
-				v, err := val.Call(vm.Frame.stack[B+1 : B+A+1]...)
+				var v Value
+				var err error
+				vm.Frame.ip = ip
+				if nfn, ok := val.(NFn); ok {
+					v, err = nfn(vm, vm.Frame.stack[B+1:B+A+1]...)
+				} else {
+					v, err = val.Call(vm.Frame.stack[B+1 : B+A+1]...)
+				}
+				if err == errThreadYield && !vm.isMainThread() {
+					if vm.isInNativeCall() {
+						return NilValue, vm.createError(ip, verror.ErrYieldAcrossNative)
+					}
+					vm.Frame.ip = ip
+					vm.Frame.ret = int(B)
+					vm.State = Suspended
+					if err := vm.leave(ip, &steps); err != nil {
+						return NilValue, err
+					}
+					return v, nil
+				}
 				if err != nil {
-					return vm.createError(ip, err)
+					return NilValue, vm.createError(ip, err)
 				}
 				vm.Frame.stack[B] = v
 			}
@@ -437,16 +581,34 @@ func (vm *VM) run() (Result, error) {
 			default:
 				val = vm.Frame.lambda.Free[A]
 			}
+			if vm.fp == 0 || vm.Frame.exit {
+				if err := vm.leave(ip, &steps); err != nil {
+					return NilValue, err
+				}
+				if vm.fp == 0 {
+					vm.State = Closed
+				}
+				return val, nil
+			}
 			vm.fp--
 			vm.Frame = &vm.Frames[vm.fp]
 			ip = vm.Frame.ip
 			vm.Frame.stack = vm.Stack[vm.Frame.bp:]
 			vm.Frame.stack[vm.Frame.ret] = val
+		case trace:
+			if vm.hook != nil {
+				if err := vm.hook(vm, ip-1); err != nil {
+					return NilValue, err
+				}
+			}
 		case end:
-			return Success, nil
+			if err := vm.leave(ip, &steps); err != nil {
+				return NilValue, err
+			}
+			return NilValue, nil
 		default:
 			message := fmt.Sprintf("unknown opcode %v", op)
-			return Failure, verror.New(vm.Frame.lambda.CoreFn.ScriptName, message, verror.RunTimeErrType, 0)
+			return NilValue, verror.New(vm.Frame.lambda.CoreFn.ScriptName, message, verror.RunTimeErrType, 0)
 		}
 	}
 }
@@ -670,18 +832,93 @@ func (vm *VM) processSlice(mode, sliceable uint64) (Value, error) {
 
 func (vm *VM) printCallStack() {
 	fmt.Printf("  [Call Stack]\n\n")
+	for _, f := range vm.callStack() {
+		fmt.Printf("%v\n", f)
+	}
+}
+
+// callStack returns the script and line of every frame, innermost first.
+func (vm *VM) callStack() []verror.StackFrameInfo {
+	stack := make([]verror.StackFrameInfo, 0, vm.fp+1)
 	for i := vm.fp; i >= 0; i-- {
 		modName := vm.Frames[i].lambda.CoreFn.ScriptName
 		ip := vm.Frames[i].ip
-		err := verror.NewStackFrameInfo(modName, vm.Script.ErrorInfo[modName][ip])
-		fmt.Printf("%v\n", err)
+		stack = append(stack, verror.NewStackFrameInfo(modName, vm.Frames[i].lambda.CoreFn.span(ip).Start.Line))
 	}
+	return stack
 }
 
-func (vm *VM) createError(ip int, err error) (Result, error) {
+func (vm *VM) createError(ip int, err error) error {
+	vm.Frame.ip = ip
 	modName := vm.Frame.lambda.CoreFn.ScriptName
+	switch e := err.(type) {
+	case verror.VidaError:
+		if e.ScriptName == "" {
+			e.ScriptName = modName
+			e.Span = vm.Frame.lambda.CoreFn.span(ip)
+			e.Line = e.Span.Start.Line
+		}
+		return e
+	case verror.LimitError:
+		return e
+	}
+	if err == errDebugQuit {
+		return err
+	}
+	return verror.NewAt(modName, err.Error(), verror.RunTimeErrType, vm.Frame.lambda.CoreFn.span(ip))
+}
+
+func (vm *VM) limitError(ip int, err error) error {
 	vm.Frame.ip = ip
-	return Failure, verror.New(modName, err.Error(), verror.RunTimeErrType, vm.Script.ErrorInfo[modName][ip])
+	modName := vm.Frame.lambda.CoreFn.ScriptName
+	var line uint
+	for i := ip; i >= 0 && line == 0; i-- {
+		line = vm.Frame.lambda.CoreFn.span(i).Start.Line
+	}
+	return verror.LimitError{ScriptName: modName, Line: line, Err: err}
+}
+
+// leave adds the steps counted by one run of execute to the budget
+// before it returns, so code reached through native callbacks, coroutines
+// and short scripts is counted as well.
+func (vm *VM) leave(ip int, steps *uint64) error {
+	if vm.limits == nil {
+		return nil
+	}
+	if err := vm.limits.check(steps); err != nil {
+		return vm.limitError(ip, err)
+	}
+	return nil
+}
+
+func (vm *VM) isInNativeCall() bool {
+	for i := vm.fp; i > 0; i-- {
+		if vm.Frames[i].exit {
+			return true
+		}
+	}
+	return false
+}
+
+func (vm *VM) isMainThread() bool {
+	return (*vm.Script.Store)[mainThIndex] == Value(vm.Thread)
+}
+
+// hasShape reports whether v has the shape named by the kind
+// of check in the low bits of P and the length above them.
+func hasShape(v Value, P uint64) bool {
+	switch P & clean8 {
+	case checkLength:
+		xs, ok := v.(*List)
+		return ok && uint64(len(xs.Value)) == P>>shift4
+	case checkMinLength:
+		xs, ok := v.(*List)
+		return ok && uint64(len(xs.Value)) >= P>>shift4
+	case checkObject:
+		_, ok := v.(*Object)
+		return ok
+	}
+	return false
 }
 
 func checkISACompatibility(script *Script) error {
@@ -689,5 +926,5 @@ func checkISACompatibility(script *Script) error {
 	if majorFromCode == major {
 		return nil
 	}
-	return verror.New(script.MainFunction.CoreFn.ScriptName, "script compiled with an uncompatible interpreter version", verror.FileErrType, 0)
+	return verror.New(script.MainFunction.CoreFn.ScriptName, "script compiled with an incompatible interpreter version", verror.FileErrType, 0)
 }